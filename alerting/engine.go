@@ -0,0 +1,352 @@
+package alerting
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	client "github.com/influxdata/influxdb/client/v2"
+	"go.uber.org/zap"
+)
+
+// Alert states
+const (
+	// StatePending is the state of an alert whose condition holds for less than the rule For
+	StatePending = "pending"
+	// StateFiring is the state of an alert whose condition holds
+	StateFiring = "firing"
+	// StateResolved is the state of an alert whose condition stopped holding
+	StateResolved = "resolved"
+)
+
+// alertNameLabel holds the name of the rule of an alert
+const alertNameLabel = "alertname"
+
+// Querier executes InfluxQL queries
+type Querier interface {
+	ExecuteQuery(query string, dbname string) (*client.Response, error)
+}
+
+// Alert is a series of a rule meeting its condition
+type Alert struct {
+	Fingerprint string            `json:"fingerprint"`
+	State       string            `json:"state"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	Value       float64           `json:"value"`
+	ActiveAt    time.Time         `json:"activeAt"`
+	StartsAt    time.Time         `json:"startsAt,omitempty"`
+	EndsAt      time.Time         `json:"endsAt,omitempty"`
+	Silenced    bool              `json:"silenced"`
+
+	// notifiedAt is the time of the last notification, zero when the current state
+	// was not notified
+	notifiedAt time.Time
+}
+
+// Option is used to configure the engine
+type Option func(*Engine)
+
+// OptionClock replaces the clock of the engine
+func OptionClock(now func() time.Time) Option {
+
+	return func(e *Engine) {
+		e.now = now
+	}
+}
+
+// Engine evaluates the alert rules on a schedule and notifies the webhook
+type Engine struct {
+	rules    *Rules
+	querier  Querier
+	dbname   string
+	notifier *notifier
+	now      func() time.Time
+
+	alerts   map[string]*Alert
+	silences map[string]*Silence
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	sync.Mutex
+}
+
+// NewEngine returns an engine evaluating the rules against the database
+func NewEngine(rules *Rules, querier Querier, dbname string, opts ...Option) *Engine {
+
+	e := &Engine{
+		rules:    rules,
+		querier:  querier,
+		dbname:   dbname,
+		notifier: newNotifier(rules.Webhook),
+		now:      time.Now,
+		alerts:   make(map[string]*Alert),
+		silences: make(map[string]*Silence),
+		stop:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Start evaluates every rule at its interval until Stop is called
+func (e *Engine) Start() {
+
+	zap.L().Info("Starting alert rules", zap.Int("rules", len(e.rules.Rules)))
+
+	for _, rule := range e.rules.Rules {
+		e.wg.Add(1)
+		go func(rule *Rule) {
+			defer e.wg.Done()
+
+			ticker := time.NewTicker(rule.Interval)
+			defer ticker.Stop()
+
+			for {
+				if err := e.evaluate(rule); err != nil {
+					zap.L().Error("Evaluating alert rule", zap.String("rule", rule.Name), zap.Error(err))
+				}
+
+				select {
+				case <-ticker.C:
+				case <-e.stop:
+					return
+				}
+			}
+		}(rule)
+	}
+}
+
+// Stop stops the evaluation of the rules
+func (e *Engine) Stop() {
+
+	close(e.stop)
+	e.wg.Wait()
+}
+
+// Alerts returns the pending and firing alerts
+func (e *Engine) Alerts() []Alert {
+
+	e.Lock()
+	defer e.Unlock()
+
+	result := []Alert{}
+	for _, alert := range e.alerts {
+		if alert.State != StateResolved {
+			result = append(result, *alert)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Fingerprint < result[j].Fingerprint
+	})
+
+	return result
+}
+
+// evaluate runs the query of the rule, updates the state of its alerts and sends
+// the notifications of the alerts that changed
+func (e *Engine) evaluate(rule *Rule) error {
+
+	res, err := e.querier.ExecuteQuery(rule.Query, e.dbname)
+	if err != nil {
+		return fmt.Errorf("Executing Query %s", err)
+	}
+	if err := res.Error(); err != nil {
+		return fmt.Errorf("Executing Query %s", err)
+	}
+
+	values, err := seriesValues(res)
+	if err != nil {
+		return err
+	}
+
+	e.Lock()
+	now := e.now()
+	active := map[string]bool{}
+	for _, v := range values {
+		if !conditions[rule.Condition](v.value, rule.Threshold) {
+			continue
+		}
+
+		labels := map[string]string{alertNameLabel: rule.Name}
+		for k, value := range rule.Labels {
+			labels[k] = value
+		}
+		for k, value := range v.tags {
+			labels[k] = value
+		}
+
+		fingerprint := fingerprintOf(labels)
+		active[fingerprint] = true
+
+		alert, ok := e.alerts[fingerprint]
+		if !ok || alert.State == StateResolved {
+			alert = &Alert{
+				Fingerprint: fingerprint,
+				State:       StatePending,
+				Labels:      labels,
+				ActiveAt:    now,
+			}
+			e.alerts[fingerprint] = alert
+		}
+		alert.Value = v.value
+		alert.Annotations = annotations(rule, v.value)
+
+		if alert.State == StatePending && now.Sub(alert.ActiveAt) >= rule.For {
+			alert.State = StateFiring
+			alert.StartsAt = now
+		}
+	}
+
+	var notifications []*Alert
+	for fingerprint, alert := range e.alerts {
+		if alert.Labels[alertNameLabel] != rule.Name {
+			continue
+		}
+
+		alert.Silenced = e.silenced(alert.Labels, now)
+
+		if !active[fingerprint] && alert.State != StateResolved {
+			// Alerts that were never notified firing are not notified resolved
+			if alert.State == StatePending || alert.notifiedAt.IsZero() {
+				delete(e.alerts, fingerprint)
+				continue
+			}
+			alert.State = StateResolved
+			alert.EndsAt = now
+			alert.notifiedAt = time.Time{}
+		}
+
+		if alert.Silenced && alert.State == StateResolved {
+			delete(e.alerts, fingerprint)
+			continue
+		}
+		if alert.Silenced || alert.State == StatePending {
+			continue
+		}
+
+		// Firing alerts are notified once per repeat interval, resolved ones once
+		if alert.notifiedAt.IsZero() || (alert.State == StateFiring && now.Sub(alert.notifiedAt) >= e.rules.RepeatInterval) {
+			notifications = append(notifications, alert)
+		}
+	}
+
+	payload := newPayload(notifications)
+	e.Unlock()
+
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	if err := e.notifier.send(payload); err != nil {
+		// The alerts stay unnotified and are sent again at the next evaluation
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	for _, alert := range notifications {
+		alert.notifiedAt = now
+		if alert.State == StateResolved && e.alerts[alert.Fingerprint] == alert {
+			delete(e.alerts, alert.Fingerprint)
+		}
+	}
+
+	return nil
+}
+
+// annotations returns the annotations of the rule with the value and the threshold
+func annotations(rule *Rule, value float64) map[string]string {
+
+	result := map[string]string{
+		"value":     strconv.FormatFloat(value, 'f', -1, 64),
+		"condition": fmt.Sprintf("%s %s", rule.Condition, strconv.FormatFloat(rule.Threshold, 'f', -1, 64)),
+		"query":     rule.Query,
+	}
+	for k, v := range rule.Annotations {
+		result[k] = v
+	}
+
+	return result
+}
+
+// fingerprintOf identifies an alert by its labels
+func fingerprintOf(labels map[string]string) string {
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\x00", k, labels[k])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+type seriesValue struct {
+	tags  map[string]string
+	value float64
+}
+
+// seriesValues returns the last value of every series of the response. A response
+// without series is a single series of value 0.
+func seriesValues(res *client.Response) ([]seriesValue, error) {
+
+	var values []seriesValue
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			if len(series.Values) == 0 || len(series.Columns) < 2 {
+				continue
+			}
+
+			row := series.Values[len(series.Values)-1]
+			value, err := toFloat(row[1])
+			if err != nil {
+				return nil, fmt.Errorf("Reading value of %s %s", series.Name, err)
+			}
+			values = append(values, seriesValue{tags: series.Tags, value: value})
+		}
+	}
+
+	if len(values) == 0 {
+		values = append(values, seriesValue{})
+	}
+
+	return values, nil
+}
+
+func toFloat(value interface{}) (float64, error) {
+
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("unsupported value %v", value)
+}
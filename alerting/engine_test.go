@@ -0,0 +1,249 @@
+package alerting
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme-statistics/influxdb/mock"
+	gomock "github.com/golang/mock/gomock"
+	client "github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testQuery = `SELECT count("Action") FROM FlowEvents WHERE "Action" = 'reject' AND time > now() - 5m GROUP BY "SourceNamespace"`
+
+// receiver is a local webhook recording the notifications
+type receiver struct {
+	payloads []Payload
+	status   int
+	sync.Mutex
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	var payload Payload
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+		return
+	}
+	r.payloads = append(r.payloads, payload)
+}
+
+func (r *receiver) received() []Payload {
+
+	r.Lock()
+	defer r.Unlock()
+
+	return append([]Payload{}, r.payloads...)
+}
+
+func countResponse(counts map[string]int64) *client.Response {
+
+	result := client.Result{}
+	for namespace, count := range counts {
+		result.Series = append(result.Series, models.Row{
+			Name:    "FlowEvents",
+			Tags:    map[string]string{"SourceNamespace": namespace},
+			Columns: []string{"time", "count"},
+			Values:  [][]interface{}{{"1970-01-01T00:00:00Z", json.Number(strconv.FormatInt(count, 10))}},
+		})
+	}
+
+	return &client.Response{Results: []client.Result{result}}
+}
+
+func TestEvaluate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create an engine notifying a local webhook", t, func() {
+		r := &receiver{}
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+
+		now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		rules, err := ParseRules([]byte(`
+webhook:
+  url: ` + ts.URL + `
+repeatInterval: 1h
+rules:
+  - name: rejected-flows
+    query: ` + testQuery + `
+    condition: ">"
+    threshold: 100
+    labels:
+      severity: warning
+    annotations:
+      summary: Too many rejected flows
+`))
+		So(err, ShouldBeNil)
+		rule := rules.Rules[0]
+		e := NewEngine(rules, mockDataAdder, "testDB", OptionClock(func() time.Time { return now }))
+
+		evaluate := func(counts map[string]int64) {
+			mockDataAdder.EXPECT().ExecuteQuery(testQuery, "testDB").Return(countResponse(counts), nil).Times(1)
+			So(e.evaluate(rule), ShouldBeNil)
+		}
+
+		Convey("When a series meets the condition", func() {
+			evaluate(map[string]int64{"frontend": 150, "backend": 3})
+
+			Convey("Then a firing alert should be notified", func() {
+				payloads := r.received()
+				So(len(payloads), ShouldEqual, 1)
+				So(payloads[0].Version, ShouldEqual, "4")
+				So(payloads[0].Status, ShouldEqual, StateFiring)
+				So(len(payloads[0].Alerts), ShouldEqual, 1)
+				So(payloads[0].Alerts[0].Labels, ShouldResemble, map[string]string{alertNameLabel: "rejected-flows", "severity": "warning", "SourceNamespace": "frontend"})
+				So(payloads[0].Alerts[0].Annotations["summary"], ShouldEqual, "Too many rejected flows")
+				So(payloads[0].Alerts[0].Annotations["value"], ShouldEqual, "150")
+				So(payloads[0].Text, ShouldContainSubstring, "[FIRING] rejected-flows value 150 > 100")
+
+				alerts := e.Alerts()
+				So(len(alerts), ShouldEqual, 1)
+				So(alerts[0].State, ShouldEqual, StateFiring)
+			})
+
+			Convey("Then it should not be notified again before the repeat interval", func() {
+				now = now.Add(time.Minute)
+				evaluate(map[string]int64{"frontend": 160})
+				So(len(r.received()), ShouldEqual, 1)
+
+				now = now.Add(time.Hour)
+				evaluate(map[string]int64{"frontend": 170})
+				So(len(r.received()), ShouldEqual, 2)
+			})
+
+			Convey("Then it should be notified resolved once when the condition stops holding", func() {
+				now = now.Add(time.Minute)
+				evaluate(map[string]int64{"frontend": 20})
+				evaluate(map[string]int64{"frontend": 20})
+
+				payloads := r.received()
+				So(len(payloads), ShouldEqual, 2)
+				So(payloads[1].Status, ShouldEqual, StateResolved)
+				So(payloads[1].Alerts[0].EndsAt, ShouldResemble, now)
+				So(len(e.Alerts()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the webhook fails", func() {
+			r.status = http.StatusInternalServerError
+			mockDataAdder.EXPECT().ExecuteQuery(testQuery, "testDB").Return(countResponse(map[string]int64{"frontend": 150}), nil).Times(1)
+			err := e.evaluate(rule)
+
+			Convey("Then the alert should be notified at the next evaluation", func() {
+				So(err, ShouldNotBeNil)
+				r.status = 0
+				evaluate(map[string]int64{"frontend": 150})
+				So(len(r.received()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the alert is silenced", func() {
+			_, err := e.AddSilence(Silence{Matchers: map[string]string{"SourceNamespace": "frontend"}, EndsAt: now.Add(time.Hour)})
+			So(err, ShouldBeNil)
+			evaluate(map[string]int64{"frontend": 150})
+
+			Convey("Then it should not be notified until the silence ends", func() {
+				So(len(r.received()), ShouldEqual, 0)
+				So(e.Alerts()[0].Silenced, ShouldBeTrue)
+
+				now = now.Add(time.Hour)
+				evaluate(map[string]int64{"frontend": 150})
+				So(len(r.received()), ShouldEqual, 1)
+				So(len(e.Silences()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the rule has a pending period", func() {
+			rule.For = 5 * time.Minute
+			evaluate(map[string]int64{"frontend": 150})
+
+			Convey("Then the alert should only fire once the condition held for the period", func() {
+				So(len(r.received()), ShouldEqual, 0)
+				So(e.Alerts()[0].State, ShouldEqual, StatePending)
+
+				now = now.Add(5 * time.Minute)
+				evaluate(map[string]int64{"frontend": 150})
+				So(len(r.received()), ShouldEqual, 1)
+			})
+
+			Convey("Then a pending alert should be dropped silently", func() {
+				evaluate(map[string]int64{"frontend": 1})
+				So(len(r.received()), ShouldEqual, 0)
+				So(len(e.Alerts()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the query returns no series", func() {
+			rules.Rules[0].Condition = "<"
+			rules.Rules[0].Threshold = 1
+			evaluate(nil)
+
+			Convey("Then it should be evaluated as a value of 0", func() {
+				payloads := r.received()
+				So(len(payloads), ShouldEqual, 1)
+				So(payloads[0].Alerts[0].Annotations["value"], ShouldEqual, "0")
+			})
+		})
+	})
+}
+
+func TestHandleSilences(t *testing.T) {
+	Convey("Given I create an engine", t, func() {
+		rules, err := ParseRules([]byte("webhook:\n  url: http://localhost\n"))
+		So(err, ShouldBeNil)
+		e := NewEngine(rules, nil, "testDB")
+
+		Convey("When I post a silence", func() {
+			w := httptest.NewRecorder()
+			e.HandleSilences(w, httptest.NewRequest(http.MethodPost, "/alerts/silences", strings.NewReader(`{"matchers":{"alertname":"rejected-flows"},"endsAt":"2100-01-01T00:00:00Z","comment":"maintenance"}`)))
+
+			var created Silence
+			So(json.Unmarshal(w.Body.Bytes(), &created), ShouldBeNil)
+
+			Convey("Then it should be listed and deletable", func() {
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				So(created.ID, ShouldNotBeEmpty)
+
+				w = httptest.NewRecorder()
+				e.HandleSilences(w, httptest.NewRequest(http.MethodGet, "/alerts/silences", nil))
+				var silences []Silence
+				So(json.Unmarshal(w.Body.Bytes(), &silences), ShouldBeNil)
+				So(len(silences), ShouldEqual, 1)
+				So(silences[0].Comment, ShouldEqual, "maintenance")
+
+				w = httptest.NewRecorder()
+				e.HandleSilences(w, httptest.NewRequest(http.MethodDelete, "/alerts/silences?id="+created.ID, nil))
+				So(w.Code, ShouldEqual, http.StatusNoContent)
+				So(len(e.Silences()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When I post a silence without matchers", func() {
+			w := httptest.NewRecorder()
+			e.HandleSilences(w, httptest.NewRequest(http.MethodPost, "/alerts/silences", strings.NewReader(`{"endsAt":"2100-01-01T00:00:00Z"}`)))
+
+			Convey("Then it should be rejected", func() {
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
@@ -0,0 +1,140 @@
+package alerting
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	defaultInterval       = time.Minute
+	defaultRepeatInterval = 4 * time.Hour
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+// Rules holds the alert rules and where their notifications are sent.
+//
+//	webhook:
+//	  url: https://hooks.slack.com/services/T000/B000/XXXX
+//	rules:
+//	  - name: frontend-rejected-flows
+//	    query: SELECT count("Action") FROM FlowEvents WHERE "Action" = 'reject' AND "Tags" =~ /@namespace=frontend/ AND time > now() - 5m
+//	    condition: ">"
+//	    threshold: 100
+//	    labels:
+//	      severity: warning
+//	    annotations:
+//	      summary: Rejected flows in namespace frontend
+//	  - name: host-y-silent
+//	    query: SELECT count("ContextID") FROM ContainerEvents WHERE "Host" = 'y' AND time > now() - 10m
+//	    condition: "<"
+//	    threshold: 1
+//	    interval: 5m
+type Rules struct {
+	Webhook Webhook `yaml:"webhook"`
+	Rules   []*Rule `yaml:"rules"`
+	// RepeatInterval is the time after which a firing alert is notified again
+	RepeatInterval time.Duration `yaml:"repeatInterval"`
+}
+
+// Webhook is the receiver of the notifications
+type Webhook struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+// Rule is an InfluxQL query evaluated on a schedule. Every series returned is an
+// alert firing while its last value meets the condition. Queries returning no
+// series are evaluated as a single series of value 0, so that missing events
+// can be alerted on.
+type Rule struct {
+	Name      string  `yaml:"name"`
+	Query     string  `yaml:"query"`
+	Condition string  `yaml:"condition"`
+	Threshold float64 `yaml:"threshold"`
+	// Interval is the time between two evaluations
+	Interval time.Duration `yaml:"interval"`
+	// For is the time the condition must hold before the alert fires
+	For         time.Duration     `yaml:"for"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// LoadRulesFile loads the alert rules from a YAML file
+func LoadRulesFile(path string) (*Rules, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading alert rules %s", err)
+	}
+
+	return ParseRules(data)
+}
+
+// ParseRules parses and validates YAML alert rules
+func ParseRules(data []byte) (*Rules, error) {
+
+	var rules Rules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("Parsing alert rules %s", err)
+	}
+
+	if err := rules.validate(); err != nil {
+		return nil, err
+	}
+
+	return &rules, nil
+}
+
+func (r *Rules) validate() error {
+
+	if r.Webhook.URL == "" {
+		return fmt.Errorf("Missing webhook url")
+	}
+	if r.Webhook.Timeout == 0 {
+		r.Webhook.Timeout = defaultWebhookTimeout
+	}
+	if r.RepeatInterval == 0 {
+		r.RepeatInterval = defaultRepeatInterval
+	}
+
+	names := map[string]bool{}
+	for i, rule := range r.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("Rule %d: missing name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("Rule %s: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+
+		// Rules are only allowed to read from the database
+		if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(rule.Query)), "SELECT ") {
+			return fmt.Errorf("Rule %s: query must be a SELECT statement", rule.Name)
+		}
+		if _, ok := conditions[rule.Condition]; !ok {
+			return fmt.Errorf("Rule %s: unknown condition %q", rule.Name, rule.Condition)
+		}
+		if rule.Interval == 0 {
+			rule.Interval = defaultInterval
+		}
+		if rule.Interval < 0 || rule.For < 0 {
+			return fmt.Errorf("Rule %s: negative interval", rule.Name)
+		}
+	}
+
+	return nil
+}
+
+var conditions = map[string]func(value float64, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
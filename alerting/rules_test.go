@@ -0,0 +1,54 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseRules(t *testing.T) {
+	Convey("Given I parse alert rules", t, func() {
+
+		Convey("When the rules are valid", func() {
+			rules, err := ParseRules([]byte(`
+webhook:
+  url: http://localhost:9093/hook
+  headers:
+    Authorization: Bearer token
+rules:
+  - name: host-y-silent
+    query: SELECT count("ContextID") FROM ContainerEvents WHERE "Host" = 'y' AND time > now() - 10m
+    condition: "<"
+    threshold: 1
+    for: 2m
+`))
+
+			Convey("Then the defaults should be set", func() {
+				So(err, ShouldBeNil)
+				So(rules.Webhook.Headers["Authorization"], ShouldEqual, "Bearer token")
+				So(rules.Webhook.Timeout, ShouldEqual, defaultWebhookTimeout)
+				So(rules.RepeatInterval, ShouldEqual, defaultRepeatInterval)
+				So(len(rules.Rules), ShouldEqual, 1)
+				So(rules.Rules[0].Interval, ShouldEqual, time.Minute)
+				So(rules.Rules[0].For, ShouldEqual, 2*time.Minute)
+			})
+		})
+
+		Convey("When the rules are invalid", func() {
+			for _, data := range []string{
+				"rules: []",
+				"webhook:\n  url: http://localhost\nrules:\n  - name: a\n    query: DROP DATABASE flowDB\n    condition: '>'\n",
+				"webhook:\n  url: http://localhost\nrules:\n  - name: a\n    query: SELECT 1\n    condition: '=~'\n",
+				"webhook:\n  url: http://localhost\nrules:\n  - name: a\n    query: SELECT 1\n    condition: '>'\n  - name: a\n    query: SELECT 1\n    condition: '>'\n",
+				"webhook:\n  url: http://localhost\nunknown: true\n",
+			} {
+				_, err := ParseRules([]byte(data))
+
+				Convey("Then an error should be returned for "+data, func() {
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
@@ -0,0 +1,172 @@
+package alerting
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aporeto-inc/trireme-statistics/auth"
+)
+
+// Silence mutes the notifications of the alerts with all the matched labels
+// between StartsAt and EndsAt
+type Silence struct {
+	ID        string            `json:"id"`
+	Matchers  map[string]string `json:"matchers"`
+	StartsAt  time.Time         `json:"startsAt"`
+	EndsAt    time.Time         `json:"endsAt"`
+	CreatedBy string            `json:"createdBy,omitempty"`
+	Comment   string            `json:"comment,omitempty"`
+}
+
+// matches tells if the silence mutes the alert with the labels at the given time
+func (s *Silence) matches(labels map[string]string, now time.Time) bool {
+
+	if now.Before(s.StartsAt) || !now.Before(s.EndsAt) {
+		return false
+	}
+
+	for k, v := range s.Matchers {
+		if labels[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// silenced tells if one of the silences mutes the alert. It must be called with the engine locked.
+func (e *Engine) silenced(labels map[string]string, now time.Time) bool {
+
+	for id, silence := range e.silences {
+		if !now.Before(silence.EndsAt) {
+			delete(e.silences, id)
+			continue
+		}
+		if silence.matches(labels, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddSilence validates and adds a silence. A missing start is now.
+func (e *Engine) AddSilence(silence Silence) (*Silence, error) {
+
+	if len(silence.Matchers) == 0 {
+		return nil, fmt.Errorf("Silence without matchers")
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = e.now()
+	}
+	if !silence.EndsAt.After(silence.StartsAt) {
+		return nil, fmt.Errorf("Silence ends before it starts")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("Generating silence id %s", err)
+	}
+	silence.ID = hex.EncodeToString(id)
+	e.silences[silence.ID] = &silence
+
+	return &silence, nil
+}
+
+// DeleteSilence removes a silence
+func (e *Engine) DeleteSilence(id string) error {
+
+	e.Lock()
+	defer e.Unlock()
+
+	if _, ok := e.silences[id]; !ok {
+		return fmt.Errorf("Unknown silence %s", id)
+	}
+	delete(e.silences, id)
+
+	return nil
+}
+
+// Silences returns the silences that did not end
+func (e *Engine) Silences() []Silence {
+
+	e.Lock()
+	defer e.Unlock()
+
+	now := e.now()
+	result := []Silence{}
+	for _, silence := range e.silences {
+		if now.Before(silence.EndsAt) {
+			result = append(result, *silence)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartsAt.Before(result[j].StartsAt)
+	})
+
+	return result
+}
+
+// GetAlerts is the handler returning the pending and firing alerts
+func (e *Engine) GetAlerts(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(e.Alerts()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleSilences is the handler listing the silences on GET, adding the silence
+// posted as JSON on POST and removing the silence given by id on DELETE
+func (e *Engine) HandleSilences(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(e.Silences()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+	case http.MethodPost:
+		var silence Silence
+		if err := json.NewDecoder(r.Body).Decode(&silence); err != nil {
+			http.Error(w, "Decoding silence "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Silences are attributed to the authenticated user rather than the one claimed
+		if user := auth.User(r); user != "" {
+			silence.CreatedBy = user
+		}
+
+		created, err := e.AddSilence(silence)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(created); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+	case http.MethodDelete:
+		if err := e.DeleteSilence(r.URL.Query().Get("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Unsupported method "+r.Method, http.StatusMethodNotAllowed)
+	}
+}
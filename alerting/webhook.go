@@ -0,0 +1,155 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const receiverName = "trireme-statistics"
+
+// Payload is the JSON body sent to the webhook. It follows the Alertmanager webhook
+// format, and its text field makes it a valid Slack incoming webhook message.
+type Payload struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []PayloadAlert    `json:"alerts"`
+	Text              string            `json:"text"`
+}
+
+// PayloadAlert is an alert of a notification
+type PayloadAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+func newPayload(alerts []*Alert) *Payload {
+
+	payload := &Payload{
+		Version:           "4",
+		Status:            StateResolved,
+		Receiver:          receiverName,
+		GroupLabels:       map[string]string{},
+		CommonLabels:      map[string]string{},
+		CommonAnnotations: map[string]string{},
+		Alerts:            []PayloadAlert{},
+	}
+	if len(alerts) == 0 {
+		return payload
+	}
+
+	var lines []string
+	for i, alert := range alerts {
+		if alert.State == StateFiring {
+			payload.Status = StateFiring
+		}
+
+		payload.Alerts = append(payload.Alerts, PayloadAlert{
+			Status:      alert.State,
+			Labels:      alert.Labels,
+			Annotations: alert.Annotations,
+			StartsAt:    alert.StartsAt,
+			EndsAt:      alert.EndsAt,
+			Fingerprint: alert.Fingerprint,
+		})
+
+		if i == 0 {
+			copyMap(payload.CommonLabels, alert.Labels)
+			copyMap(payload.CommonAnnotations, alert.Annotations)
+		} else {
+			intersect(payload.CommonLabels, alert.Labels)
+			intersect(payload.CommonAnnotations, alert.Annotations)
+		}
+
+		line := fmt.Sprintf("[%s] %s value %s %s", strings.ToUpper(alert.State), alert.Labels[alertNameLabel], alert.Annotations["value"], alert.Annotations["condition"])
+		if summary := alert.Annotations["summary"]; summary != "" {
+			line += ": " + summary
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	payload.GroupLabels[alertNameLabel] = payload.CommonLabels[alertNameLabel]
+	payload.GroupKey = "{}:{" + alertNameLabel + "=\"" + payload.CommonLabels[alertNameLabel] + "\"}"
+	payload.Text = strings.Join(lines, "\n")
+
+	return payload
+}
+
+func copyMap(dst map[string]string, src map[string]string) {
+
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// intersect removes the entries of dst that are not in src
+func intersect(dst map[string]string, src map[string]string) {
+
+	for k, v := range dst {
+		if src[k] != v {
+			delete(dst, k)
+		}
+	}
+}
+
+// notifier posts the payloads to the webhook
+type notifier struct {
+	webhook    Webhook
+	httpClient *http.Client
+}
+
+func newNotifier(webhook Webhook) *notifier {
+
+	return &notifier{
+		webhook:    webhook,
+		httpClient: &http.Client{Timeout: webhook.Timeout},
+	}
+}
+
+func (n *notifier) send(payload *Payload) error {
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Encoding notification %s", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Creating notification %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.webhook.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Sending notification %s", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Sending notification: webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
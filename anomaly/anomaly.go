@@ -0,0 +1,335 @@
+package anomaly
+
+import (
+	"fmt"
+	"time"
+)
+
+// Kinds of anomalies
+const (
+	// KindNewPeer is reported when a workload talks to a peer it never talked to before
+	KindNewPeer = "newpeer"
+	// KindNewPort is reported when a workload is reached on a port never used before
+	KindNewPort = "newport"
+	// KindFlowSpike is reported when the flows of a workload exceed their usual rate
+	KindFlowSpike = "flowspike"
+	// KindRejectSpike is reported when the rejected flows of a workload exceed their usual rate
+	KindRejectSpike = "rejectspike"
+)
+
+const (
+	defaultLearningPeriod = 24 * time.Hour
+	defaultSpikeFactor    = 3.0
+	defaultMinSpike       = 10
+	defaultRecentSize     = 5
+
+	// maxIdleHours bounds the hours without flows folded into the rates of a workload
+	maxIdleHours = 7 * 24
+)
+
+// Endpoint is a workload or an external endpoint
+type Endpoint struct {
+	Namespace string
+	Workload  string
+	External  bool
+}
+
+// String returns the name of the endpoint
+func (e Endpoint) String() string {
+
+	if e.External || e.Namespace == "" {
+		return e.Workload
+	}
+
+	return e.Namespace + "/" + e.Workload
+}
+
+// Flow is a flow event scored by the detector
+type Flow struct {
+	Time        time.Time
+	Source      Endpoint
+	Destination Endpoint
+	Port        int
+	Count       int
+	Rejected    bool
+}
+
+// Anomaly is a flow or a rate of flows that does not match the baseline of a workload
+type Anomaly struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Workload  string    `json:"workload"`
+	Peer      string    `json:"peer,omitempty"`
+	Port      int       `json:"port,omitempty"`
+	// Observed and Expected are the flows of the hour and their usual number for spikes
+	Observed float64 `json:"observed,omitempty"`
+	Expected float64 `json:"expected,omitempty"`
+	// Score is 1 for new peers and ports and the ratio of the observed to the expected
+	// flows for spikes
+	Score       float64 `json:"score"`
+	Description string  `json:"description"`
+}
+
+// Option is used to configure the detector
+type Option func(*Detector)
+
+// OptionLearningPeriod sets the time during which the flows of a new workload
+// are learned without being scored
+func OptionLearningPeriod(period time.Duration) Option {
+
+	return func(d *Detector) {
+		d.learningPeriod = period
+	}
+}
+
+// OptionSpike sets the factor of the usual hourly rate and the minimum number of
+// flows above which a spike is reported
+func OptionSpike(factor float64, min int) Option {
+
+	return func(d *Detector) {
+		d.spikeFactor = factor
+		d.minSpike = min
+	}
+}
+
+// Detector learns a baseline per workload from the flow history and scores the
+// flows against it. It must only be used from one goroutine.
+type Detector struct {
+	models map[string]*model
+
+	learningPeriod time.Duration
+	spikeFactor    float64
+	minSpike       int
+
+	// since is the time the detector was created. Older flows are replayed history
+	// and are only learned.
+	since time.Time
+}
+
+// NewDetector returns a detector
+func NewDetector(opts ...Option) *Detector {
+
+	d := &Detector{
+		models:         make(map[string]*model),
+		learningPeriod: defaultLearningPeriod,
+		spikeFactor:    defaultSpikeFactor,
+		minSpike:       defaultMinSpike,
+		since:          time.Now(),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// model is the baseline of a workload
+type model struct {
+	endpoint  Endpoint
+	firstSeen time.Time
+
+	peers map[string]bool
+	ports map[int]bool
+
+	// hour is the start of the hour whose flows are being counted
+	hour     time.Time
+	flows    int
+	rejected int
+	reported map[string]bool
+
+	// rates holds the flows seen at every hour of the day
+	rates [24]rate
+
+	recent []Anomaly
+}
+
+type rate struct {
+	flows    float64
+	rejected float64
+	hours    int
+}
+
+// Observe learns the flow and returns the anomalies it raises. Flows must be
+// observed once and in time order.
+func (d *Detector) Observe(flow Flow) []Anomaly {
+
+	var anomalies []Anomaly
+
+	if !flow.Source.External {
+		m := d.model(flow.Source, flow.Time)
+		peer := flow.Destination.String()
+		if !m.peers[peer] {
+			m.peers[peer] = true
+			if d.scored(m, flow.Time) {
+				anomalies = append(anomalies, m.anomaly(Anomaly{
+					Time:        flow.Time,
+					Kind:        KindNewPeer,
+					Peer:        peer,
+					Port:        flow.Port,
+					Score:       1,
+					Description: fmt.Sprintf("%s talked to %s on port %d for the first time", m.endpoint, peer, flow.Port),
+				}))
+			}
+		}
+		anomalies = append(anomalies, d.count(m, flow)...)
+	}
+
+	if !flow.Destination.External {
+		m := d.model(flow.Destination, flow.Time)
+		if flow.Port > 0 && !m.ports[flow.Port] {
+			m.ports[flow.Port] = true
+			if d.scored(m, flow.Time) {
+				anomalies = append(anomalies, m.anomaly(Anomaly{
+					Time:        flow.Time,
+					Kind:        KindNewPort,
+					Peer:        flow.Source.String(),
+					Port:        flow.Port,
+					Score:       1,
+					Description: fmt.Sprintf("%s was reached on port %d for the first time, from %s", m.endpoint, flow.Port, flow.Source),
+				}))
+			}
+		}
+		anomalies = append(anomalies, d.count(m, flow)...)
+	}
+
+	return anomalies
+}
+
+// Recent returns the last anomalies of a workload raised after the given time
+func (d *Detector) Recent(endpoint Endpoint, after time.Time) []Anomaly {
+
+	m, ok := d.models[endpoint.String()]
+	if !ok {
+		return nil
+	}
+
+	var result []Anomaly
+	for _, a := range m.recent {
+		if a.Time.After(after) {
+			result = append(result, a)
+		}
+	}
+
+	return result
+}
+
+func (d *Detector) model(endpoint Endpoint, t time.Time) *model {
+
+	key := endpoint.String()
+	m, ok := d.models[key]
+	if !ok {
+		m = &model{
+			endpoint:  endpoint,
+			firstSeen: t,
+			peers:     make(map[string]bool),
+			ports:     make(map[int]bool),
+			hour:      t.Truncate(time.Hour),
+			reported:  make(map[string]bool),
+		}
+		d.models[key] = m
+	}
+
+	return m
+}
+
+// scored tells if the flows of the workload seen at the given time are scored
+func (d *Detector) scored(m *model, t time.Time) bool {
+
+	return t.After(d.since) && t.Sub(m.firstSeen) >= d.learningPeriod
+}
+
+// count adds the flow to the rate of the hour of the workload and reports spikes
+func (d *Detector) count(m *model, flow Flow) []Anomaly {
+
+	m.advance(flow.Time)
+
+	count := flow.Count
+	if count <= 0 {
+		count = 1
+	}
+	m.flows += count
+	if flow.Rejected {
+		m.rejected += count
+	}
+
+	if !d.scored(m, flow.Time) {
+		return nil
+	}
+
+	usual := m.rates[m.hour.Hour()]
+	if usual.hours == 0 {
+		return nil
+	}
+
+	var anomalies []Anomaly
+	for _, spike := range []struct {
+		kind     string
+		observed int
+		expected float64
+		what     string
+	}{
+		{KindFlowSpike, m.flows, usual.flows / float64(usual.hours), "flows"},
+		{KindRejectSpike, m.rejected, usual.rejected / float64(usual.hours), "rejected flows"},
+	} {
+		threshold := spike.expected * d.spikeFactor
+		if threshold < float64(d.minSpike) {
+			threshold = float64(d.minSpike)
+		}
+		if m.reported[spike.kind] || float64(spike.observed) <= threshold {
+			continue
+		}
+
+		m.reported[spike.kind] = true
+		score := float64(spike.observed)
+		if spike.expected > 0 {
+			score = float64(spike.observed) / spike.expected
+		}
+		anomalies = append(anomalies, m.anomaly(Anomaly{
+			Time:        flow.Time,
+			Kind:        spike.kind,
+			Observed:    float64(spike.observed),
+			Expected:    spike.expected,
+			Score:       score,
+			Description: fmt.Sprintf("%s had %d %s this hour, usually %.1f", m.endpoint, spike.observed, spike.what, spike.expected),
+		}))
+	}
+
+	return anomalies
+}
+
+// advance folds the counts of the past hours into the rates of the workload
+func (m *model) advance(t time.Time) {
+
+	hour := t.Truncate(time.Hour)
+	for i := 0; m.hour.Before(hour) && i < maxIdleHours; i++ {
+		r := &m.rates[m.hour.Hour()]
+		r.flows += float64(m.flows)
+		r.rejected += float64(m.rejected)
+		r.hours++
+
+		m.hour = m.hour.Add(time.Hour)
+		m.flows = 0
+		m.rejected = 0
+		m.reported = make(map[string]bool)
+	}
+
+	if m.hour.Before(hour) {
+		m.hour = hour
+	}
+}
+
+// anomaly completes the anomaly with the workload and keeps it in the recent anomalies
+func (m *model) anomaly(a Anomaly) Anomaly {
+
+	a.Namespace = m.endpoint.Namespace
+	a.Workload = m.endpoint.Workload
+
+	m.recent = append(m.recent, a)
+	if len(m.recent) > defaultRecentSize {
+		m.recent = m.recent[len(m.recent)-defaultRecentSize:]
+	}
+
+	return a
+}
@@ -0,0 +1,83 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDetector(t *testing.T) {
+
+	web := Endpoint{Namespace: "default", Workload: "web"}
+	db := Endpoint{Namespace: "default", Workload: "db"}
+	cache := Endpoint{Namespace: "default", Workload: "cache"}
+	internet := Endpoint{Workload: "8.8.8.0/24", External: true}
+
+	Convey("Given a detector that learned a day of flows", t, func() {
+		d := NewDetector(OptionLearningPeriod(24*time.Hour), OptionSpike(3, 10))
+		start := d.since.Add(-48 * time.Hour).Truncate(time.Hour)
+
+		for h := 0; h < 48; h++ {
+			So(d.Observe(Flow{Time: start.Add(time.Duration(h) * time.Hour), Source: web, Destination: db, Port: 5432, Count: 2}), ShouldBeEmpty)
+		}
+		now := d.since.Add(time.Minute)
+
+		Convey("When I observe a known flow", func() {
+			anomalies := d.Observe(Flow{Time: now, Source: web, Destination: db, Port: 5432, Count: 1})
+
+			Convey("Then I should get no anomaly", func() {
+				So(anomalies, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the workload talks to a new peer", func() {
+			anomalies := d.Observe(Flow{Time: now, Source: web, Destination: internet, Port: 443, Count: 1})
+
+			Convey("Then I should get a new peer anomaly", func() {
+				So(len(anomalies), ShouldEqual, 1)
+				So(anomalies[0].Kind, ShouldEqual, KindNewPeer)
+				So(anomalies[0].Namespace, ShouldEqual, "default")
+				So(anomalies[0].Workload, ShouldEqual, "web")
+				So(anomalies[0].Peer, ShouldEqual, "8.8.8.0/24")
+				So(anomalies[0].Score, ShouldEqual, 1)
+				So(d.Recent(web, now.Add(-time.Minute)), ShouldResemble, anomalies)
+			})
+		})
+
+		Convey("When the workload is reached on a new port", func() {
+			anomalies := d.Observe(Flow{Time: now, Source: web, Destination: db, Port: 22, Count: 1})
+
+			Convey("Then I should get a new port anomaly", func() {
+				So(len(anomalies), ShouldEqual, 1)
+				So(anomalies[0].Kind, ShouldEqual, KindNewPort)
+				So(anomalies[0].Workload, ShouldEqual, "db")
+				So(anomalies[0].Port, ShouldEqual, 22)
+			})
+		})
+
+		Convey("When rejected flows spike", func() {
+			anomalies := d.Observe(Flow{Time: now, Source: web, Destination: db, Port: 5432, Count: 30, Rejected: true})
+			again := d.Observe(Flow{Time: now.Add(time.Second), Source: web, Destination: db, Port: 5432, Count: 30, Rejected: true})
+
+			Convey("Then I should get the spikes once per hour for both workloads", func() {
+				kinds := map[string]int{}
+				for _, a := range anomalies {
+					kinds[a.Kind]++
+				}
+				So(kinds, ShouldResemble, map[string]int{KindFlowSpike: 2, KindRejectSpike: 2})
+				So(again, ShouldBeEmpty)
+				So(anomalies[0].Expected, ShouldEqual, 2)
+				So(anomalies[0].Observed, ShouldEqual, 30)
+			})
+		})
+
+		Convey("When a new workload starts talking", func() {
+			anomalies := d.Observe(Flow{Time: now, Source: cache, Destination: internet, Port: 443, Count: 1})
+
+			Convey("Then its flows should be learned during the learning period", func() {
+				So(anomalies, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Realm is the realm of the authentication challenges
+const Realm = "trireme-graph"
+
+// Authenticator authenticates the requests carrying its credentials
+type Authenticator interface {
+	// Authenticate returns the user of the request, and false when the request
+	// does not carry credentials accepted by the authenticator
+	Authenticate(r *http.Request) (string, bool)
+	// Challenge returns the WWW-Authenticate challenge of the scheme, empty for
+	// schemes that cannot be challenged
+	Challenge() string
+}
+
+type userKey struct{}
+
+// User returns the user authenticated for the request, empty without authentication
+func User(r *http.Request) string {
+
+	user, _ := r.Context().Value(userKey{}).(string)
+	return user
+}
+
+// Handler only calls next for the requests accepted by one of the authenticators,
+// the others get a 401. All requests are accepted without authenticators.
+func Handler(next http.Handler, authenticators ...Authenticator) http.Handler {
+
+	if len(authenticators) == 0 {
+		return next
+	}
+
+	var challenges []string
+	for _, authenticator := range authenticators {
+		if challenge := authenticator.Challenge(); challenge != "" {
+			challenges = append(challenges, challenge)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		for _, authenticator := range authenticators {
+			if user, ok := authenticator.Authenticate(r); ok {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+				return
+			}
+		}
+
+		zap.L().Debug("Rejecting unauthenticated request", zap.String("path", r.URL.Path), zap.String("remote", r.RemoteAddr))
+		if len(challenges) > 0 {
+			w.Header().Set("WWW-Authenticate", strings.Join(challenges, ", "))
+		}
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+	})
+}
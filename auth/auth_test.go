@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHandler(t *testing.T) {
+
+	Convey("Given I protect a handler with tokens and basic auth", t, func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		So(err, ShouldBeNil)
+
+		htpasswd, err := ParseHtpasswd([]byte("# users\nalice:" + string(hash) + "\nbob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"))
+		So(err, ShouldBeNil)
+
+		var user string
+		handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user = User(r)
+		}), NewTokens(map[string]string{"t0ken": "grafana"}), htpasswd, &ClientCertificates{})
+
+		serve := func(r *http.Request) *httptest.ResponseRecorder {
+			user = ""
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			return w
+		}
+
+		Convey("When I make a request without credentials", func() {
+			w := serve(httptest.NewRequest("GET", "/get", nil))
+
+			Convey("Then I should be challenged", func() {
+				So(w.Code, ShouldEqual, 401)
+				So(w.Header().Get("WWW-Authenticate"), ShouldEqual, `Bearer realm="trireme-graph", Basic realm="trireme-graph"`)
+			})
+		})
+
+		Convey("When I make requests with valid credentials", func() {
+			Convey("Then the users should be authenticated", func() {
+				r := httptest.NewRequest("GET", "/get", nil)
+				r.Header.Set("Authorization", "Bearer t0ken")
+				So(serve(r).Code, ShouldEqual, 200)
+				So(user, ShouldEqual, "grafana")
+
+				r = httptest.NewRequest("GET", "/get", nil)
+				r.SetBasicAuth("alice", "secret")
+				So(serve(r).Code, ShouldEqual, 200)
+				So(user, ShouldEqual, "alice")
+
+				r = httptest.NewRequest("GET", "/get", nil)
+				r.SetBasicAuth("bob", "password")
+				So(serve(r).Code, ShouldEqual, 200)
+				So(user, ShouldEqual, "bob")
+
+				r = httptest.NewRequest("GET", "/get", nil)
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "ops"}}}}}
+				So(serve(r).Code, ShouldEqual, 200)
+				So(user, ShouldEqual, "ops")
+			})
+		})
+
+		Convey("When I make requests with invalid credentials", func() {
+			Convey("Then they should be rejected", func() {
+				r := httptest.NewRequest("GET", "/get", nil)
+				r.Header.Set("Authorization", "Bearer t0ke")
+				So(serve(r).Code, ShouldEqual, 401)
+
+				r = httptest.NewRequest("GET", "/get", nil)
+				r.SetBasicAuth("alice", "password")
+				So(serve(r).Code, ShouldEqual, 401)
+
+				r = httptest.NewRequest("GET", "/get", nil)
+				r.SetBasicAuth("carol", "secret")
+				So(serve(r).Code, ShouldEqual, 401)
+
+				r = httptest.NewRequest("GET", "/get", nil)
+				r.TLS = &tls.ConnectionState{}
+				So(serve(r).Code, ShouldEqual, 401)
+				So(user, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given I do not configure authenticators", t, func() {
+		next := http.NotFoundHandler()
+
+		Convey("Then the requests should not be authenticated", func() {
+			So(Handler(next), ShouldEqual, next)
+		})
+	})
+}
+
+func TestLoadFiles(t *testing.T) {
+
+	Convey("Given I write credential files", t, func() {
+		dir, err := ioutil.TempDir("", "auth")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		write := func(name, data string) string {
+			path := filepath.Join(dir, name)
+			So(ioutil.WriteFile(path, []byte(data), 0600), ShouldBeNil)
+			return path
+		}
+
+		Convey("Then the tokens should be loaded with their user", func() {
+			tokens, err := LoadTokensFile(write("tokens", "# tokens\n\nt0ken, grafana\n"))
+			So(err, ShouldBeNil)
+			So(tokens.users, ShouldResemble, map[string]string{"t0ken": "grafana"})
+
+			_, err = LoadTokensFile(write("tokens", "t0ken\n"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Then the htpasswd files with unsupported hashes should be rejected", func() {
+			_, err := LoadHtpasswdFile(write("htpasswd", "alice:$apr1$wB3aXw8E$kc6Wgw2nGBq1s2sbTnDs4/\n"))
+			So(err, ShouldNotBeNil)
+
+			_, err = LoadHtpasswdFile(filepath.Join(dir, "missing"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Then the client CAs should be read from PEM", func() {
+			_, err := ServerTLSConfig(write("ca.pem", "not a certificate"), true)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// ClientCertificates authenticates the requests made with a client certificate
+// verified by the TLS server. The user is the common name of the certificate.
+type ClientCertificates struct{}
+
+// Authenticate accepts the requests with a verified client certificate
+func (c *ClientCertificates) Authenticate(r *http.Request) (string, bool) {
+
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// Challenge returns no challenge, client certificates are requested by the TLS handshake
+func (c *ClientCertificates) Challenge() string {
+
+	return ""
+}
+
+// ServerTLSConfig returns the TLS configuration of a server verifying the client
+// certificates against the CAs of the file. When required is false, clients
+// without certificate can still connect and authenticate otherwise.
+func ServerTLSConfig(clientCAFile string, required bool) (*tls.Config, error) {
+
+	data, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("Reading client CAs %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("No certificate in %s", clientCAFile)
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if required {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: clientAuth,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
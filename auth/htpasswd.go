@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd authenticates the requests with the HTTP basic credentials of an htpasswd file
+type Htpasswd struct {
+	// hashes are the password hashes of the users
+	hashes map[string]string
+}
+
+// LoadHtpasswdFile reads the users of an htpasswd file. Only bcrypt hashes,
+// created with htpasswd -B, and SHA1 hashes, created with htpasswd -s, are supported.
+func LoadHtpasswdFile(path string) (*Htpasswd, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading htpasswd %s", err)
+	}
+
+	return ParseHtpasswd(data)
+}
+
+// ParseHtpasswd parses the users of an htpasswd file
+func ParseHtpasswd(data []byte) (*Htpasswd, error) {
+
+	hashes := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid htpasswd entry at line %d, expected user:hash", i+1)
+		}
+
+		user, hash := parts[0], parts[1]
+		if !isBcrypt(hash) && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("Unsupported hash for user %s, use htpasswd -B", user)
+		}
+		hashes[user] = hash
+	}
+
+	if len(hashes) == 0 {
+		return nil, fmt.Errorf("No user in htpasswd")
+	}
+
+	return &Htpasswd{hashes: hashes}, nil
+}
+
+func isBcrypt(hash string) bool {
+
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// Authenticate accepts the requests with the basic credentials of a user
+func (h *Htpasswd) Authenticate(r *http.Request) (string, bool) {
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+
+	hash, ok := h.hashes[user]
+	if !ok {
+		return "", false
+	}
+
+	if isBcrypt(hash) {
+		return user, bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+
+	return user, subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+}
+
+// Challenge returns the basic challenge
+func (h *Htpasswd) Challenge() string {
+
+	return `Basic realm="` + Realm + `"`
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Tokens authenticates the requests carrying a static bearer token
+type Tokens struct {
+	// users are the users of the tokens
+	users map[string]string
+}
+
+// NewTokens returns the authenticator of the tokens, given with their user
+func NewTokens(users map[string]string) *Tokens {
+
+	return &Tokens{users: users}
+}
+
+// LoadTokensFile reads the tokens of a file, one token per line followed by
+// its user, separated by a comma. Empty lines and lines starting with # are ignored.
+//
+//	3f9a0e6c1b7d42a8,grafana
+//	8c1d5e2b9f0a6374,ops
+func LoadTokensFile(path string) (*Tokens, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading tokens %s", err)
+	}
+
+	users := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		token, user := strings.TrimSpace(fields[0]), ""
+		if len(fields) > 1 {
+			user = strings.TrimSpace(fields[1])
+		}
+		if token == "" || user == "" {
+			return nil, fmt.Errorf("Invalid token at line %d of %s, expected token,user", i+1, path)
+		}
+		users[token] = user
+	}
+
+	if len(users) == 0 {
+		return nil, fmt.Errorf("No token in %s", path)
+	}
+
+	return NewTokens(users), nil
+}
+
+// Authenticate accepts the requests with a known token in their Authorization header
+func (t *Tokens) Authenticate(r *http.Request) (string, bool) {
+
+	header := r.Header.Get("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	given := []byte(strings.TrimSpace(header[len("Bearer "):]))
+
+	// All the tokens are compared so that the time taken does not tell which matched
+	var user string
+	for token, u := range t.users {
+		if subtle.ConstantTimeCompare(given, []byte(token)) == 1 {
+			user = u
+		}
+	}
+
+	return user, user != ""
+}
+
+// Challenge returns the bearer challenge
+func (t *Tokens) Challenge() string {
+
+	return `Bearer realm="` + Realm + `"`
+}
@@ -43,7 +43,7 @@ func explode() {
 		flowModel.FlowRecord.Source = &source
 
 		destination.ID = "dstID"
-		destination.IP = "192.1688.2.2"
+		destination.IP = "192.168.2.2"
 		destination.Port = 880
 		destination.Type = collector.EnpointTypePU
 
@@ -52,10 +52,11 @@ func explode() {
 		var tags policy.TagStore
 		tags.Tags = []string{"&{[k8s-app=kube-dns pod-template-hash=3468831164 @namespace=kube-system AporetoContextID=02f4ebf65b05]}"}
 		flowModel.FlowRecord.Tags = &tags
-		var actype policy.ActionType
-		actype.Accepted()
-		actype.ActionString()
-		flowModel.FlowRecord.Action = actype
+		// Flows without action are quarantined by the collector
+		flowModel.FlowRecord.Action = policy.Accept
+		if i%10 == 0 {
+			flowModel.FlowRecord.Action = policy.Reject
+		}
 		flowModel.FlowRecord.DropReason = "None"
 		flowModel.FlowRecord.PolicyID = "sampleID"
 
@@ -92,6 +92,7 @@ func initTablePanels(grafanaClient grafana.GrafanaManipulator) {
 	grafanaClient.AddPanel(grafana.Table, grafana.FourTupleWithAction, grafana.FlowEvent, FourTupleFields)
 	grafanaClient.AddPanel(grafana.Table, grafana.ContainerEventFields, grafana.ContainerEvent, []string{grafana.AllFields})
 	grafanaClient.AddPanel(grafana.Table, grafana.FlowEventFields, grafana.FlowEvent, []string{grafana.AllFields})
+	grafanaClient.AddPanel(grafana.Table, grafana.AnomalyFields, grafana.AnomalyEvent, []string{"Kind", "Namespace", "Workload", "Description", "Score"})
 	grafanaClient.UploadToDashboard()
 }
 
@@ -99,6 +100,7 @@ func initGraphPanels(grafanaClient grafana.GrafanaManipulator) {
 	grafanaClient.CreateRow("Graph")
 	grafanaClient.AddPanel(grafana.Graph, grafana.ContainerEventsGraph, grafana.ContainerEvent, []string{"ContextID", "IPAddress", "Tags"})
 	grafanaClient.AddPanel(grafana.Graph, grafana.FlowEventsGraph, grafana.FlowEvent, []string{"ContextID", "Tags"})
+	grafanaClient.AddPanel(grafana.Graph, grafana.AnomaliesGraph, grafana.AnomalyEvent, []string{"Score"})
 	grafanaClient.UploadToDashboard()
 }
 
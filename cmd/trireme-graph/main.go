@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,6 +15,9 @@ import (
 
 	"github.com/rs/cors"
 
+	"github.com/aporeto-inc/trireme-statistics/alerting"
+	"github.com/aporeto-inc/trireme-statistics/anomaly"
+	"github.com/aporeto-inc/trireme-statistics/auth"
 	"github.com/aporeto-inc/trireme-statistics/configuration"
 	"github.com/aporeto-inc/trireme-statistics/graph/server"
 	"github.com/aporeto-inc/trireme-statistics/influxdb"
@@ -60,7 +64,7 @@ func main() {
 
 	// serveGraph is blocking
 	go func() {
-		err = serveGraph(influxClient, cfg.ListenAddress, cfg.InfluxDBName, cfg.GraphGenerationInterval)
+		err = serveGraph(influxClient, cfg)
 		if err != nil {
 			zap.L().Fatal("Error: Connecting to GraphServer", zap.Error(err))
 		}
@@ -74,29 +78,183 @@ func main() {
 
 }
 
-func serveGraph(influxClient *influxdb.Influxdb, listenAddress string, dbname string, interval int) error {
+func serveGraph(influxClient *influxdb.Influxdb, cfg *configuration.Configuration) error {
 	mux := http.NewServeMux()
 
-	graphInstance := server.NewGraph(influxClient, dbname)
+	authenticators, err := loadAuthenticators(cfg)
+	if err != nil {
+		return err
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLSClientCAFile != "" {
+		// Client certificates are optional when the clients can authenticate otherwise
+		tlsConfig, err = auth.ServerTLSConfig(cfg.TLSClientCAFile, len(authenticators) == 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts := []server.Option{
+		server.OptionExternalDetail(cfg.GraphExternalDetail, cfg.GraphExternalCIDRPrefix),
+		server.OptionHistoryCache(cfg.GraphHistoryCacheSize, cfg.GraphHistoryCacheTTL),
+	}
+	if cfg.GraphRollupRetention > 0 {
+		opts = append(opts, server.OptionRollups(cfg.GraphRollupRetention))
+	}
+	if cfg.AnomalyDetection {
+		opts = append(opts, server.OptionAnomalyDetector(anomaly.NewDetector(
+			anomaly.OptionLearningPeriod(cfg.AnomalyLearningPeriod),
+			anomaly.OptionSpike(cfg.AnomalySpikeFactor, cfg.AnomalyMinSpike),
+		)))
+	}
+
+	graphInstance := server.NewGraph(influxClient, cfg.InfluxDBName, opts...)
 	// Start generating JSON
-	graphInstance.Start(interval)
+	graphInstance.Start(cfg.GraphGenerationInterval)
 
 	// Default endpoint is the graph
 	mux.HandleFunc("/", graphInstance.GetGraph)
 	mux.HandleFunc("/get", graphInstance.GetData)
 	mux.HandleFunc("/graph", graphInstance.GetGraph)
+	mux.HandleFunc("/rebuild", graphInstance.RebuildGraph)
+	mux.HandleFunc("/diff", graphInstance.GetDiff)
+	mux.HandleFunc("/stream", graphInstance.StreamGraph)
+	mux.HandleFunc("/policies", graphInstance.GetPolicies)
+	mux.HandleFunc("/simulate", graphInstance.SimulatePolicies)
+	mux.HandleFunc("/anomalies", graphInstance.GetAnomalies)
+	mux.HandleFunc("/top", graphInstance.GetTop)
+
+	// The versioned API validates the requests and returns JSON errors
+	api := server.NewAPI(graphInstance)
+	mux.Handle(server.APIPrefix+"/", api)
+
+	if cfg.AlertRulesFile != "" {
+		rules, err := alerting.LoadRulesFile(cfg.AlertRulesFile)
+		if err != nil {
+			return err
+		}
+
+		alertEngine := alerting.NewEngine(rules, influxClient, cfg.InfluxDBName)
+		alertEngine.Start()
+
+		mux.HandleFunc("/alerts", alertEngine.GetAlerts)
+		mux.HandleFunc("/alerts/silences", alertEngine.HandleSilences)
+
+		api.Handle(server.APIRoute{
+			Method:    http.MethodGet,
+			Path:      "/alerts",
+			Summary:   "List the pending and firing alerts",
+			Responses: []string{"application/json"},
+			Handler:   alertEngine.GetAlerts,
+		})
+		api.Handle(server.APIRoute{
+			Method:    http.MethodGet,
+			Path:      "/alerts/silences",
+			Summary:   "List the active silences",
+			Responses: []string{"application/json"},
+			Handler:   alertEngine.HandleSilences,
+		})
+		api.Handle(server.APIRoute{
+			Method:      http.MethodPost,
+			Path:        "/alerts/silences",
+			Summary:     "Silence the alerts matching labels",
+			RequestBody: "application/json",
+			Status:      http.StatusCreated,
+			Responses:   []string{"application/json"},
+			Handler:     alertEngine.HandleSilences,
+		})
+		api.Handle(server.APIRoute{
+			Method:     http.MethodDelete,
+			Path:       "/alerts/silences",
+			Summary:    "Remove a silence",
+			Parameters: []server.APIParameter{{Name: "id", Type: server.ParamString, Description: "ID of the silence", Required: true}},
+			Status:     http.StatusNoContent,
+			Handler:    alertEngine.HandleSilences,
+		})
+	}
+
+	handler := auth.Handler(mux, authenticators...)
+	if len(authenticators) == 0 {
+		zap.L().Warn("Authentication disabled, the graph is served to anyone reaching the server")
+	}
+
+	// Cross-origin requests are only allowed from the configured origins. The
+	// preflight requests are answered before authentication as they carry no credentials.
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		// Any site could read the graph with the basic credentials or the client
+		// certificate of a browser if all origins were allowed with credentials
+		wildcard := false
+		for _, origin := range cfg.CORSAllowedOrigins {
+			wildcard = wildcard || origin == "*"
+		}
+		if wildcard {
+			zap.L().Warn("All origins allowed, cross-origin requests can only authenticate with bearer tokens")
+		}
+
+		handler = cors.New(cors.Options{
+			AllowedOrigins:   cfg.CORSAllowedOrigins,
+			AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+			AllowedHeaders:   []string{"Authorization", "Content-Type"},
+			ExposedHeaders:   []string{"Content-Disposition", "X-Next-Cursor"},
+			AllowCredentials: !wildcard,
+		}).Handler(handler)
+	}
 
-	handler := cors.Default().Handler(mux)
+	httpServer := &http.Server{
+		Addr:      cfg.ListenAddress,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
 
-	err := http.ListenAndServe(listenAddress, handler)
+	if cfg.TLSCertFile != "" {
+		err = httpServer.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
 	if err != nil {
 		return fmt.Errorf("ListenAndServe: %s", err)
 	}
 
-	zap.L().Info("Server Listening at", zap.Any("port", listenAddress))
+	zap.L().Info("Server Listening at", zap.Any("port", cfg.ListenAddress))
 	return nil
 }
 
+// loadAuthenticators returns the authenticators enabled by the configuration
+func loadAuthenticators(cfg *configuration.Configuration) ([]auth.Authenticator, error) {
+
+	var authenticators []auth.Authenticator
+
+	if cfg.TLSClientCAFile != "" {
+		if cfg.TLSCertFile == "" {
+			return nil, fmt.Errorf("Client certificates require TLSCertFile")
+		}
+		authenticators = append(authenticators, &auth.ClientCertificates{})
+	}
+
+	if cfg.AuthTokensFile != "" {
+		tokens, err := auth.LoadTokensFile(cfg.AuthTokensFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, tokens)
+	}
+
+	if cfg.AuthHtpasswdFile != "" {
+		htpasswd, err := auth.LoadHtpasswdFile(cfg.AuthHtpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, htpasswd)
+	}
+
+	if cfg.AuthTokensFile != "" && len(authenticators) == 1 {
+		zap.L().Warn("Only bearer tokens are accepted, the graph page requires basic auth or client certificates")
+	}
+
+	return authenticators, nil
+}
+
 // setLogs setups Zap to log at the specified log level and format
 func setLogs(logFormat, logLevel string) error {
 	var zapConfig zap.Config
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// client queries the trireme-graph server
+type client struct {
+	address    string
+	httpClient *http.Client
+
+	token    string
+	username string
+	password string
+	certFile string
+	keyFile  string
+	caFile   string
+}
+
+// newFlagSet returns the flags of a command with the flags shared by all commands
+func newFlagSet(command string, c *client) *flag.FlagSet {
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.StringVar(&c.address, "address", "http://localhost:8080", "Address of the trireme-graph server")
+	flags.StringVar(&c.token, "token", os.Getenv("TRIREME_GRAPH_TOKEN"), "Bearer token [default: $TRIREME_GRAPH_TOKEN]")
+	flags.StringVar(&c.username, "username", "", "User authenticated with basic auth, the password is read from $TRIREME_GRAPH_PASSWORD")
+	flags.StringVar(&c.certFile, "cert", "", "Client certificate")
+	flags.StringVar(&c.keyFile, "key", "", "Private key of the client certificate")
+	flags.StringVar(&c.caFile, "cacert", "", "CAs verifying the certificate of the server [default: system CAs]")
+	c.password = os.Getenv("TRIREME_GRAPH_PASSWORD")
+
+	return flags
+}
+
+// setup creates the HTTP client once the flags are parsed
+func (c *client) setup() error {
+
+	if c.httpClient != nil {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if c.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return fmt.Errorf("Loading client certificate %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.caFile != "" {
+		data, err := ioutil.ReadFile(c.caFile)
+		if err != nil {
+			return fmt.Errorf("Reading CAs %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("No certificate in %s", c.caFile)
+		}
+	}
+
+	c.httpClient = &http.Client{
+		Timeout:   60 * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}
+
+	return nil
+}
+
+// get requests the given path and returns the body of the response
+func (c *client) get(path string, query url.Values) ([]byte, error) {
+
+	req, err := http.NewRequest(http.MethodGet, c.url(path, query), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Requesting %s %s", path, err)
+	}
+
+	return c.do(path, req)
+}
+
+// post sends the body to the given path and returns the body of the response
+func (c *client) post(path string, query url.Values, contentType string, body []byte) ([]byte, error) {
+
+	req, err := http.NewRequest(http.MethodPost, c.url(path, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("Requesting %s %s", path, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	return c.do(path, req)
+}
+
+func (c *client) url(path string, query url.Values) string {
+
+	address := strings.TrimSuffix(c.address, "/") + path
+	if len(query) > 0 {
+		address = address + "?" + query.Encode()
+	}
+
+	return address
+}
+
+func (c *client) do(path string, req *http.Request) ([]byte, error) {
+
+	if err := c.setup(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Requesting %s %s", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Reading response %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+// getJSON requests the given path and decodes the JSON response into v
+func (c *client) getJSON(path string, query url.Values, v interface{}) error {
+
+	body, err := c.get(path, query)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("Decoding response %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/aporeto-inc/trireme-statistics/graph/server"
+)
+
+func runDiff(args []string) error {
+
+	var c client
+	flags := newFlagSet("diff", &c)
+	beforeStart := flags.String("before-start", "", "Start of the first time window (RFC3339)")
+	beforeEnd := flags.String("before-end", "", "End of the first time window (RFC3339) [default: now]")
+	afterStart := flags.String("after-start", "", "Start of the second time window (RFC3339)")
+	afterEnd := flags.String("after-end", "", "End of the second time window (RFC3339) [default: now]")
+	output := flags.String("output", "text", "Output format (text//json)")
+	flags.Parse(args)
+
+	query := url.Values{}
+	query.Set("beforestart", *beforeStart)
+	query.Set("beforeend", *beforeEnd)
+	query.Set("afterstart", *afterStart)
+	query.Set("afterend", *afterEnd)
+
+	var diff server.GraphDiff
+	if err := c.getJSON("/diff", query, &diff); err != nil {
+		return err
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+
+	names := map[string]string{}
+	for _, node := range diff.Nodes {
+		names[node.ContextID] = node.PodName
+		if node.Diff != "" {
+			fmt.Printf("%-8s node %s (%s)\n", node.Diff, node.PodName, node.ContextID)
+		}
+	}
+
+	for _, link := range diff.Links {
+		switch link.Diff {
+		case server.DiffChanged:
+			fmt.Printf("%-8s link %s -> %s: %s -> %s\n", link.Diff, names[link.Source], names[link.Target], link.PreviousAction, link.Action)
+		case server.DiffAdded, server.DiffRemoved:
+			fmt.Printf("%-8s link %s -> %s: %s\n", link.Diff, names[link.Source], names[link.Target], link.Action)
+		}
+	}
+
+	fmt.Printf("\n%d nodes added, %d nodes removed, %d links added, %d links removed, %d links changed\n",
+		diff.Summary.AddedNodes, diff.Summary.RemovedNodes, diff.Summary.AddedLinks, diff.Summary.RemovedLinks, diff.Summary.ChangedLinks)
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+)
+
+func runExport(args []string) error {
+
+	var c client
+	flags := newFlagSet("export", &c)
+	format := flags.String("format", "graphml", "Export format (json//graphml//dot//gexf//cytoscape)")
+	start := flags.String("start", "", "Start of the time window (RFC3339) [default: live graph]")
+	end := flags.String("end", "", "End of the time window (RFC3339) [default: now]")
+	namespace := flags.String("namespace", "", "Only export the given namespace")
+	selector := flags.String("selector", "", "Only export the nodes matching the label selector")
+	output := flags.StringP("output", "o", "", "File to write the graph to [default: stdout]")
+	flags.Parse(args)
+
+	query := url.Values{}
+	query.Set("format", *format)
+	for param, value := range map[string]string{
+		"starttime": *start,
+		"endtime":   *end,
+		"namespace": *namespace,
+		"selector":  *selector,
+	} {
+		if value != "" {
+			query.Set(param, value)
+		}
+	}
+
+	body, err := c.get("/get", query)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+
+	if err := ioutil.WriteFile(*output, body, 0644); err != nil {
+		return fmt.Errorf("Writing %s %s", *output, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aporeto-inc/trireme-statistics/graph/server"
+)
+
+func runFlows(args []string) error {
+
+	var c client
+	flags := newFlagSet("flows", &c)
+	sourceID := flags.String("source-id", "", "Only show the flows from the given pu")
+	sourceIP := flags.String("source-ip", "", "Only show the flows from the given IP or CIDR")
+	destinationID := flags.String("destination-id", "", "Only show the flows to the given pu")
+	destinationIP := flags.String("destination-ip", "", "Only show the flows to the given IP or CIDR")
+	port := flags.Int("port", 0, "Only show the flows to the given destination port")
+	action := flags.String("action", "", "Only show the accepted or rejected flows (accept//reject)")
+	policy := flags.String("policy", "", "Only show the flows decided by the given policy")
+	namespace := flags.String("namespace", "", "Only show the flows of the given namespace")
+	start := flags.String("start", "", "Start of the time window (RFC3339) [default: one day ago]")
+	end := flags.String("end", "", "End of the time window (RFC3339) [default: now]")
+	sort := flags.String("sort", "-time", "Sort key (time//source//destination//port//action//policy//count), prefixed by - for a descending order")
+	limit := flags.Int("limit", 100, "Number of flows, all the pages are fetched when 0")
+	output := flags.String("output", "text", "Output format (text//json)")
+	flags.Parse(args)
+
+	query := url.Values{}
+	query.Set("sort", *sort)
+	if *port > 0 {
+		query.Set("port", strconv.Itoa(*port))
+	}
+	for param, value := range map[string]string{
+		"sourceid":      *sourceID,
+		"sourceip":      *sourceIP,
+		"destinationid": *destinationID,
+		"destinationip": *destinationIP,
+		"action":        *action,
+		"policy":        *policy,
+		"namespace":     *namespace,
+		"starttime":     *start,
+		"endtime":       *end,
+	} {
+		if value != "" {
+			query.Set(param, value)
+		}
+	}
+
+	pageSize := *limit
+	if pageSize <= 0 || pageSize > 1000 {
+		pageSize = 1000
+	}
+	query.Set("limit", strconv.Itoa(pageSize))
+
+	var flows []server.FlowRecord
+	for {
+		var page server.FlowPage
+		if err := c.getJSON("/api/v1/flows", query, &page); err != nil {
+			return err
+		}
+		flows = append(flows, page.Flows...)
+
+		if page.NextCursor == "" || (*limit > 0 && len(flows) >= *limit) {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	if *limit > 0 && len(flows) > *limit {
+		flows = flows[:*limit]
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(flows)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSOURCE\tDESTINATION\tPORT\tACTION\tPOLICY\tCOUNT")
+	for _, flow := range flows {
+		fmt.Fprintf(w, "%s\t%s (%s)\t%s (%s)\t%d\t%s\t%s\t%d\n", flow.Time.Format(time.RFC3339), flow.SourceID, flow.SourceIP,
+			flow.DestinationID, flow.DestinationIP, flow.DestinationPort, flow.Action, flow.PolicyID, flow.Count)
+	}
+
+	return w.Flush()
+}
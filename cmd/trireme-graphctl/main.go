@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: trireme-graphctl <command> [flags]
+
+Commands:
+  diff      Show the nodes and links that changed between two time windows
+  export    Export the graph as JSON, GraphML, DOT, GEXF or Cytoscape JSON
+  flows     Search the flows by endpoint, port, action, policy and namespace
+  policies  Generate the network policies allowing the flows accepted in a namespace
+  simulate  Show the flows that proposed policies would reject or accept
+  top       Rank the sources, destinations, pairs, ports or policies by flows
+
+Run trireme-graphctl <command> --help for the flags of a command.
+`)
+	os.Exit(2)
+}
+
+func main() {
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "flows":
+		err = runFlows(os.Args[2:])
+	case "policies":
+		err = runPolicies(os.Args[2:])
+	case "simulate":
+		err = runSimulate(os.Args[2:])
+	case "top":
+		err = runTop(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
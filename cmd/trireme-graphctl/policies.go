@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	"github.com/aporeto-inc/trireme-statistics/graph/server"
+	"github.com/aporeto-inc/trireme-statistics/policies"
+)
+
+func runPolicies(args []string) error {
+
+	var c client
+	flags := newFlagSet("policies", &c)
+	namespace := flags.String("namespace", "", "Namespace to generate the policies for")
+	start := flags.String("start", "", "Start of the time window (RFC3339) [default: live graph]")
+	end := flags.String("end", "", "End of the time window (RFC3339) [default: now]")
+	format := flags.String("format", server.PolicyFormatNetworkPolicy, "Policy format (networkpolicy//trireme//json)")
+	output := flags.StringP("output", "o", "", "File to write the policies to [default: stdout]")
+	flags.Parse(args)
+
+	if *namespace == "" {
+		return fmt.Errorf("Missing --namespace")
+	}
+
+	query := url.Values{}
+	query.Set("namespace", *namespace)
+	if *start != "" {
+		query.Set("starttime", *start)
+	}
+	if *end != "" {
+		query.Set("endtime", *end)
+	}
+
+	var result policies.Result
+	if err := c.getJSON("/policies", query, &result); err != nil {
+		return err
+	}
+
+	var data []byte
+	var err error
+	switch *format {
+	case server.PolicyFormatNetworkPolicy:
+		data, err = result.NetworkPoliciesYAML()
+	case server.PolicyFormatTrireme:
+		data, err = result.RuleSetsYAML()
+	case server.PolicyFormatJSON:
+		data, err = json.MarshalIndent(result, "", "  ")
+	default:
+		return fmt.Errorf("Unknown format %s", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+	} else if err = ioutil.WriteFile(*output, data, 0644); err != nil {
+		err = fmt.Errorf("Writing %s %s", *output, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The flows that could not be expressed are reported apart from the policies
+	for _, flow := range result.Unexpressed {
+		fmt.Fprintf(os.Stderr, "Not expressed: %s -> %s:%d (%d flows): %s\n", flow.Source, flow.Destination, flow.Port, flow.Count, flow.Reason)
+	}
+	for _, port := range result.UnknownProtocol {
+		fmt.Fprintf(os.Stderr, "Protocol unknown: port %d is allowed for TCP only\n", port)
+	}
+
+	return nil
+}
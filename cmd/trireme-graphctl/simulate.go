@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aporeto-inc/trireme-statistics/policies"
+)
+
+func runSimulate(args []string) error {
+
+	var c client
+	flags := newFlagSet("simulate", &c)
+	files := flags.StringSliceP("file", "f", nil, "YAML file with the proposed NetworkPolicies or Trireme rule sets (repeatable)")
+	start := flags.String("start", "", "Start of the time window (RFC3339) [default: live graph]")
+	end := flags.String("end", "", "End of the time window (RFC3339) [default: now]")
+	output := flags.String("output", "text", "Output format (text//json)")
+	flags.Parse(args)
+
+	if len(*files) == 0 {
+		return fmt.Errorf("Missing --file")
+	}
+
+	// The files are checked locally so that errors point to the right file
+	var documents []string
+	for _, file := range *files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("Reading %s %s", file, err)
+		}
+		if _, err := policies.ParsePolicies(data); err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		documents = append(documents, string(data))
+	}
+
+	query := url.Values{}
+	if *start != "" {
+		query.Set("starttime", *start)
+	}
+	if *end != "" {
+		query.Set("endtime", *end)
+	}
+
+	body, err := c.post("/simulate", query, "application/yaml", []byte(strings.Join(documents, "\n---\n")))
+	if err != nil {
+		return err
+	}
+
+	var simulation policies.Simulation
+	if err := json.Unmarshal(body, &simulation); err != nil {
+		return fmt.Errorf("Decoding response %s", err)
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(simulation)
+	}
+
+	for _, named := range simulation.Unresolved {
+		fmt.Fprintf(os.Stderr, "Not resolved: %s, it allows no flow\n", named)
+	}
+
+	for _, group := range simulation.Groups {
+		fmt.Printf("%s/%s: %d newly rejected, %d newly accepted\n", group.Namespace, group.Workload, group.NewlyRejected, group.NewlyAccepted)
+		for _, flow := range simulation.Flows {
+			if flow.Namespace == group.Namespace && flow.Workload == group.Workload {
+				fmt.Printf("  %-13s %s -> %s:%d (%d flows): %s\n", flow.Change, flow.Source, flow.Destination, flow.Port, flow.Count, flow.Reason)
+			}
+		}
+	}
+
+	fmt.Printf("\n%d flows evaluated, %d not selected by the policies, %d unchanged, %d newly rejected, %d newly accepted\n",
+		simulation.Summary.Evaluated, simulation.Summary.Unaffected, simulation.Summary.Unchanged, simulation.Summary.NewlyRejected, simulation.Summary.NewlyAccepted)
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/aporeto-inc/trireme-statistics/graph/server"
+)
+
+func runTop(args []string) error {
+
+	var c client
+	flags := newFlagSet("top", &c)
+	by := flags.String("by", server.TopSources, "Ranking (sources//destinations//pairs//ports//policies)")
+	action := flags.String("action", "", "Only rank the accepted or rejected flows (accept//reject)")
+	namespace := flags.String("namespace", "", "Only rank the flows from or to the given namespace")
+	start := flags.String("start", "", "Start of the time window (RFC3339) [default: one hour ago]")
+	end := flags.String("end", "", "End of the time window (RFC3339) [default: now]")
+	limit := flags.Int("limit", 10, "Number of entries")
+	output := flags.String("output", "text", "Output format (text//json)")
+	flags.Parse(args)
+
+	query := url.Values{}
+	query.Set("by", *by)
+	query.Set("limit", strconv.Itoa(*limit))
+	for param, value := range map[string]string{
+		"action":    *action,
+		"namespace": *namespace,
+		"starttime": *start,
+		"endtime":   *end,
+	} {
+		if value != "" {
+			query.Set(param, value)
+		}
+	}
+
+	var result server.TopResult
+	if err := c.getJSON("/top", query, &result); err != nil {
+		return err
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tENTRY\tFLOWS\tACCEPTED\tREJECTED")
+	for i, entry := range result.Entries {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\n", i+1, topEntryName(entry), entry.FlowCount, entry.AcceptedCount, entry.RejectedCount)
+	}
+
+	return w.Flush()
+}
+
+func topEntryName(entry server.TopEntry) string {
+
+	switch {
+	case entry.Source != nil && entry.Destination != nil:
+		return topEndpointName(entry.Source) + " -> " + topEndpointName(entry.Destination)
+	case entry.Source != nil:
+		return topEndpointName(entry.Source)
+	case entry.Destination != nil:
+		return topEndpointName(entry.Destination)
+	case entry.Port > 0:
+		return strconv.Itoa(entry.Port)
+	case entry.PolicyID != "":
+		return entry.PolicyID
+	default:
+		return "(no policy)"
+	}
+}
+
+func topEndpointName(endpoint *server.TopEndpoint) string {
+
+	if endpoint.Namespace == "" {
+		return endpoint.Name
+	}
+
+	return endpoint.Namespace + "/" + endpoint.Name
+}
@@ -3,6 +3,7 @@ package configuration
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -25,6 +26,25 @@ type Configuration struct {
 	GrafanaDBAccess string
 
 	GraphGenerationInterval int
+	GraphExternalDetail     string
+	GraphExternalCIDRPrefix int
+	GraphHistoryCacheSize   int
+	GraphHistoryCacheTTL    time.Duration
+	GraphRollupRetention    time.Duration
+
+	AnomalyDetection      bool
+	AnomalyLearningPeriod time.Duration
+	AnomalySpikeFactor    float64
+	AnomalyMinSpike       int
+
+	AlertRulesFile string
+
+	AuthTokensFile     string
+	AuthHtpasswdFile   string
+	TLSCertFile        string
+	TLSKeyFile         string
+	TLSClientCAFile    string
+	CORSAllowedOrigins []string
 
 	LogFormat string
 	LogLevel  string
@@ -54,6 +74,25 @@ func LoadConfiguration() (*Configuration, error) {
 	flag.String("GrafanaDBAccess", "", "Access to connect to DB [default: proxy]")
 
 	flag.Int("GraphGenerationInterval", 20, "Time interval between transformation [default: 20s]")
+	flag.String("GraphExternalDetail", "", "Grouping of external endpoints in the graph (ip//cidr//fqdn//world) [default: cidr]")
+	flag.Int("GraphExternalCIDRPrefix", 24, "Prefix length used to group external IPv4 endpoints by CIDR [default: 24]")
+	flag.Int("GraphHistoryCacheSize", 32, "Number of graphs built for past time windows kept in cache [default: 32]")
+	flag.Duration("GraphHistoryCacheTTL", 5*time.Minute, "Time a graph built for a past time window is cached [default: 5m]")
+	flag.Duration("GraphRollupRetention", 24*time.Hour, "Time the flows are kept aggregated per minute for the rankings, 0 to disable [default: 24h]")
+
+	flag.Bool("AnomalyDetection", true, "Score the flows against the baseline of their workloads [default: true]")
+	flag.Duration("AnomalyLearningPeriod", 24*time.Hour, "Time the flows of a new workload are learned before being scored [default: 24h]")
+	flag.Float64("AnomalySpikeFactor", 3, "Factor of the usual hourly rate of flows reported as a spike [default: 3]")
+	flag.Int("AnomalyMinSpike", 10, "Minimum number of flows in an hour reported as a spike [default: 10]")
+
+	flag.String("AlertRulesFile", "", "YAML file of the alert rules, alerting is disabled when empty [default: none]")
+
+	flag.String("AuthTokensFile", "", "File of the bearer tokens accepted, one token,user per line [default: none]")
+	flag.String("AuthHtpasswdFile", "", "Htpasswd file of the users accepted with basic auth [default: none]")
+	flag.String("TLSCertFile", "", "Certificate of the server, TLS is disabled when empty [default: none]")
+	flag.String("TLSKeyFile", "", "Private key of the server certificate [default: none]")
+	flag.String("TLSClientCAFile", "", "CAs of the client certificates accepted, requires TLS [default: none]")
+	flag.StringSlice("CORSAllowedOrigins", nil, "Origins allowed to make cross-origin requests, * for all [default: none]")
 
 	// Setting up default configuration
 	viper.SetDefault("ListenAddress", ":8080")
@@ -72,6 +111,16 @@ func LoadConfiguration() (*Configuration, error) {
 	viper.SetDefault("GrafanaDBAccess", "proxy")
 
 	viper.SetDefault("GraphGenerationInterval", 20)
+	viper.SetDefault("GraphExternalDetail", "cidr")
+	viper.SetDefault("GraphExternalCIDRPrefix", 24)
+	viper.SetDefault("GraphHistoryCacheSize", 32)
+	viper.SetDefault("GraphHistoryCacheTTL", 5*time.Minute)
+	viper.SetDefault("GraphRollupRetention", 24*time.Hour)
+
+	viper.SetDefault("AnomalyDetection", true)
+	viper.SetDefault("AnomalyLearningPeriod", 24*time.Hour)
+	viper.SetDefault("AnomalySpikeFactor", 3)
+	viper.SetDefault("AnomalyMinSpike", 10)
 
 	// Binding ENV variables
 	// Each config will be of format TRIREME_XYZ as env variable, where XYZ
@@ -29,6 +29,10 @@ const (
 	ContainerEventsGraph = "ContainerEventsGraph"
 	// FlowEventsGraph - Title for Graph flowevents panel
 	FlowEventsGraph = "FlowEventsGraph"
+	// AnomaliesGraph - Title for Graph anomalies panel
+	AnomaliesGraph = "AnomaliesGraph"
+	// AnomalyFields - Title for Table anomalies panel
+	AnomalyFields = "AnomalyFields"
 	// AllFields - To retrieve all the fields from DB
 	AllFields = "*"
 )
@@ -43,6 +47,8 @@ const (
 	ContainerEvent = "ContainerEvents"
 	// FlowEvent is the Flow events measurement name
 	FlowEvent = "FlowEvents"
+	// AnomalyEvent is the Anomalies measurement name
+	AnomalyEvent = "Anomalies"
 )
 
 const (
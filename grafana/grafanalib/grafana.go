@@ -161,6 +161,8 @@ func (g *Grafana) generateGraphPanel(measurement string, paneltitle string, fiel
 		g.CreateTarget(FlowEvent, fields, Count)
 	case ContainerEvent:
 		g.CreateTarget(ContainerEvent, fields, Count)
+	case AnomalyEvent:
+		g.CreateTarget(AnomalyEvent, fields, Count)
 	}
 }
 
@@ -205,6 +207,8 @@ func (g *Grafana) generateTablePanel(measurement string, paneltitle string, fiel
 		target.Measurement = FlowEvent
 	case ContainerEvent:
 		target.Measurement = ContainerEvent
+	case AnomalyEvent:
+		target.Measurement = AnomalyEvent
 	}
 
 	selectCollection := g.ConstructSelectQueriesFromFields(fields, DefaultSelectAttribute())
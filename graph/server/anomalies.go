@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	client "github.com/influxdata/influxdb/client/v2"
+	"go.uber.org/zap"
+
+	"github.com/aporeto-inc/trireme-statistics/anomaly"
+	"github.com/aporeto-inc/trireme-statistics/influxdb"
+)
+
+// anomalyEndpoint returns the workload of a node of the graph
+func (g *Graph) anomalyEndpoint(nodeID string, id string, ip string) anomaly.Endpoint {
+
+	if node, ok := g.nodeMap[getHash(id, ip)]; ok {
+		return nodeWorkload(node)
+	}
+
+	name := nodeID
+	if node, ok := g.externalMap[nodeID]; ok {
+		name = node.PodName
+	}
+
+	return anomaly.Endpoint{Workload: name, External: true}
+}
+
+func nodeWorkload(node *Node) anomaly.Endpoint {
+
+	workload := podWorkload(node)
+	if workload == "" {
+		workload = node.ContextID
+	}
+
+	return anomaly.Endpoint{Namespace: node.Namespace, Workload: workload}
+}
+
+// scoreFlow scores the flow against the baseline of its workloads and stores the anomalies
+func (g *Graph) scoreFlow(flowAttr *FlowEvents, srcNode string, dstNode string, timestamp time.Time) {
+
+	g.anomalyTime = timestamp
+
+	anomalies := g.detector.Observe(anomaly.Flow{
+		Time:        timestamp,
+		Source:      g.anomalyEndpoint(srcNode, flowAttr.srcID, flowAttr.srcIP),
+		Destination: g.anomalyEndpoint(dstNode, flowAttr.dstID, flowAttr.dstIP),
+		Port:        flowAttr.dstPort,
+		Count:       flowAttr.counter,
+		Rejected:    flowAttr.action == FlowReject,
+	})
+
+	for _, a := range anomalies {
+		zap.L().Info("Anomaly detected", zap.String("kind", a.Kind), zap.String("description", a.Description))
+
+		tags := map[string]string{
+			influxdb.EventName: AnomalyEvent,
+			"Kind":             a.Kind,
+			"Namespace":        a.Namespace,
+			"Workload":         a.Workload,
+		}
+		fields := map[string]interface{}{
+			"Peer":        a.Peer,
+			"Port":        a.Port,
+			"Observed":    a.Observed,
+			"Expected":    a.Expected,
+			"Score":       a.Score,
+			"Description": a.Description,
+			"FlowTime":    a.Time.UTC().Format(time.RFC3339Nano),
+		}
+
+		if err := g.httpClient.AddData(tags, fields); err != nil {
+			zap.L().Error("Storing anomaly", zap.Error(err))
+		}
+	}
+}
+
+// recentAnomalies returns the descriptions of the recent anomalies of the workload of the pu
+func (g *Graph) recentAnomalies(node *Node) []string {
+
+	var descriptions []string
+	for _, a := range g.detector.Recent(nodeWorkload(node), time.Now().Add(-anomalyDisplayWindow)) {
+		descriptions = append(descriptions, a.Description)
+	}
+
+	return descriptions
+}
+
+// GetAnomalies is the handler returning the anomalies stored between starttime and
+// endtime, the last day by default, optionally of a namespace, workload or kind
+func (g *Graph) GetAnomalies(w http.ResponseWriter, r *http.Request) {
+
+	window, err := parseWindow(r, "starttime", "endtime")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if window[1].IsZero() {
+		window[1] = time.Now()
+	}
+	if window[0].IsZero() {
+		window[0] = window[1].Add(-defaultAnomalyWindow)
+	}
+
+	res, err := g.executeQuery(windowQuery(AnomaliesQuery, window[0], window[1]))
+	if err != nil {
+		zap.L().Error("Retrieving anomalies", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	anomalies, err := parseAnomalies(res.Results)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	workload := r.URL.Query().Get("workload")
+	kind := r.URL.Query().Get("kind")
+
+	filtered := []anomaly.Anomaly{}
+	for _, a := range anomalies {
+		if (namespace == "" || a.Namespace == namespace) && (workload == "" || a.Workload == workload) && (kind == "" || a.Kind == kind) {
+			filtered = append(filtered, a)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(filtered); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// parseAnomalies returns the anomalies of the results of a query on the Anomalies measurement
+func parseAnomalies(results []client.Result) ([]anomaly.Anomaly, error) {
+
+	var anomalies []anomaly.Anomaly
+	if len(results) == 0 || len(results[0].Series) == 0 {
+		return anomalies, nil
+	}
+
+	series := results[0].Series[0]
+	columns := newColumnIndex(series.Columns)
+	for _, row := range series.Values {
+		timestamp := toString(columns.value(row, "FlowTime", -1))
+		if timestamp == "" {
+			timestamp = toString(columns.value(row, "time", 0))
+		}
+		parsedTime, err := time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing Time %s", err)
+		}
+
+		anomalies = append(anomalies, anomaly.Anomaly{
+			Time:        parsedTime,
+			Kind:        toString(columns.value(row, "Kind", -1)),
+			Namespace:   toString(columns.value(row, "Namespace", -1)),
+			Workload:    toString(columns.value(row, "Workload", -1)),
+			Peer:        toString(columns.value(row, "Peer", -1)),
+			Port:        toInt(columns.value(row, "Port", -1)),
+			Observed:    toFloat(columns.value(row, "Observed", -1)),
+			Expected:    toFloat(columns.value(row, "Expected", -1)),
+			Score:       toFloat(columns.value(row, "Score", -1)),
+			Description: toString(columns.value(row, "Description", -1)),
+		})
+	}
+
+	return anomalies, nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme-statistics/anomaly"
+	"github.com/aporeto-inc/trireme-statistics/influxdb/mock"
+	gomock "github.com/golang/mock/gomock"
+	client "github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScoreFlows(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create a graph scoring the flows", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB", OptionAnomalyDetector(anomaly.NewDetector(anomaly.OptionLearningPeriod(0))))
+
+		Convey("Given a workload talks to a new peer on a new port", func() {
+			testContainerResponse := getSampleInlfuxDBResponse(ContainerEvent)
+			testFlowResponse := getSampleInlfuxDBResponse(FlowEvent)
+			testFlowResponse.Results[0].Series[0].Values[0][FlowTimestampIndex] = time.Now().Add(time.Second).UTC().Format(time.RFC3339Nano)
+
+			var stored []map[string]string
+			mockDataAdder.EXPECT().ExecuteQuery(FlowEventsQuery, "testDB").Return(&testFlowResponse, nil).Times(1)
+			mockDataAdder.EXPECT().AddData(gomock.Any(), gomock.Any()).Do(func(tags map[string]string, fields map[string]interface{}) {
+				stored = append(stored, tags)
+			}).Return(nil).Times(2)
+
+			graphData, err := newTestGraph.transform(&testContainerResponse)
+
+			Convey("Then the anomalies should be stored and shown on the nodes", func() {
+				So(err, ShouldBeNil)
+				So(len(stored), ShouldEqual, 2)
+				So(stored[0]["EventName"], ShouldEqual, AnomalyEvent)
+				So(stored[0]["Kind"], ShouldEqual, anomaly.KindNewPeer)
+				So(stored[0]["Workload"], ShouldEqual, "aporeto-collector")
+				So(stored[1]["Kind"], ShouldEqual, anomaly.KindNewPort)
+				So(stored[1]["Workload"], ShouldEqual, "aporeto-influxdb")
+
+				for _, node := range graphData.Nodes {
+					So(len(node.Anomalies), ShouldEqual, 1)
+				}
+			})
+
+			Convey("Then the flows replayed after a rebuild should not be scored again", func() {
+				newTestGraph.clearDataStores()
+				mockDataAdder.EXPECT().ExecuteQuery(FlowEventsQuery, "testDB").Return(&testFlowResponse, nil).Times(1)
+				_, err := newTestGraph.transform(&testContainerResponse)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestGetAnomalies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create a new graph instance", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB")
+
+		Convey("Given I request the anomalies of a workload", func() {
+			response := &client.Response{Results: []client.Result{{Series: []models.Row{{
+				Name:    AnomalyEvent,
+				Columns: []string{"time", "Description", "EventName", "Expected", "FlowTime", "Kind", "Namespace", "Observed", "Peer", "Port", "Score", "Workload"},
+				Values: [][]interface{}{
+					{"2017-11-08T06:30:01Z", "web had 40 rejected flows this hour, usually 2.0", AnomalyEvent, json.Number("2"), "2017-11-08T06:30:00Z", anomaly.KindRejectSpike, "default", json.Number("40"), "", nil, json.Number("20"), "web"},
+					{"2017-11-08T06:40:01Z", "db was reached on port 22 for the first time, from default/web", AnomalyEvent, nil, "2017-11-08T06:40:00Z", anomaly.KindNewPort, "default", nil, "default/web", json.Number("22"), json.Number("1"), "db"},
+				},
+			}}}}}
+			mockDataAdder.EXPECT().ExecuteQuery(AnomaliesQuery+" WHERE time >= '2017-11-08T06:00:00Z' AND time <= '2017-11-08T07:00:00Z'", "testDB").Return(response, nil).Times(1)
+
+			w := httptest.NewRecorder()
+			newTestGraph.GetAnomalies(w, httptest.NewRequest("GET", "/anomalies?starttime=2017-11-08T06:00:00Z&endtime=2017-11-08T07:00:00Z&workload=web", nil))
+
+			Convey("Then I should get the anomalies of the workload", func() {
+				var anomalies []anomaly.Anomaly
+				So(json.NewDecoder(w.Body).Decode(&anomalies), ShouldBeNil)
+				So(len(anomalies), ShouldEqual, 1)
+				So(anomalies[0].Kind, ShouldEqual, anomaly.KindRejectSpike)
+				So(anomalies[0].Observed, ShouldEqual, 40)
+				So(anomalies[0].Score, ShouldEqual, 20)
+				So(anomalies[0].Time.Format(time.RFC3339), ShouldEqual, "2017-11-08T06:30:00Z")
+			})
+		})
+	})
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// APIPrefix is the path of the versioned API
+const APIPrefix = "/api/v1"
+
+// Types of the API parameters
+const (
+	ParamString   = "string"
+	ParamInteger  = "integer"
+	ParamBoolean  = "boolean"
+	ParamDateTime = "date-time"
+)
+
+// APIRoute is an endpoint of the versioned API
+type APIRoute struct {
+	Method  string
+	Path    string
+	Summary string
+	// Parameters are the query parameters accepted by the endpoint, others are rejected
+	Parameters []APIParameter
+	// RequestBody is the content type of the body, empty for endpoints without body
+	RequestBody string
+	// Status is the status of the successful responses, 200 by default
+	Status int
+	// Responses are the content types of the successful responses
+	Responses []string
+	Handler   http.HandlerFunc
+}
+
+// APIParameter is a query parameter of an endpoint
+type APIParameter struct {
+	Name        string
+	Type        string
+	Description string
+	Enum        []string
+	Required    bool
+	// Repeated parameters can be given several times
+	Repeated bool
+}
+
+// APIError is the body of the error responses of the API
+type APIError struct {
+	Status  int    `json:"status"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// API routes the requests of the versioned API. It validates the method and the
+// query parameters of the requests against the routes before calling their handler,
+// and returns the errors as JSON.
+type API struct {
+	routes map[string]map[string]*APIRoute
+}
+
+// NewAPI returns the versioned API of the graph
+func NewAPI(g *Graph) *API {
+
+	a := &API{routes: make(map[string]map[string]*APIRoute)}
+	for _, route := range graphRoutes(g) {
+		a.Handle(route)
+	}
+
+	a.Handle(APIRoute{
+		Method:    http.MethodGet,
+		Path:      "/openapi.json",
+		Summary:   "Get the OpenAPI document of the API",
+		Responses: []string{"application/json"},
+		Handler:   a.GetOpenAPI,
+	})
+
+	return a
+}
+
+// Handle adds a route to the API. The path is relative to the API prefix.
+func (a *API) Handle(route APIRoute) {
+
+	if route.Status == 0 {
+		route.Status = http.StatusOK
+	}
+
+	if _, ok := a.routes[route.Path]; !ok {
+		a.routes[route.Path] = make(map[string]*APIRoute)
+	}
+	a.routes[route.Path][route.Method] = &route
+}
+
+// ServeHTTP serves the requests of the API
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	methods, ok := a.routes[strings.TrimPrefix(r.URL.Path, APIPrefix)]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Unknown endpoint "+r.URL.Path)
+		return
+	}
+
+	route, ok := methods[r.Method]
+	if !ok {
+		var allowed []string
+		for method := range methods {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s requires %s", r.URL.Path, strings.Join(allowed, " or ")))
+		return
+	}
+
+	if err := route.validate(r); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ew := &apiResponseWriter{ResponseWriter: w}
+	route.Handler(ew, r)
+	ew.finish()
+}
+
+// validate checks the query parameters of the request
+func (route *APIRoute) validate(r *http.Request) error {
+
+	query := r.URL.Query()
+
+	params := map[string]*APIParameter{}
+	for i := range route.Parameters {
+		p := &route.Parameters[i]
+		params[p.Name] = p
+		if p.Required && query.Get(p.Name) == "" {
+			return fmt.Errorf("Missing parameter %s", p.Name)
+		}
+	}
+
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p, ok := params[name]
+		if !ok {
+			return fmt.Errorf("Unknown parameter %s", name)
+		}
+		if len(query[name]) > 1 && !p.Repeated {
+			return fmt.Errorf("Parameter %s given more than once", name)
+		}
+		for _, value := range query[name] {
+			if err := p.validate(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validate checks the value of the parameter. Empty values are ignored by the handlers.
+func (p *APIParameter) validate(value string) error {
+
+	if value == "" {
+		return nil
+	}
+
+	var err error
+	switch p.Type {
+	case ParamInteger:
+		_, err = strconv.Atoi(value)
+	case ParamBoolean:
+		_, err = strconv.ParseBool(value)
+	case ParamDateTime:
+		_, err = parseTimeParam(value)
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid %s %s for parameter %s", p.Type, value, p.Name)
+	}
+
+	if len(p.Enum) == 0 {
+		return nil
+	}
+	for _, allowed := range p.Enum {
+		if value == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Invalid value %s for parameter %s, must be one of %s", value, p.Name, strings.Join(p.Enum, ", "))
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(APIError{
+		Status:  status,
+		Error:   http.StatusText(status),
+		Message: message,
+	})
+	if err != nil {
+		zap.L().Debug("Writing API error", zap.Error(err))
+	}
+}
+
+// apiResponseWriter turns the plain text errors written by the handlers with
+// http.Error into JSON errors
+type apiResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	message bytes.Buffer
+}
+
+func (w *apiResponseWriter) WriteHeader(status int) {
+
+	if status >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.status = status
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *apiResponseWriter) Write(data []byte) (int, error) {
+
+	if w.status != 0 {
+		return w.message.Write(data)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush lets the handlers stream their response
+func (w *apiResponseWriter) Flush() {
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && w.status == 0 {
+		flusher.Flush()
+	}
+}
+
+// finish writes the error captured from the handler
+func (w *apiResponseWriter) finish() {
+
+	if w.status != 0 {
+		writeAPIError(w.ResponseWriter, w.status, strings.TrimSpace(w.message.String()))
+	}
+}
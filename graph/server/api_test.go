@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aporeto-inc/trireme-statistics/influxdb/mock"
+	gomock "github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create the API of a graph", t, func() {
+		api := NewAPI(NewGraph(mockDataAdder, "testDB"))
+
+		serve := func(method, target string) (*httptest.ResponseRecorder, APIError) {
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, httptest.NewRequest(method, APIPrefix+target, nil))
+
+			var apiError APIError
+			if w.Code >= http.StatusBadRequest {
+				So(json.Unmarshal(w.Body.Bytes(), &apiError), ShouldBeNil)
+			}
+			return w, apiError
+		}
+
+		Convey("When I request an unknown endpoint", func() {
+			w, apiError := serve("GET", "/nodes")
+
+			Convey("Then I should get a JSON not found error", func() {
+				So(w.Code, ShouldEqual, 404)
+				So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+				So(apiError.Status, ShouldEqual, 404)
+				So(apiError.Error, ShouldEqual, "Not Found")
+			})
+		})
+
+		Convey("When I use a method the endpoint does not allow", func() {
+			w, apiError := serve("GET", "/graph/rebuild")
+
+			Convey("Then I should get the allowed methods", func() {
+				So(w.Code, ShouldEqual, 405)
+				So(w.Header().Get("Allow"), ShouldEqual, "POST")
+				So(apiError.Status, ShouldEqual, 405)
+			})
+		})
+
+		Convey("When I give invalid parameters", func() {
+			Convey("Then I should get a JSON bad request error explaining it", func() {
+				_, apiError := serve("GET", "/graph?size=10")
+				So(apiError.Status, ShouldEqual, 400)
+				So(apiError.Message, ShouldEqual, "Unknown parameter size")
+
+				_, apiError = serve("GET", "/graph?starttime=yesterday")
+				So(apiError.Status, ShouldEqual, 400)
+				So(apiError.Message, ShouldEqual, "Invalid date-time yesterday for parameter starttime")
+
+				_, apiError = serve("GET", "/top?limit=ten")
+				So(apiError.Message, ShouldEqual, "Invalid integer ten for parameter limit")
+
+				_, apiError = serve("GET", "/flows?sort=size")
+				So(apiError.Status, ShouldEqual, 400)
+
+				_, apiError = serve("GET", "/policies")
+				So(apiError.Message, ShouldEqual, "Missing parameter namespace")
+
+				_, apiError = serve("GET", "/graph?format=json&format=dot")
+				So(apiError.Message, ShouldEqual, "Parameter format given more than once")
+			})
+		})
+
+		Convey("When a handler fails", func() {
+			w, apiError := serve("GET", "/graph?starttime=2017-11-08T07:00:00Z&endtime=2017-11-08T06:00:00Z")
+
+			Convey("Then its error should be returned as JSON", func() {
+				So(w.Code, ShouldEqual, 400)
+				So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+				So(apiError.Message, ShouldNotBeEmpty)
+			})
+		})
+
+		Convey("When I request the OpenAPI document", func() {
+			w, _ := serve("GET", "/openapi.json")
+
+			var document struct {
+				OpenAPI string                                       `json:"openapi"`
+				Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+			}
+			So(json.Unmarshal(w.Body.Bytes(), &document), ShouldBeNil)
+
+			Convey("Then it should describe every endpoint", func() {
+				So(w.Code, ShouldEqual, 200)
+				So(document.OpenAPI, ShouldEqual, "3.0.0")
+				for path, methods := range api.routes {
+					for method := range methods {
+						So(document.Paths[path], ShouldContainKey, map[string]string{"GET": "get", "POST": "post"}[method])
+					}
+				}
+				So(document.Paths["/graph/rebuild"]["post"]["responses"], ShouldContainKey, "202")
+			})
+		})
+	})
+}
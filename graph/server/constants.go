@@ -1,6 +1,60 @@
 package server
 
-const defaultGraphDataAddress = "/get"
+import "time"
+
+const (
+	defaultGraphDataAddress = "/get"
+	defaultDiffAddress      = "/diff"
+	defaultStreamAddress    = "/stream"
+	defaultSimulateAddress  = "/simulate"
+	defaultAnomaliesAddress = "/anomalies"
+)
+
+const (
+	streamBufferSize        = 16
+	streamKeepaliveInterval = 15 * time.Second
+)
+
+// userLabelPrefix is the prefix of the user labels in the container tags
+const userLabelPrefix = "@usr:"
+
+// createdByLabel is the label of the annotation referencing the controller of a pod
+const createdByLabel = "annotation.kubernetes.io/created-by"
+
+const (
+	// AnomaliesQuery is the query used to retrieve Anomalies from database
+	AnomaliesQuery = "SELECT * FROM Anomalies"
+	// anomalyDisplayWindow is how long the anomalies of a workload are shown on its nodes
+	anomalyDisplayWindow = time.Hour
+	// defaultAnomalyWindow is the time window of the anomalies returned without start time
+	defaultAnomalyWindow = 24 * time.Hour
+)
+
+const (
+	// defaultTopWindow is the time window of the rankings requested without start time
+	defaultTopWindow = time.Hour
+	defaultTopLimit  = 10
+	maxTopLimit      = 1000
+)
+
+const (
+	// defaultFlowWindow is the time window of the flows searched without start time
+	defaultFlowWindow = 24 * time.Hour
+	defaultFlowLimit  = 100
+	maxFlowLimit      = 1000
+	// maxFlowScan is the maximum number of flows read from influxdb for a page
+	maxFlowScan = 100000
+)
+
+// ingestLag is how far behind the latest applied event each generation reads the
+// events again, so that the events written late or stamped by a host with a late
+// clock are still applied
+const ingestLag = time.Minute
+
+const (
+	defaultHistoryCacheSize = 32
+	defaultHistoryCacheTTL  = 5 * time.Minute
+)
 
 const (
 	// ContainerEventsQuery is the query used to retrieve ContainerEvents from database
@@ -34,11 +88,25 @@ const (
 	UnknownContainerDelete = "unknowncontainer"
 )
 
+const (
+	// endpointTypeUnknown is the type of the endpoints of the flows written without type
+	endpointTypeUnknown = iota
+	// endpointTypePU is the type of the pu endpoints
+	endpointTypePU
+	// endpointTypeExternal is the type of the endpoints that are not pus
+	endpointTypeExternal
+)
+
+// endpointTypePUName is the type of the pu endpoints in the flows written with the type name
+const endpointTypePUName = "pu"
+
 const (
 	// ContainerEvent is the Container events measurement name
 	ContainerEvent = "ContainerEvents"
 	// FlowEvent is the Flow events measurement name
 	FlowEvent = "FlowEvents"
+	// AnomalyEvent is the Anomalies measurement name
+	AnomalyEvent = "Anomalies"
 )
 
 const (
@@ -78,4 +146,59 @@ const (
 	FlowActionIndex = 1
 	// FlowTagsIndex from influxdb response
 	FlowTagsIndex = 16
+	// FlowDestinationPortIndex from influxdb response
+	FlowDestinationPortIndex = 6
+	// FlowCounterIndex from influxdb response
+	FlowCounterIndex = 3
+)
+
+const (
+	// NodeTypePU is the type of the nodes representing a processing unit
+	NodeTypePU = "pu"
+	// NodeTypeExternal is the type of the nodes representing endpoints outside of Trireme
+	NodeTypeExternal = "external"
+	// externalNodePrefix is prepended to the ID of external nodes
+	externalNodePrefix = "ext:"
+	// worldNode is the name of the node grouping all external endpoints
+	worldNode = "world"
+)
+
+const (
+	// ExternalDetailIP shows one node per external ip address
+	ExternalDetailIP = "ip"
+	// ExternalDetailCIDR groups external endpoints by CIDR label or network prefix
+	ExternalDetailCIDR = "cidr"
+	// ExternalDetailFQDN groups external endpoints by hostname, falling back to CIDR
+	ExternalDetailFQDN = "fqdn"
+	// ExternalDetailWorld groups all external endpoints in a single node
+	ExternalDetailWorld = "world"
+
+	defaultExternalDetail     = ExternalDetailCIDR
+	defaultExternalCIDRPrefix = 24
+)
+
+const (
+	// DiffAdded marks the nodes and links only found in the second graph of a diff
+	DiffAdded = "added"
+	// DiffRemoved marks the nodes and links only found in the first graph of a diff
+	DiffRemoved = "removed"
+	// DiffChanged marks the links whose action changed between the graphs of a diff
+	DiffChanged = "changed"
+)
+
+const (
+	// GroupByNamespace collapses the pus of a namespace into one node
+	GroupByNamespace = "namespace"
+	// GroupByWorkload collapses the pus of a workload, named after its pods, into one node
+	GroupByWorkload = "workload"
+	// GroupByApp collapses the pus with the same app label into one node
+	GroupByApp = "app"
+
+	// NodeTypeGroup is the type of the nodes grouping pus
+	NodeTypeGroup = "group"
+
+	groupNodePrefix = "group:"
+
+	// podSuffixAlphabet holds the characters used by Kubernetes for generated name suffixes
+	podSuffixAlphabet = "bcdfghjklmnpqrstvwxz2456789"
 )
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// GraphDiff holds the union of the nodes and links of two graphs, each marked
+// with how it changed from the first graph to the second
+type GraphDiff struct {
+	Nodes   []Node      `json:"nodes"`
+	Links   []Link      `json:"links"`
+	Summary DiffSummary `json:"summary"`
+}
+
+// DiffSummary counts the differences between two graphs
+type DiffSummary struct {
+	AddedNodes   int `json:"addedNodes"`
+	RemovedNodes int `json:"removedNodes"`
+	AddedLinks   int `json:"addedLinks"`
+	RemovedLinks int `json:"removedLinks"`
+	ChangedLinks int `json:"changedLinks"`
+}
+
+// DiffGraphs compares two graphs. Links are identified by their source and target
+// and are changed when their action differs.
+func DiffGraphs(before *GraphData, after *GraphData) *GraphDiff {
+
+	diff := &GraphDiff{Nodes: []Node{}, Links: []Link{}}
+
+	beforeNodes := map[string]bool{}
+	for _, node := range before.Nodes {
+		beforeNodes[node.ContextID] = true
+	}
+
+	afterNodes := map[string]bool{}
+	for _, node := range after.Nodes {
+		afterNodes[node.ContextID] = true
+		if !beforeNodes[node.ContextID] {
+			node.Diff = DiffAdded
+			diff.Summary.AddedNodes++
+		}
+		diff.Nodes = append(diff.Nodes, node)
+	}
+
+	for _, node := range before.Nodes {
+		if !afterNodes[node.ContextID] {
+			node.Diff = DiffRemoved
+			diff.Summary.RemovedNodes++
+			diff.Nodes = append(diff.Nodes, node)
+		}
+	}
+
+	beforeLinks := map[LinkID]Link{}
+	for _, link := range before.Links {
+		beforeLinks[link.id()] = link
+	}
+
+	afterLinks := map[LinkID]bool{}
+	for _, link := range after.Links {
+		afterLinks[link.id()] = true
+		previous, ok := beforeLinks[link.id()]
+		switch {
+		case !ok:
+			link.Diff = DiffAdded
+			diff.Summary.AddedLinks++
+		case previous.Action != link.Action:
+			link.Diff = DiffChanged
+			link.PreviousAction = previous.Action
+			diff.Summary.ChangedLinks++
+		}
+		diff.Links = append(diff.Links, link)
+	}
+
+	for _, link := range before.Links {
+		if !afterLinks[link.id()] {
+			link.Diff = DiffRemoved
+			diff.Summary.RemovedLinks++
+			diff.Links = append(diff.Links, link)
+		}
+	}
+
+	return diff
+}
+
+// GetDiff is the handler comparing the graphs of two time windows given by
+// beforestart, beforeend, afterstart and afterend. A missing end is now.
+func (g *Graph) GetDiff(w http.ResponseWriter, r *http.Request) {
+
+	beforeWindow, err := parseWindow(r, "beforestart", "beforeend")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	afterWindow, err := parseWindow(r, "afterstart", "afterend")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	windows := [4]time.Time{beforeWindow[0], beforeWindow[1], afterWindow[0], afterWindow[1]}
+
+	before, err := g.historicalGraph(windows[0], windows[1])
+	if err != nil {
+		zap.L().Error("Building graph for time window", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	after, err := g.historicalGraph(windows[2], windows[3])
+	if err != nil {
+		zap.L().Error("Building graph for time window", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(DiffGraphs(before, after))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,438 @@
+package server
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats of the graph
+const (
+	FormatJSON      = "json"
+	FormatGraphML   = "graphml"
+	FormatDOT       = "dot"
+	FormatGEXF      = "gexf"
+	FormatCytoscape = "cytoscape"
+)
+
+// exportFormats holds the content type and file extension of the export formats
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	FormatJSON:      {"application/json", "json"},
+	FormatGraphML:   {"application/graphml+xml", "graphml"},
+	FormatDOT:       {"text/vnd.graphviz", "dot"},
+	FormatGEXF:      {"application/gexf+xml", "gexf"},
+	FormatCytoscape: {"application/json", "cyjs"},
+}
+
+// exportAttribute is an attribute of a node or a link written in the exported graph
+type exportAttribute struct {
+	name  string
+	kind  string
+	value interface{}
+}
+
+func nodeExportAttributes(node Node) []exportAttribute {
+
+	attributes := []exportAttribute{
+		{"name", "string", node.PodName},
+		{"ipaddress", "string", node.IPAddress},
+		{"namespace", "string", node.Namespace},
+		{"type", "string", node.Type},
+		{"time", "string", node.Time.Format(time.RFC3339)},
+	}
+
+	attributes = append(attributes, mapExportAttributes("label.", node.Labels)...)
+	attributes = append(attributes, mapExportAttributes("attribute.", node.Attributes)...)
+
+	return attributes
+}
+
+func linkExportAttributes(link Link) []exportAttribute {
+
+	var ports []string
+	for _, port := range link.Ports {
+		ports = append(ports, strconv.Itoa(port.Port)+"/"+port.Action)
+	}
+
+	var policies []string
+	for _, policy := range link.Policies {
+		policies = append(policies, policy.PolicyID+"/"+policy.Action)
+	}
+
+	return []exportAttribute{
+		{"action", "string", link.Action},
+		{"namespace", "string", link.Namespace},
+		{"flowCount", "int", link.FlowCount},
+		{"acceptedCount", "int", link.AcceptedCount},
+		{"rejectedCount", "int", link.RejectedCount},
+		{"firstSeen", "string", link.FirstSeen.Format(time.RFC3339)},
+		{"lastSeen", "string", link.LastSeen.Format(time.RFC3339)},
+		{"ports", "string", strings.Join(ports, ",")},
+		{"policies", "string", strings.Join(policies, ",")},
+	}
+}
+
+func mapExportAttributes(prefix string, values map[string]string) []exportAttribute {
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]exportAttribute, 0, len(keys))
+	for _, k := range keys {
+		attributes = append(attributes, exportAttribute{prefix + k, "string", values[k]})
+	}
+
+	return attributes
+}
+
+// linkExportID returns the identifier of a link in the exported graph
+func linkExportID(link Link) string {
+
+	return link.Source + "->" + link.Target
+}
+
+// WriteGraph serializes the graph in the given format
+func WriteGraph(w io.Writer, graphData *GraphData, format string) error {
+
+	switch format {
+	case FormatJSON, "":
+		return json.NewEncoder(w).Encode(graphData)
+	case FormatGraphML:
+		return writeGraphML(w, graphData)
+	case FormatDOT:
+		return writeDOT(w, graphData)
+	case FormatGEXF:
+		return writeGEXF(w, graphData)
+	case FormatCytoscape:
+		return writeCytoscape(w, graphData)
+	}
+
+	return fmt.Errorf("Unknown format %s", format)
+}
+
+// attributeKey declares an attribute used by the nodes or the links of an exported graph
+type attributeKey struct {
+	id   string
+	name string
+	kind string
+}
+
+// collectKeys returns the attributes used by a set of elements in the order they first appear
+func collectKeys(prefix string, elements [][]exportAttribute) ([]attributeKey, map[string]string) {
+
+	var keys []attributeKey
+	ids := map[string]string{}
+
+	for _, attributes := range elements {
+		for _, attribute := range attributes {
+			if _, ok := ids[attribute.name]; ok {
+				continue
+			}
+			id := prefix + strconv.Itoa(len(keys))
+			ids[attribute.name] = id
+			keys = append(keys, attributeKey{id: id, name: attribute.name, kind: attribute.kind})
+		}
+	}
+
+	return keys, ids
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeGraphML(w io.Writer, graphData *GraphData) error {
+
+	nodeAttributes, linkAttributes := exportAttributes(graphData)
+	nodeKeys, nodeIDs := collectKeys("n", nodeAttributes)
+	linkKeys, linkIDs := collectKeys("e", linkAttributes)
+
+	document := graphMLDocument{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Graph: graphMLGraph{ID: "trireme", EdgeDefault: "directed"},
+	}
+
+	for _, key := range nodeKeys {
+		document.Keys = append(document.Keys, graphMLKey{ID: key.id, For: "node", Name: key.name, Type: key.kind})
+	}
+	for _, key := range linkKeys {
+		document.Keys = append(document.Keys, graphMLKey{ID: key.id, For: "edge", Name: key.name, Type: key.kind})
+	}
+
+	for i, node := range graphData.Nodes {
+		n := graphMLNode{ID: node.ContextID}
+		for _, attribute := range nodeAttributes[i] {
+			n.Data = append(n.Data, graphMLData{Key: nodeIDs[attribute.name], Value: fmt.Sprint(attribute.value)})
+		}
+		document.Graph.Nodes = append(document.Graph.Nodes, n)
+	}
+
+	for i, link := range graphData.Links {
+		e := graphMLEdge{ID: linkExportID(link), Source: link.Source, Target: link.Target}
+		for _, attribute := range linkAttributes[i] {
+			e.Data = append(e.Data, graphMLData{Key: linkIDs[attribute.name], Value: fmt.Sprint(attribute.value)})
+		}
+		document.Graph.Edges = append(document.Graph.Edges, e)
+	}
+
+	return writeXML(w, document)
+}
+
+type gexfDocument struct {
+	XMLName xml.Name  `xml:"gexf"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	Mode            string           `xml:"mode,attr"`
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Weight    int            `xml:"weight,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func writeGEXF(w io.Writer, graphData *GraphData) error {
+
+	nodeAttributes, linkAttributes := exportAttributes(graphData)
+	nodeKeys, nodeIDs := collectKeys("n", nodeAttributes)
+	linkKeys, linkIDs := collectKeys("e", linkAttributes)
+
+	document := gexfDocument{
+		Xmlns:   "http://www.gexf.net/1.2draft",
+		Version: "1.2",
+		Graph:   gexfGraph{Mode: "static", DefaultEdgeType: "directed"},
+	}
+
+	nodeClass := gexfAttributes{Class: "node"}
+	for _, key := range nodeKeys {
+		nodeClass.Attributes = append(nodeClass.Attributes, gexfAttribute{ID: key.id, Title: key.name, Type: gexfType(key.kind)})
+	}
+	linkClass := gexfAttributes{Class: "edge"}
+	for _, key := range linkKeys {
+		linkClass.Attributes = append(linkClass.Attributes, gexfAttribute{ID: key.id, Title: key.name, Type: gexfType(key.kind)})
+	}
+	document.Graph.Attributes = []gexfAttributes{nodeClass, linkClass}
+
+	for i, node := range graphData.Nodes {
+		n := gexfNode{ID: node.ContextID, Label: node.PodName}
+		for _, attribute := range nodeAttributes[i] {
+			n.AttValues = append(n.AttValues, gexfAttValue{For: nodeIDs[attribute.name], Value: fmt.Sprint(attribute.value)})
+		}
+		document.Graph.Nodes = append(document.Graph.Nodes, n)
+	}
+
+	for i, link := range graphData.Links {
+		e := gexfEdge{ID: linkExportID(link), Source: link.Source, Target: link.Target, Weight: link.FlowCount}
+		for _, attribute := range linkAttributes[i] {
+			e.AttValues = append(e.AttValues, gexfAttValue{For: linkIDs[attribute.name], Value: fmt.Sprint(attribute.value)})
+		}
+		document.Graph.Edges = append(document.Graph.Edges, e)
+	}
+
+	return writeXML(w, document)
+}
+
+func gexfType(kind string) string {
+
+	if kind == "int" {
+		return "integer"
+	}
+
+	return kind
+}
+
+func writeXML(w io.Writer, document interface{}) error {
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return fmt.Errorf("Encoding XML %s", err)
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func writeDOT(w io.Writer, graphData *GraphData) error {
+
+	var b strings.Builder
+	b.WriteString("digraph trireme {\n")
+
+	for _, node := range graphData.Nodes {
+		attributes := append([]exportAttribute{{"label", "string", node.PodName}}, nodeExportAttributes(node)...)
+		b.WriteString("  " + dotQuote(node.ContextID) + " [" + dotAttributes(attributes) + "];\n")
+	}
+
+	for _, link := range graphData.Links {
+		attributes := linkExportAttributes(link)
+		if color, ok := dotActionColors[link.Action]; ok {
+			attributes = append(attributes, exportAttribute{"color", "string", color})
+		}
+		b.WriteString("  " + dotQuote(link.Source) + " -> " + dotQuote(link.Target) + " [" + dotAttributes(attributes) + "];\n")
+	}
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var dotActionColors = map[string]string{
+	FlowAccept:      "green",
+	FlowReject:      "red",
+	FlowNowRejected: "orange",
+}
+
+func dotAttributes(attributes []exportAttribute) string {
+
+	values := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		values = append(values, dotQuote(attribute.name)+"="+dotQuote(fmt.Sprint(attribute.value)))
+	}
+
+	return strings.Join(values, ", ")
+}
+
+func dotQuote(value string) string {
+
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+
+	return `"` + value + `"`
+}
+
+type cytoscapeDocument struct {
+	Elements cytoscapeElements `json:"elements"`
+}
+
+type cytoscapeElements struct {
+	Nodes []cytoscapeElement `json:"nodes"`
+	Edges []cytoscapeElement `json:"edges"`
+}
+
+type cytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+func writeCytoscape(w io.Writer, graphData *GraphData) error {
+
+	document := cytoscapeDocument{
+		Elements: cytoscapeElements{Nodes: []cytoscapeElement{}, Edges: []cytoscapeElement{}},
+	}
+
+	for _, node := range graphData.Nodes {
+		data := map[string]interface{}{"id": node.ContextID}
+		for _, attribute := range nodeExportAttributes(node) {
+			data[attribute.name] = attribute.value
+		}
+		document.Elements.Nodes = append(document.Elements.Nodes, cytoscapeElement{Data: data})
+	}
+
+	for _, link := range graphData.Links {
+		data := map[string]interface{}{"id": linkExportID(link), "source": link.Source, "target": link.Target}
+		for _, attribute := range linkExportAttributes(link) {
+			data[attribute.name] = attribute.value
+		}
+		document.Elements.Edges = append(document.Elements.Edges, cytoscapeElement{Data: data})
+	}
+
+	return json.NewEncoder(w).Encode(document)
+}
+
+// exportAttributes returns the attributes of every node and link of the graph
+func exportAttributes(graphData *GraphData) ([][]exportAttribute, [][]exportAttribute) {
+
+	nodeAttributes := make([][]exportAttribute, len(graphData.Nodes))
+	for i, node := range graphData.Nodes {
+		nodeAttributes[i] = nodeExportAttributes(node)
+	}
+
+	linkAttributes := make([][]exportAttribute, len(graphData.Links))
+	for i, link := range graphData.Links {
+		linkAttributes[i] = linkExportAttributes(link)
+	}
+
+	return nodeAttributes, linkAttributes
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteGraph(t *testing.T) {
+
+	graphData, _, _ := sampleGraphData(false)
+	graphData.Nodes[0].PodName = `web "frontend"`
+
+	Convey("Given I export a graph as GraphML", t, func() {
+		var b bytes.Buffer
+		So(WriteGraph(&b, graphData, FormatGraphML), ShouldBeNil)
+
+		Convey("Then I should get a valid document with the attributes", func() {
+			var document graphMLDocument
+			So(xml.Unmarshal(b.Bytes(), &document), ShouldBeNil)
+			So(len(document.Graph.Nodes), ShouldEqual, 2)
+			So(len(document.Graph.Edges), ShouldEqual, 1)
+			So(document.Graph.Edges[0].Source, ShouldEqual, "6f4b63dde673")
+			So(b.String(), ShouldContainSubstring, `attr.name="label.app"`)
+			So(b.String(), ShouldContainSubstring, `<data key="e2">3</data>`)
+		})
+	})
+
+	Convey("Given I export a graph as GEXF", t, func() {
+		var b bytes.Buffer
+		So(WriteGraph(&b, graphData, FormatGEXF), ShouldBeNil)
+
+		Convey("Then I should get a valid document with weighted edges", func() {
+			var document gexfDocument
+			So(xml.Unmarshal(b.Bytes(), &document), ShouldBeNil)
+			So(len(document.Graph.Nodes), ShouldEqual, 2)
+			So(document.Graph.Edges[0].Weight, ShouldEqual, 3)
+		})
+	})
+
+	Convey("Given I export a graph as DOT", t, func() {
+		var b bytes.Buffer
+		So(WriteGraph(&b, graphData, FormatDOT), ShouldBeNil)
+
+		Convey("Then I should get a digraph with escaped labels", func() {
+			So(b.String(), ShouldStartWith, "digraph trireme {")
+			So(b.String(), ShouldContainSubstring, `"label"="web \"frontend\""`)
+			So(b.String(), ShouldContainSubstring, `"6f4b63dde673" -> "14138259f129" [`)
+			So(b.String(), ShouldContainSubstring, `"color"="green"`)
+		})
+	})
+
+	Convey("Given I export a graph as Cytoscape JSON", t, func() {
+		var b bytes.Buffer
+		So(WriteGraph(&b, graphData, FormatCytoscape), ShouldBeNil)
+
+		Convey("Then I should get the elements with their data", func() {
+			var document cytoscapeDocument
+			So(json.Unmarshal(b.Bytes(), &document), ShouldBeNil)
+			So(len(document.Elements.Nodes), ShouldEqual, 2)
+			So(document.Elements.Edges[0].Data["source"], ShouldEqual, "6f4b63dde673")
+			So(document.Elements.Edges[0].Data["flowCount"], ShouldEqual, 3)
+		})
+	})
+
+	Convey("Given I export a graph in an unknown format", t, func() {
+		Convey("Then I should get an error", func() {
+			So(WriteGraph(&bytes.Buffer{}, graphData, "svg"), ShouldNotBeNil)
+		})
+	})
+}
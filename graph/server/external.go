@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/aporeto-inc/trireme-statistics/influxdb/enrichment"
+)
+
+// validateExternalDetail checks the level of detail used for external endpoints
+func validateExternalDetail(detail string, prefix int) error {
+
+	switch detail {
+	case ExternalDetailIP, ExternalDetailCIDR, ExternalDetailFQDN, ExternalDetailWorld:
+	default:
+		return fmt.Errorf("Unknown external detail %s", detail)
+	}
+
+	if prefix < 0 || prefix > 32 {
+		return fmt.Errorf("Invalid external CIDR prefix %d", prefix)
+	}
+
+	return nil
+}
+
+// externalGroup returns the key and the display name of the node grouping an external ip
+func (g *Graph) externalGroup(ip string, attributes map[string]string) (string, string) {
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return worldNode, worldNode
+	}
+
+	switch g.externalDetail {
+	case ExternalDetailIP:
+		return ip, ip
+
+	case ExternalDetailWorld:
+		return worldNode, worldNode
+
+	case ExternalDetailFQDN:
+		if hostname := attributes[enrichment.Hostname]; hostname != "" {
+			return hostname, hostname
+		}
+	}
+
+	if label := attributes[enrichment.Label]; label != "" {
+		return "label/" + label, label
+	}
+
+	network := &net.IPNet{IP: parsedIP.Mask(net.CIDRMask(g.externalCIDRPrefix, 32)), Mask: net.CIDRMask(g.externalCIDRPrefix, 32)}
+	if parsedIP.To4() == nil {
+		// IPv6 networks are grouped by their /64
+		network = &net.IPNet{IP: parsedIP.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}
+	}
+
+	return network.String(), network.String()
+}
+
+// endpointNode returns the ID of the node of one end of a flow. The pu endpoints
+// are their context ID, even before their container event is applied, so that
+// their links are shown once it is. The other endpoints are grouped into external
+// nodes, and so are the unknown pus of the flows written without endpoint type.
+func (g *Graph) endpointNode(id string, ip string, kind int, attributes map[string]string, timestamp time.Time) string {
+
+	switch {
+	case kind == endpointTypePU && id != "":
+		return id
+
+	case kind == endpointTypeUnknown:
+		if node, ok := g.nodeMap[getHash(id, ip)]; ok {
+			return node.ContextID
+		}
+	}
+
+	key, name := g.externalGroup(ip, attributes)
+	nodeID := externalNodePrefix + key
+
+	node, ok := g.externalMap[nodeID]
+	if !ok {
+		node = &Node{
+			Time:      timestamp,
+			ContextID: nodeID,
+			PodName:   name,
+			Type:      NodeTypeExternal,
+		}
+		if g.externalDetail == ExternalDetailIP {
+			node.IPAddress = ip
+			node.Attributes = attributes
+		}
+		g.externalMap[nodeID] = node
+	}
+
+	return node.ContextID
+}
@@ -0,0 +1,530 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	client "github.com/influxdata/influxdb/client/v2"
+	"go.uber.org/zap"
+)
+
+// Sort keys of the flow search
+const (
+	FlowSortTime        = "time"
+	FlowSortSource      = "source"
+	FlowSortDestination = "destination"
+	FlowSortPort        = "port"
+	FlowSortAction      = "action"
+	FlowSortPolicy      = "policy"
+	FlowSortCount       = "count"
+)
+
+// FormatCSV returns the flows as comma separated values
+const FormatCSV = "csv"
+
+var flowSorts = map[string]bool{
+	FlowSortTime:        true,
+	FlowSortSource:      true,
+	FlowSortDestination: true,
+	FlowSortPort:        true,
+	FlowSortAction:      true,
+	FlowSortPolicy:      true,
+	FlowSortCount:       true,
+}
+
+var flowCSVHeader = []string{"time", "contextID", "sourceID", "sourceIP", "sourcePort", "destinationID", "destinationIP", "destinationPort", "action", "policyID", "dropReason", "count", "namespace"}
+
+// FlowRecord is a flow event stored in influxdb
+type FlowRecord struct {
+	Time            time.Time `json:"time"`
+	ContextID       string    `json:"contextID"`
+	SourceID        string    `json:"sourceID"`
+	SourceIP        string    `json:"sourceIP"`
+	SourcePort      int       `json:"sourcePort,omitempty"`
+	DestinationID   string    `json:"destinationID"`
+	DestinationIP   string    `json:"destinationIP"`
+	DestinationPort int       `json:"destinationPort,omitempty"`
+	Action          string    `json:"action"`
+	PolicyID        string    `json:"policyID,omitempty"`
+	DropReason      string    `json:"dropReason,omitempty"`
+	Count           int       `json:"count"`
+	Namespace       string    `json:"namespace,omitempty"`
+}
+
+// FlowPage is a page of the flow search
+type FlowPage struct {
+	Flows []FlowRecord `json:"flows"`
+	// NextCursor is passed as cursor to get the next page, empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// FlowSearch holds the filters, the order and the page of a flow search
+type FlowSearch struct {
+	Start         time.Time
+	End           time.Time
+	SourceID      string
+	SourceIP      string
+	DestinationID string
+	DestinationIP string
+	Port          int
+	Action        string
+	PolicyID      string
+	Namespace     string
+
+	Sort       string
+	Descending bool
+	Limit      int
+	Cursor     *FlowCursor
+
+	// sourceNet and destinationNet are set when the ip filters are CIDRs
+	sourceNet      *net.IPNet
+	destinationNet *net.IPNet
+}
+
+// FlowCursor is the position of the last flow of a page in the search order
+type FlowCursor struct {
+	Text   string    `json:"s,omitempty"`
+	Number int       `json:"n,omitempty"`
+	Time   time.Time `json:"t"`
+	ID     string    `json:"i,omitempty"`
+}
+
+// ParseFlowSearch parses the parameters of a flow search
+func ParseFlowSearch(r *http.Request) (*FlowSearch, error) {
+
+	params := r.URL.Query()
+	s := &FlowSearch{
+		SourceID:      params.Get("sourceid"),
+		DestinationID: params.Get("destinationid"),
+		Action:        params.Get("action"),
+		PolicyID:      params.Get("policy"),
+		Namespace:     params.Get("namespace"),
+		Sort:          FlowSortTime,
+		Descending:    true,
+		Limit:         defaultFlowLimit,
+	}
+
+	window, err := parseWindow(r, "starttime", "endtime")
+	if err != nil {
+		return nil, err
+	}
+	s.Start, s.End = window[0], window[1]
+	if s.End.IsZero() {
+		s.End = time.Now()
+	}
+	if s.Start.IsZero() {
+		s.Start = s.End.Add(-defaultFlowWindow)
+	}
+	if s.End.Before(s.Start) {
+		return nil, fmt.Errorf("Invalid Time Window %s is before %s", s.End, s.Start)
+	}
+
+	if s.SourceIP, s.sourceNet, err = parseIPFilter(params.Get("sourceip")); err != nil {
+		return nil, err
+	}
+	if s.DestinationIP, s.destinationNet, err = parseIPFilter(params.Get("destinationip")); err != nil {
+		return nil, err
+	}
+
+	if value := params.Get("port"); value != "" {
+		if s.Port, err = strconv.Atoi(value); err != nil || s.Port <= 0 || s.Port > 65535 {
+			return nil, fmt.Errorf("Invalid port %s", value)
+		}
+	}
+
+	if s.Action != "" && s.Action != FlowAccept && s.Action != FlowReject {
+		return nil, fmt.Errorf("Unknown action %s", s.Action)
+	}
+
+	if value := params.Get("sort"); value != "" {
+		s.Descending = strings.HasPrefix(value, "-")
+		s.Sort = strings.TrimPrefix(value, "-")
+		if !flowSorts[s.Sort] {
+			return nil, fmt.Errorf("Unknown sort %s", value)
+		}
+	}
+
+	if value := params.Get("limit"); value != "" {
+		if s.Limit, err = strconv.Atoi(value); err != nil || s.Limit <= 0 || s.Limit > maxFlowLimit {
+			return nil, fmt.Errorf("Invalid limit %s, must be between 1 and %d", value, maxFlowLimit)
+		}
+	}
+
+	if value := params.Get("cursor"); value != "" {
+		if s.Cursor, err = decodeFlowCursor(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// parseIPFilter returns the ip to match exactly, or the network to match
+func parseIPFilter(value string) (string, *net.IPNet, error) {
+
+	if value == "" {
+		return "", nil, nil
+	}
+
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("Invalid CIDR %s", value)
+		}
+		return "", network, nil
+	}
+
+	if net.ParseIP(value) == nil {
+		return "", nil, fmt.Errorf("Invalid IP %s", value)
+	}
+
+	return value, nil, nil
+}
+
+func decodeFlowCursor(value string) (*FlowCursor, error) {
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+
+	var cursor FlowCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+
+	return &cursor, nil
+}
+
+func (c *FlowCursor) String() string {
+
+	data, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Query returns the InfluxQL query of the flows matching the filters that can be
+// evaluated by influxdb. Flows sorted by time are read in order from the cursor.
+func (s *FlowSearch) Query() string {
+
+	conditions := []string{
+		"time >= '" + s.Start.UTC().Format(time.RFC3339Nano) + "'",
+		"time <= '" + s.End.UTC().Format(time.RFC3339Nano) + "'",
+	}
+
+	for field, value := range map[string]string{
+		"SourceID":      s.SourceID,
+		"SourceIP":      s.SourceIP,
+		"DestinationID": s.DestinationID,
+		"DestinationIP": s.DestinationIP,
+		"Action":        s.Action,
+		"PolicyID":      s.PolicyID,
+	} {
+		if value != "" {
+			conditions = append(conditions, `"`+field+`" = '`+quoteInfluxString(value)+`'`)
+		}
+	}
+	if s.Port > 0 {
+		conditions = append(conditions, `"DestinationPort" = `+strconv.Itoa(s.Port))
+	}
+	if s.Namespace != "" {
+		conditions = append(conditions, `"Tags" =~ /`+strings.Replace(regexp.QuoteMeta(PODNamespaceFromFlowTags+"="+s.Namespace), "/", `\/`, -1)+`([ \]]|$)/`)
+	}
+
+	order := ""
+	if s.Sort == FlowSortTime {
+		if s.Cursor != nil {
+			if s.Descending {
+				conditions = append(conditions, "time <= '"+s.Cursor.Time.UTC().Format(time.RFC3339Nano)+"'")
+			} else {
+				conditions = append(conditions, "time >= '"+s.Cursor.Time.UTC().Format(time.RFC3339Nano)+"'")
+			}
+		}
+		if s.Descending {
+			order = " ORDER BY time DESC"
+		}
+	}
+
+	sort.Strings(conditions[2:])
+
+	return FlowEventsQuery + " WHERE " + strings.Join(conditions, " AND ") + order + " LIMIT " + strconv.Itoa(maxFlowScan+1)
+}
+
+// quoteInfluxString escapes a value used in a single quoted InfluxQL string
+func quoteInfluxString(value string) string {
+
+	return strings.Replace(strings.Replace(value, `\`, `\\`, -1), `'`, `\'`, -1)
+}
+
+// matches evaluates the filters that cannot be evaluated by influxdb
+func (s *FlowSearch) matches(flow *FlowRecord) bool {
+
+	if s.sourceNet != nil && !ipInNetwork(flow.SourceIP, s.sourceNet) {
+		return false
+	}
+	if s.destinationNet != nil && !ipInNetwork(flow.DestinationIP, s.destinationNet) {
+		return false
+	}
+
+	return s.Namespace == "" || flow.Namespace == s.Namespace
+}
+
+func ipInNetwork(ip string, network *net.IPNet) bool {
+
+	parsedIP := net.ParseIP(ip)
+
+	return parsedIP != nil && network.Contains(parsedIP)
+}
+
+// cursor returns the position of the flow in the search order
+func (s *FlowSearch) cursor(flow *FlowRecord) *FlowCursor {
+
+	c := &FlowCursor{Time: flow.Time, ID: flow.ContextID}
+	switch s.Sort {
+	case FlowSortSource:
+		c.Text = flow.SourceID
+	case FlowSortDestination:
+		c.Text = flow.DestinationID
+	case FlowSortPort:
+		c.Number = flow.DestinationPort
+	case FlowSortAction:
+		c.Text = flow.Action
+	case FlowSortPolicy:
+		c.Text = flow.PolicyID
+	case FlowSortCount:
+		c.Number = flow.Count
+	}
+
+	return c
+}
+
+// compare orders two positions in the search order. Flows with the same sort
+// value are ordered by time then by pu, which identify a stored flow event.
+func (s *FlowSearch) compare(a *FlowCursor, b *FlowCursor) int {
+
+	result := 0
+	switch {
+	case a.Number != b.Number:
+		result = compareInts(a.Number, b.Number)
+	case a.Text != b.Text:
+		result = strings.Compare(a.Text, b.Text)
+	case !a.Time.Equal(b.Time):
+		if a.Time.Before(b.Time) {
+			result = -1
+		} else {
+			result = 1
+		}
+	default:
+		result = strings.Compare(a.ID, b.ID)
+	}
+
+	if s.Descending {
+		return -result
+	}
+
+	return result
+}
+
+func compareInts(a int, b int) int {
+
+	if a < b {
+		return -1
+	}
+
+	return 1
+}
+
+// page sorts the flows read from influxdb and returns the page after the cursor.
+// scanned is the number of flows read, more flows may be stored when it reached
+// the scan limit.
+func (s *FlowSearch) page(flows []FlowRecord, scanned int) *FlowPage {
+
+	type positioned struct {
+		flow   *FlowRecord
+		cursor *FlowCursor
+	}
+
+	var matching []positioned
+	for i := range flows {
+		flow := &flows[i]
+		c := s.cursor(flow)
+		if (s.Cursor == nil || s.compare(c, s.Cursor) > 0) && s.matches(flow) {
+			matching = append(matching, positioned{flow: flow, cursor: c})
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return s.compare(matching[i].cursor, matching[j].cursor) < 0
+	})
+
+	result := &FlowPage{Flows: []FlowRecord{}}
+	for i := 0; i < len(matching) && i < s.Limit; i++ {
+		result.Flows = append(result.Flows, *matching[i].flow)
+	}
+
+	switch {
+	case len(matching) > s.Limit:
+		result.NextCursor = matching[s.Limit-1].cursor.String()
+	case scanned > maxFlowScan && len(flows) > 0:
+		// Flows sorted by time are read in order, the next page starts after the flows read
+		result.NextCursor = s.cursor(&flows[len(flows)-1]).String()
+	}
+
+	return result
+}
+
+// SearchFlows returns the page of the flows stored in influxdb matching the search
+func (g *Graph) SearchFlows(s *FlowSearch) (*FlowPage, error) {
+
+	res, err := g.executeQuery(s.Query())
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving Flow Events %s", err)
+	}
+	if err := res.Error(); err != nil {
+		return nil, fmt.Errorf("Retrieving Flow Events %s", err)
+	}
+
+	flows, err := g.parseFlowRecords(res.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	scanned := len(flows)
+	if scanned > maxFlowScan {
+		if s.Sort != FlowSortTime {
+			return nil, fmt.Errorf("More than %d flows to sort, narrow the time window or the filters", maxFlowScan)
+		}
+		flows = flows[:maxFlowScan]
+	}
+
+	return s.page(flows, scanned), nil
+}
+
+// parseFlowRecords returns the flows of the results of a query on the FlowEvents measurement
+func (g *Graph) parseFlowRecords(results []client.Result) ([]FlowRecord, error) {
+
+	var flows []FlowRecord
+	if len(results) == 0 || len(results[0].Series) == 0 {
+		return flows, nil
+	}
+
+	series := results[0].Series[0]
+	columns := newColumnIndex(series.Columns)
+	for _, row := range series.Values {
+		flowAttr := extractFlowEventAttributes(columns, row)
+		parsedTime, err := time.Parse(time.RFC3339, flowAttr.timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing Time %s", err)
+		}
+
+		count := flowAttr.counter
+		if count <= 0 {
+			count = 1
+		}
+
+		flows = append(flows, FlowRecord{
+			Time:            parsedTime,
+			ContextID:       toString(columns.value(row, "ContextID", -1)),
+			SourceID:        flowAttr.srcID,
+			SourceIP:        flowAttr.srcIP,
+			SourcePort:      toInt(columns.value(row, "SourcePort", -1)),
+			DestinationID:   flowAttr.dstID,
+			DestinationIP:   flowAttr.dstIP,
+			DestinationPort: flowAttr.dstPort,
+			Action:          flowAttr.action,
+			PolicyID:        flowAttr.policyID,
+			DropReason:      flowAttr.dropReason,
+			Count:           count,
+			Namespace:       g.parseTag(flowAttr.tags, PODNamespaceFromFlowTags),
+		})
+	}
+
+	return flows, nil
+}
+
+// GetFlows is the handler searching the stored flow events. The flows are filtered
+// by sourceid, sourceip, destinationid, destinationip (ip or CIDR), port, action,
+// policy, namespace, starttime and endtime, the last day by default. They are sorted
+// by time, source, destination, port, action, policy or count, prefixed by - for a
+// descending order, most recent first by default. The next page is requested with
+// the cursor returned with the page, in the body or the X-Next-Cursor header.
+func (g *Graph) GetFlows(w http.ResponseWriter, r *http.Request) {
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != FormatJSON && format != FormatCSV {
+		http.Error(w, "Unknown format "+format, http.StatusBadRequest)
+		return
+	}
+
+	search, err := ParseFlowSearch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := g.SearchFlows(search)
+	if err != nil {
+		zap.L().Error("Searching flows", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+
+	if format == FormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+		if err := writeFlowsCSV(w, page.Flows); err != nil {
+			zap.L().Debug("Writing flows", zap.Error(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeFlowsCSV(w http.ResponseWriter, flows []FlowRecord) error {
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(flowCSVHeader); err != nil {
+		return err
+	}
+
+	for _, flow := range flows {
+		err := writer.Write([]string{
+			flow.Time.UTC().Format(time.RFC3339Nano),
+			flow.ContextID,
+			flow.SourceID,
+			flow.SourceIP,
+			strconv.Itoa(flow.SourcePort),
+			flow.DestinationID,
+			flow.DestinationIP,
+			strconv.Itoa(flow.DestinationPort),
+			flow.Action,
+			flow.PolicyID,
+			flow.DropReason,
+			strconv.Itoa(flow.Count),
+			flow.Namespace,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/trireme-statistics/influxdb/mock"
+	gomock "github.com/golang/mock/gomock"
+	client "github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func sampleFlowRecords() *client.Response {
+
+	return &client.Response{Results: []client.Result{{Series: []models.Row{{
+		Name:    FlowEvent,
+		Columns: []string{"time", "ContextID", "SourceID", "SourceIP", "DestinationID", "DestinationIP", "DestinationPort", "Action", "PolicyID", "Counter", "Tags"},
+		Values: [][]interface{}{
+			{"2017-11-08T06:14:48Z", "b", "a", "10.0.0.1", "b", "10.0.1.2", json.Number("80"), "accept", "p1", json.Number("2"), "&{[@namespace=default]}"},
+			{"2017-11-08T06:14:47Z", "b", "a", "10.0.0.1", "b", "10.0.1.2", json.Number("443"), "reject", "", json.Number("1"), "&{[@namespace=default]}"},
+			{"2017-11-08T06:14:46Z", "c", "a", "10.0.0.1", "c", "192.168.1.3", json.Number("22"), "reject", "", json.Number("5"), "&{[@namespace=default]}"},
+		},
+	}}}}}
+}
+
+func TestGetFlows(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create a graph", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB")
+		window := "starttime=2017-11-08T06:00:00Z&endtime=2017-11-08T07:00:00Z"
+
+		get := func(query string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			newTestGraph.GetFlows(w, httptest.NewRequest("GET", "/api/v1/flows?"+window+"&"+query, nil))
+			return w
+		}
+
+		Convey("When I search the flows with filters evaluated by influxdb", func() {
+			search, err := ParseFlowSearch(httptest.NewRequest("GET", "/api/v1/flows?"+window+"&sourceid=a&destinationip=10.0.1.2&port=80&action=accept&namespace=default&policy=it's", nil))
+
+			Convey("Then they should be part of the query", func() {
+				So(err, ShouldBeNil)
+				So(search.Query(), ShouldEqual, `SELECT * FROM FlowEvents WHERE time >= '2017-11-08T06:00:00Z' AND time <= '2017-11-08T07:00:00Z' AND "Action" = 'accept' AND "DestinationIP" = '10.0.1.2' AND "DestinationPort" = 80 AND "PolicyID" = 'it\'s' AND "SourceID" = 'a' AND "Tags" =~ /@namespace=default([ \]]|$)/ ORDER BY time DESC LIMIT 100001`)
+			})
+		})
+
+		Convey("When I page through the flows sorted by port", func() {
+			mockDataAdder.EXPECT().ExecuteQuery(gomock.Any(), "testDB").Return(sampleFlowRecords(), nil).Times(2)
+
+			var first FlowPage
+			w := get("sort=port&limit=2")
+			So(json.Unmarshal(w.Body.Bytes(), &first), ShouldBeNil)
+
+			var second FlowPage
+			w = get("sort=port&limit=2&cursor=" + first.NextCursor)
+			So(json.Unmarshal(w.Body.Bytes(), &second), ShouldBeNil)
+
+			Convey("Then every flow should be returned once in order", func() {
+				So(len(first.Flows), ShouldEqual, 2)
+				So(first.Flows[0].DestinationPort, ShouldEqual, 22)
+				So(first.Flows[1].DestinationPort, ShouldEqual, 80)
+				So(first.Flows[1].Namespace, ShouldEqual, "default")
+				So(first.NextCursor, ShouldNotBeEmpty)
+				So(len(second.Flows), ShouldEqual, 1)
+				So(second.Flows[0].DestinationPort, ShouldEqual, 443)
+				So(second.NextCursor, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When I search the flows to a CIDR as CSV", func() {
+			mockDataAdder.EXPECT().ExecuteQuery(gomock.Any(), "testDB").Return(sampleFlowRecords(), nil).Times(1)
+
+			w := get("destinationip=10.0.1.0/24&format=csv")
+			lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+
+			Convey("Then only the flows to the network should be returned, most recent first", func() {
+				So(w.Header().Get("Content-Type"), ShouldEqual, "text/csv")
+				So(len(lines), ShouldEqual, 3)
+				So(lines[0], ShouldStartWith, "time,contextID,sourceID")
+				So(lines[1], ShouldEqual, "2017-11-08T06:14:48Z,b,a,10.0.0.1,0,b,10.0.1.2,80,accept,p1,,2,default")
+				So(lines[2], ShouldContainSubstring, ",443,reject,")
+			})
+		})
+
+		Convey("When I search with invalid parameters", func() {
+			Convey("Then I should get a bad request", func() {
+				for _, query := range []string{"sourceip=10.0.0.0/33", "port=http", "sort=size", "limit=5000", "cursor=notacursor", "action=drop", "format=xml"} {
+					So(get(query).Code, ShouldEqual, 400)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// validateGroupBy checks the aggregation requested for the graph
+func validateGroupBy(groupby string) error {
+
+	switch groupby {
+	case GroupByNamespace, GroupByWorkload, GroupByApp:
+		return nil
+	}
+
+	return fmt.Errorf("Unknown groupby %s", groupby)
+}
+
+// groupOf returns the key and the display name of the group of a pu
+func groupOf(node Node, groupby string) (string, string) {
+
+	namespace := node.Namespace
+	if namespace == "" {
+		namespace = "none"
+	}
+
+	switch groupby {
+	case GroupByNamespace:
+		return namespace, namespace
+
+	case GroupByApp:
+		if app := node.Labels["app"]; app != "" {
+			return namespace + "/" + app, app
+		}
+	}
+
+	workload := podWorkload(&node)
+
+	return namespace + "/" + workload, workload
+}
+
+// podWorkload returns the workload of a pu: the controller of its pod when the
+// container tags name it, or else the name of its pod without the controller suffixes
+func podWorkload(node *Node) string {
+
+	if owner := ownerName(node.Labels[createdByLabel]); owner != "" {
+		return owner
+	}
+
+	return workloadName(node.PodName)
+}
+
+// ownerName returns the name of the controller referenced by a created-by annotation.
+// The name of the Deployment is returned for its ReplicaSets.
+func ownerName(createdBy string) string {
+
+	if createdBy == "" {
+		return ""
+	}
+
+	var reference struct {
+		Reference struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"reference"`
+	}
+	if err := json.Unmarshal([]byte(createdBy), &reference); err != nil {
+		return ""
+	}
+
+	name := reference.Reference.Name
+	if reference.Reference.Kind == "ReplicaSet" {
+		if i := strings.LastIndex(name, "-"); i > 0 && isTemplateHash(name[i+1:]) {
+			name = name[:i]
+		}
+	}
+
+	return name
+}
+
+// workloadName removes the suffixes added by the controllers to the name of their pods,
+// such as the ReplicaSet hash and random suffix of web-3468831164-x2x9z or the
+// ordinal of db-0
+func workloadName(podName string) string {
+
+	parts := strings.Split(podName, "-")
+	if len(parts) < 2 {
+		return podName
+	}
+
+	trimmed := false
+	if isPodSuffix(parts[len(parts)-1]) {
+		parts = parts[:len(parts)-1]
+		trimmed = true
+	}
+
+	if len(parts) > 1 && isTemplateHash(parts[len(parts)-1]) {
+		parts = parts[:len(parts)-1]
+	} else if !trimmed && len(parts) > 1 && isNumber(parts[len(parts)-1]) {
+		parts = parts[:len(parts)-1]
+	}
+
+	return strings.Join(parts, "-")
+}
+
+// isPodSuffix tells if s is the random suffix generated for pod names, made of the
+// pod suffix alphabet or, in older Kubernetes releases, of any lowercase letters and
+// digits. Suffixes outside of the alphabet must have a digit so that names ending
+// with a word, such as my-agent, are kept.
+func isPodSuffix(s string) bool {
+
+	if len(s) != 5 {
+		return false
+	}
+
+	alphabet, digit := true, false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c < 'a' || c > 'z':
+			return false
+		}
+		if !strings.ContainsRune(podSuffixAlphabet, c) {
+			alphabet = false
+		}
+	}
+
+	return alphabet || digit
+}
+
+// isTemplateHash tells if s is a pod template hash, made of digits in older
+// Kubernetes releases and of the pod suffix alphabet in newer ones
+func isTemplateHash(s string) bool {
+
+	if len(s) >= 6 && isNumber(s) {
+		return true
+	}
+
+	if len(s) < 8 || len(s) > 10 {
+		return false
+	}
+
+	hasDigit := false
+	for _, c := range s {
+		if !strings.ContainsRune(podSuffixAlphabet, c) {
+			return false
+		}
+		if c >= '0' && c <= '9' {
+			hasDigit = true
+		}
+	}
+
+	return hasDigit
+}
+
+func isNumber(s string) bool {
+
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GroupGraph collapses the pus of the graph into one node per namespace, workload
+// or app. The groups listed in expand keep their pus. Links between the same
+// nodes are merged.
+func GroupGraph(graphData *GraphData, groupby string, expand []string) (*GraphData, error) {
+
+	if err := validateGroupBy(groupby); err != nil {
+		return nil, err
+	}
+
+	expanded := map[string]bool{}
+	for _, id := range expand {
+		expanded[id] = true
+	}
+
+	result := &GraphData{Nodes: []Node{}, Links: []Link{}}
+	groups := map[string]*Node{}
+	var groupIDs []string
+	nodeGroup := map[string]string{}
+
+	for _, node := range graphData.Nodes {
+		if node.Type != NodeTypePU {
+			result.Nodes = append(result.Nodes, node)
+			continue
+		}
+
+		key, name := groupOf(node, groupby)
+		id := groupNodePrefix + groupby + ":" + key
+		if expanded[id] {
+			result.Nodes = append(result.Nodes, node)
+			continue
+		}
+
+		group, ok := groups[id]
+		if !ok {
+			group = &Node{
+				Time:      node.Time,
+				ContextID: id,
+				PodName:   name,
+				Namespace: node.Namespace,
+				Type:      NodeTypeGroup,
+			}
+			groups[id] = group
+			groupIDs = append(groupIDs, id)
+		}
+		if node.Time.Before(group.Time) {
+			group.Time = node.Time
+		}
+		group.Members = append(group.Members, node.ContextID)
+		nodeGroup[node.ContextID] = id
+	}
+
+	sort.Strings(groupIDs)
+	for _, id := range groupIDs {
+		result.Nodes = append(result.Nodes, *groups[id])
+	}
+
+	links := map[LinkID]*Link{}
+	var linkKeys []LinkID
+	for _, link := range graphData.Links {
+		if id, ok := nodeGroup[link.Source]; ok {
+			link.Source = id
+		}
+		if id, ok := nodeGroup[link.Target]; ok {
+			link.Target = id
+		}
+
+		key := link.id()
+		merged, ok := links[key]
+		if !ok {
+			merged = &Link{}
+			*merged = link
+			merged.Ports = append([]LinkPort(nil), link.Ports...)
+			merged.Policies = append([]LinkPolicy(nil), link.Policies...)
+			links[key] = merged
+			linkKeys = append(linkKeys, key)
+			continue
+		}
+		merged.merge(link)
+	}
+
+	for _, key := range linkKeys {
+		result.Links = append(result.Links, *links[key])
+	}
+
+	return result, nil
+}
+
+// combineAction returns the action of flows merged from two actions
+func combineAction(a string, b string) string {
+
+	if a == b {
+		return a
+	}
+
+	return FlowNowRejected
+}
+
+// merge adds the flows of another link to the link
+func (l *Link) merge(other Link) {
+
+	l.Action = combineAction(l.Action, other.Action)
+	if l.Namespace != other.Namespace {
+		l.Namespace = ""
+	}
+	if other.Time.Before(l.Time) {
+		l.Time = other.Time
+	}
+
+	l.FlowCount += other.FlowCount
+	l.AcceptedCount += other.AcceptedCount
+	l.RejectedCount += other.RejectedCount
+	if !other.FirstSeen.IsZero() && (l.FirstSeen.IsZero() || other.FirstSeen.Before(l.FirstSeen)) {
+		l.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen.After(l.LastSeen) {
+		l.LastSeen = other.LastSeen
+	}
+
+	for _, port := range other.Ports {
+		p := l.port(port.Port, port.Action)
+		p.Action = combineAction(p.Action, port.Action)
+		p.FlowCount += port.FlowCount
+		p.AcceptedCount += port.AcceptedCount
+		p.RejectedCount += port.RejectedCount
+	}
+
+	for _, policy := range other.Policies {
+		l.policy(policy.Action, policy.PolicyID, policy.DropReason).FlowCount += policy.FlowCount
+	}
+}
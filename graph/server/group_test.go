@@ -0,0 +1,86 @@
+package server
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroupGraph(t *testing.T) {
+
+	Convey("Given I derive workload names from pod names", t, func() {
+		So(workloadName("web-3468831164-x2x9z"), ShouldEqual, "web")
+		So(workloadName("kube-dns-86f4d74b45-2x9tq"), ShouldEqual, "kube-dns")
+		So(workloadName("aporeto-collector-sp9v9"), ShouldEqual, "aporeto-collector")
+		So(workloadName("db-0"), ShouldEqual, "db")
+		So(workloadName("standalone"), ShouldEqual, "standalone")
+		So(workloadName("my-agent"), ShouldEqual, "my-agent")
+		So(workloadName("aporeto-collector-13rvx"), ShouldEqual, "aporeto-collector")
+		So(workloadName("web-5d8f9c7b6-a1b2c"), ShouldEqual, "web")
+	})
+
+	Convey("Given I derive the workload of pus whose tags name their controller", t, func() {
+		createdBy := func(kind, name string) *Node {
+			return &Node{PodName: "generated-name-13rvx", Labels: map[string]string{
+				createdByLabel: `{"kind":"SerializedReference","apiVersion":"v1","reference":{"kind":"` + kind + `","namespace":"kube-system","name":"` + name + `"}}`,
+			}}
+		}
+
+		Convey("Then the controller should name the workload", func() {
+			So(podWorkload(createdBy("ReplicaSet", "aporeto-collector")), ShouldEqual, "aporeto-collector")
+			So(podWorkload(createdBy("ReplicaSet", "kube-dns-86f4d74b45")), ShouldEqual, "kube-dns")
+			So(podWorkload(createdBy("DaemonSet", "node-agent")), ShouldEqual, "node-agent")
+			So(podWorkload(&Node{PodName: "aporeto-collector-13rvx", Labels: map[string]string{createdByLabel: "{"}}), ShouldEqual, "aporeto-collector")
+		})
+	})
+
+	Convey("Given I have a graph with replicated pus", t, func() {
+		graphData := &GraphData{
+			Nodes: []Node{
+				{ContextID: "web1", PodName: "web-3468831164-x2x9z", Namespace: "shop", Type: NodeTypePU, Labels: map[string]string{"app": "shop"}},
+				{ContextID: "web2", PodName: "web-3468831164-b7k2p", Namespace: "shop", Type: NodeTypePU, Labels: map[string]string{"app": "shop"}},
+				{ContextID: "db1", PodName: "db-0", Namespace: "shop", Type: NodeTypePU, Labels: map[string]string{"app": "shop"}},
+				{ContextID: "ext:8.8.8.0/24", PodName: "8.8.8.0/24", Type: NodeTypeExternal},
+			},
+			Links: []Link{
+				{Source: "web1", Target: "db1", Action: FlowAccept, FlowCount: 2, AcceptedCount: 2, Ports: []LinkPort{{Port: 5432, Action: FlowAccept, FlowCount: 2, AcceptedCount: 2}}},
+				{Source: "web2", Target: "db1", Action: FlowReject, FlowCount: 1, RejectedCount: 1, Ports: []LinkPort{{Port: 5432, Action: FlowReject, FlowCount: 1, RejectedCount: 1}}},
+				{Source: "web2", Target: "ext:8.8.8.0/24", Action: FlowAccept, FlowCount: 1, AcceptedCount: 1},
+			},
+		}
+
+		Convey("Then grouping by workload should merge the pus and their links", func() {
+			result, err := GroupGraph(graphData, GroupByWorkload, nil)
+			So(err, ShouldBeNil)
+			So(len(result.Nodes), ShouldEqual, 3)
+			So(result.Nodes[2].ContextID, ShouldEqual, "group:workload:shop/web")
+			So(result.Nodes[2].Members, ShouldResemble, []string{"web1", "web2"})
+			So(len(result.Links), ShouldEqual, 2)
+			So(result.Links[0].Source, ShouldEqual, "group:workload:shop/web")
+			So(result.Links[0].Target, ShouldEqual, "group:workload:shop/db")
+			So(result.Links[0].Action, ShouldEqual, FlowNowRejected)
+			So(result.Links[0].FlowCount, ShouldEqual, 3)
+			So(result.Links[0].Ports, ShouldResemble, []LinkPort{{Port: 5432, Action: FlowNowRejected, FlowCount: 3, AcceptedCount: 2, RejectedCount: 1}})
+			So(graphData.Links[0].Ports[0].FlowCount, ShouldEqual, 2)
+		})
+
+		Convey("Then grouping by app should use the app label", func() {
+			result, err := GroupGraph(graphData, GroupByApp, nil)
+			So(err, ShouldBeNil)
+			So(len(result.Nodes), ShouldEqual, 2)
+			So(result.Nodes[1].Members, ShouldResemble, []string{"web1", "web2", "db1"})
+		})
+
+		Convey("Then an expanded group should keep its pus", func() {
+			result, err := GroupGraph(graphData, GroupByWorkload, []string{"group:workload:shop/web"})
+			So(err, ShouldBeNil)
+			So(len(result.Nodes), ShouldEqual, 4)
+			So(len(result.Links), ShouldEqual, 3)
+		})
+
+		Convey("Then an unknown grouping should fail", func() {
+			_, err := GroupGraph(graphData, "cluster", nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
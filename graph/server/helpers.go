@@ -1,10 +1,18 @@
 package server
 
-// DefaultLink is the default links struct for graph
-func DefaultLink() Link {
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
-	return Link{Source: "", Target: ""}
-}
+	"git.cloud.top/DSec/trireme-lib/collector"
+	"github.com/aporeto-inc/trireme-statistics/influxdb"
+	"github.com/aporeto-inc/trireme-statistics/influxdb/enrichment"
+)
 
 // DefaultNode is the default nodes struct for graph
 func DefaultNode() Node {
@@ -16,52 +24,353 @@ func getHash(contextID string, ipAddress string) string {
 	return contextID + ":" + ipAddress
 }
 
-func extractContainerEventAttributes(containerEvent []interface{}) *ContainerEvents {
-	var containerAttr ContainerEvents
+// columnIndex maps the column names of an influxdb series to their position
+type columnIndex map[string]int
 
-	if value := containerEvent[ContainerTimestampIndex]; value != nil {
-		containerAttr.timestamp = value.(string)
+func newColumnIndex(columns []string) columnIndex {
+
+	index := make(columnIndex, len(columns))
+	for i, column := range columns {
+		index[column] = i
 	}
-	if value := containerEvent[ContainerContextIDIndex]; value != nil {
-		containerAttr.contextID = value.(string)
+
+	return index
+}
+
+// value returns the value of the named column. Responses without column names
+// fall back to the default position of the column.
+func (c columnIndex) value(row []interface{}, name string, fallback int) interface{} {
+
+	position := fallback
+	if len(c) > 0 {
+		var ok bool
+		if position, ok = c[name]; !ok {
+			return nil
+		}
+	}
+
+	if position < 0 || position >= len(row) {
+		return nil
+	}
+
+	return row[position]
+}
+
+// attributes returns the enriched attributes found in the row for the given column prefix
+func (c columnIndex) attributes(row []interface{}, prefix string) map[string]string {
+	var attributes map[string]string
+
+	for _, name := range enrichment.AttributeNames {
+		value := toString(c.value(row, prefix+name, -1))
+		if value == "" {
+			continue
+		}
+		if attributes == nil {
+			attributes = make(map[string]string)
+		}
+		attributes[name] = value
 	}
-	if value := containerEvent[ContainerEventIndex]; value != nil {
-		containerAttr.event = value.(string)
+
+	return attributes
+}
+
+// incrementalQuery restricts a query to the points stored after the given time,
+// minus the ingest lag. The points read again are skipped by firstApplication.
+func incrementalQuery(query string, after time.Time) string {
+
+	if after.IsZero() {
+		return query
 	}
-	if value := containerEvent[ContainerIPAddressIndex]; value != nil {
-		containerAttr.ipAddress = value.(string)
+
+	return query + " WHERE time > '" + after.Add(-ingestLag).UTC().Format(time.RFC3339Nano) + "'"
+}
+
+// eventKey identifies an event read by several generations
+type eventKey struct {
+	measurement string
+	time        int64
+	contextID   string
+	source      string
+	destination string
+}
+
+// firstApplication records the event and returns false when it was already applied
+func (g *Graph) firstApplication(key eventKey) bool {
+
+	if g.applied == nil {
+		g.applied = make(map[eventKey]bool)
 	}
-	if value := containerEvent[ContainerTagsIndex]; value != nil {
-		containerAttr.tags = value.(string)
+
+	if g.applied[key] {
+		return false
 	}
+	g.applied[key] = true
+
+	return true
+}
+
+// pruneApplied forgets the events of the measurement that the next generation does not read again
+func (g *Graph) pruneApplied(measurement string, last time.Time) {
+
+	cutoff := last.Add(-ingestLag).UnixNano()
+	for key := range g.applied {
+		if key.measurement == measurement && key.time <= cutoff {
+			delete(g.applied, key)
+		}
+	}
+}
+
+// parseTimeParam parses a time given as RFC3339 or as the UTC local time sent by the html form
+func parseTimeParam(value string) (time.Time, error) {
+
+	if parsedTime, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsedTime, nil
+	}
+
+	return time.Parse(time.RFC3339, value+"Z")
+}
+
+// parseWindow parses the time window given by the start and end parameters.
+// A window ending before its start is invalid.
+func parseWindow(r *http.Request, startParam string, endParam string) ([2]time.Time, error) {
+
+	var window [2]time.Time
+	for i, param := range []string{startParam, endParam} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+
+		parsedTime, err := parseTimeParam(value)
+		if err != nil {
+			return window, fmt.Errorf("Parsing Time %s %s", param, err)
+		}
+		window[i] = parsedTime
+	}
+
+	if !window[0].IsZero() && !window[1].IsZero() && window[1].Before(window[0]) {
+		return window, fmt.Errorf("Invalid Time Window %s is before %s", window[1], window[0])
+	}
+
+	return window, nil
+}
+
+// splitParam returns the values of a query parameter given repeated or comma separated
+func splitParam(values []string) []string {
+	var result []string
+
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				result = append(result, v)
+			}
+		}
+	}
+
+	return result
+}
+
+func toString(value interface{}) string {
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func toInt(value interface{}) int {
+
+	switch v := value.(type) {
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			f, _ := v.Float64()
+			return int(f)
+		}
+		return int(i)
+	case float64:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	default:
+		return 0
+	}
+}
+
+func toFloat(value interface{}) float64 {
+
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	default:
+		return 0
+	}
+}
+
+func extractContainerEventAttributes(columns columnIndex, containerEvent []interface{}) *ContainerEvents {
+	var containerAttr ContainerEvents
+
+	containerAttr.timestamp = toString(columns.value(containerEvent, "time", ContainerTimestampIndex))
+	containerAttr.contextID = toString(columns.value(containerEvent, "ContextID", ContainerContextIDIndex))
+	containerAttr.event = toString(columns.value(containerEvent, "Event", ContainerEventIndex))
+	containerAttr.ipAddress = toString(columns.value(containerEvent, "IPAddress", ContainerIPAddressIndex))
+	containerAttr.tags = toString(columns.value(containerEvent, "Tags", ContainerTagsIndex))
+	containerAttr.attributes = columns.attributes(containerEvent, "")
 
 	return &containerAttr
 }
 
-func extractFlowEventAttributes(flowEvent []interface{}) *FlowEvents {
+func extractFlowEventAttributes(columns columnIndex, flowEvent []interface{}) *FlowEvents {
 	var flowAttr FlowEvents
 
-	if value := flowEvent[FlowTimestampIndex]; value != nil {
-		flowAttr.timestamp = value.(string)
+	flowAttr.timestamp = toString(columns.value(flowEvent, "time", FlowTimestampIndex))
+	flowAttr.contextID = toString(columns.value(flowEvent, "ContextID", -1))
+	flowAttr.srcID = toString(columns.value(flowEvent, "SourceID", FlowSourceIDIndex))
+	flowAttr.srcIP = toString(columns.value(flowEvent, "SourceIP", FlowSourceIPIndex))
+	flowAttr.dstID = toString(columns.value(flowEvent, "DestinationID", FlowDestinationIDIndex))
+	flowAttr.dstIP = toString(columns.value(flowEvent, "DestinationIP", FlowDestinationIPIndex))
+	flowAttr.dstPort = toInt(columns.value(flowEvent, "DestinationPort", FlowDestinationPortIndex))
+	flowAttr.counter = toInt(columns.value(flowEvent, "Counter", FlowCounterIndex))
+	flowAttr.action = toString(columns.value(flowEvent, "Action", FlowActionIndex))
+	flowAttr.tags = toString(columns.value(flowEvent, "Tags", FlowTagsIndex))
+	flowAttr.policyID = toString(columns.value(flowEvent, "PolicyID", -1))
+	flowAttr.dropReason = toString(columns.value(flowEvent, "DropReason", -1))
+	flowAttr.srcType = endpointType(columns.value(flowEvent, "SourceType", -1))
+	flowAttr.dstType = endpointType(columns.value(flowEvent, "DestinationType", -1))
+	flowAttr.srcAttributes = columns.attributes(flowEvent, influxdb.SourcePrefix)
+	flowAttr.dstAttributes = columns.attributes(flowEvent, influxdb.DestinationPrefix)
+
+	return &flowAttr
+}
+
+// endpointType returns the type of a flow endpoint from its SourceType or
+// DestinationType. The collector writes the number of the collector type, the
+// flows written before hold the name of the type instead.
+func endpointType(value interface{}) int {
+
+	switch v := value.(type) {
+	case nil:
+		return endpointTypeUnknown
+	case string:
+		if v == endpointTypePUName {
+			return endpointTypePU
+		}
+		if _, err := strconv.Atoi(v); err != nil {
+			return endpointTypeExternal
+		}
+	}
+
+	if toInt(value) == int(collector.EnpointTypePU) {
+		return endpointTypePU
+	}
+
+	return endpointTypeExternal
+}
+
+// addFlow records a flow on the link, on its destination port and on the policy that decided it
+func (l *Link) addFlow(port int, action string, policyID string, dropReason string, count int, timestamp time.Time) {
+
+	// Records written without a counter stand for a single flow
+	if count <= 0 {
+		count = 1
 	}
-	if value := flowEvent[FlowSourceIDIndex]; value != nil {
-		flowAttr.srcID = value.(string)
+
+	l.FlowCount += count
+	if action == FlowAccept {
+		l.AcceptedCount += count
+	} else {
+		l.RejectedCount += count
 	}
-	if value := flowEvent[FlowSourceIPIndex]; value != nil {
-		flowAttr.srcIP = value.(string)
+
+	if l.FirstSeen.IsZero() || timestamp.Before(l.FirstSeen) {
+		l.FirstSeen = timestamp
 	}
-	if value := flowEvent[FlowDestinationIDIndex]; value != nil {
-		flowAttr.dstID = value.(string)
+	if timestamp.After(l.LastSeen) {
+		l.LastSeen = timestamp
 	}
-	if value := flowEvent[FlowDestinationIPIndex]; value != nil {
-		flowAttr.dstIP = value.(string)
+
+	l.policy(action, policyID, dropReason).FlowCount += count
+
+	if port <= 0 {
+		return
 	}
-	if value := flowEvent[FlowActionIndex]; value != nil {
-		flowAttr.action = value.(string)
+
+	p := l.port(port, action)
+	p.Action = nextAction(p.Action, action)
+	p.addFlow(action, count)
+}
+
+// nextAction returns the action of a link or port after a flow with the given action.
+// Only the flows rejected after accepted ones make it FlowNowRejected, otherwise
+// the action of the latest flow is kept.
+func nextAction(current string, action string) string {
+
+	if action == FlowReject && (current == FlowAccept || current == FlowNowRejected) {
+		return FlowNowRejected
 	}
-	if value := flowEvent[FlowTagsIndex]; value != nil {
-		flowAttr.tags = value.(string)
+
+	return action
+}
+
+// port returns the entry of the given destination port, creating it with the
+// given action if needed. Ports are kept sorted.
+func (l *Link) port(port int, action string) *LinkPort {
+
+	i := sort.Search(len(l.Ports), func(i int) bool {
+		return l.Ports[i].Port >= port
+	})
+
+	if i < len(l.Ports) && l.Ports[i].Port == port {
+		return &l.Ports[i]
 	}
 
-	return &flowAttr
+	l.Ports = append(l.Ports, LinkPort{})
+	copy(l.Ports[i+1:], l.Ports[i:])
+	l.Ports[i] = LinkPort{Port: port, Action: action}
+
+	return &l.Ports[i]
+}
+
+// policy returns the entry of the given decision, creating it if needed
+func (l *Link) policy(action string, policyID string, dropReason string) *LinkPolicy {
+
+	for i := range l.Policies {
+		p := &l.Policies[i]
+		if p.Action == action && p.PolicyID == policyID && p.DropReason == dropReason {
+			return p
+		}
+	}
+
+	l.Policies = append(l.Policies, LinkPolicy{Action: action, PolicyID: policyID, DropReason: dropReason})
+
+	return &l.Policies[len(l.Policies)-1]
+}
+
+func (p *LinkPort) addFlow(action string, count int) {
+
+	p.FlowCount += count
+	if action == FlowAccept {
+		p.AcceptedCount += count
+	} else {
+		p.RejectedCount += count
+	}
 }
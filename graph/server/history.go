@@ -0,0 +1,155 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// historyCache keeps the graphs built for past time windows
+type historyCache struct {
+	entries map[string]*historyEntry
+	size    int
+	ttl     time.Duration
+
+	sync.Mutex
+}
+
+type historyEntry struct {
+	graphData *GraphData
+	expires   time.Time
+}
+
+func newHistoryCache(size int, ttl time.Duration) *historyCache {
+
+	return &historyCache{
+		entries: make(map[string]*historyEntry),
+		size:    size,
+		ttl:     ttl,
+	}
+}
+
+func (c *historyCache) get(key string) (*GraphData, bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.graphData, true
+}
+
+func (c *historyCache) add(key string, graphData *GraphData) {
+
+	if c.size <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		// Evict the entry expiring first
+		var oldest string
+		for k, entry := range c.entries {
+			if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+
+	c.entries[key] = &historyEntry{graphData: graphData, expires: now.Add(c.ttl)}
+}
+
+// windowQuery restricts a query to the points stored within a time window.
+// A zero start leaves the window open on the past.
+func windowQuery(query string, starttime time.Time, endtime time.Time) string {
+
+	end := "'" + endtime.UTC().Format(time.RFC3339Nano) + "'"
+	if starttime.IsZero() {
+		return query + " WHERE time <= " + end
+	}
+
+	return query + " WHERE time >= '" + starttime.UTC().Format(time.RFC3339Nano) + "' AND time <= " + end
+}
+
+// historicalGraph builds the graph as it was between starttime and endtime.
+// The nodes are the pus started before endtime and not deleted before starttime,
+// the links are the flows reported within the window. Only the windows ended
+// for longer than the ingestion lag are cached.
+func (g *Graph) historicalGraph(starttime time.Time, endtime time.Time) (*GraphData, error) {
+
+	if endtime.IsZero() {
+		endtime = time.Now()
+	}
+
+	if !starttime.IsZero() && endtime.Before(starttime) {
+		return nil, fmt.Errorf("Invalid Time Window %s is before %s", endtime, starttime)
+	}
+
+	key := strconv.FormatInt(starttime.UnixNano(), 10) + "-" + strconv.FormatInt(endtime.UnixNano(), 10)
+	if graphData, ok := g.history.get(key); ok {
+		return graphData, nil
+	}
+
+	zap.L().Info("Building graph for time window", zap.Time("start", starttime), zap.Time("end", endtime))
+
+	// The window is built in its own graph so that the live state is not modified
+	window := &Graph{
+		httpClient:         g.httpClient,
+		dbname:             g.dbname,
+		nodeMap:            make(map[string]*Node),
+		linkMap:            make(map[LinkID]*Link),
+		externalMap:        make(map[string]*Node),
+		externalDetail:     g.externalDetail,
+		externalCIDRPrefix: g.externalCIDRPrefix,
+		windowStart:        starttime,
+	}
+
+	containers, err := window.executeQuery(windowQuery(ContainerEventsQuery, time.Time{}, endtime))
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving Container Events %s", err)
+	}
+
+	if err = window.applyContainerEvents(containers); err != nil {
+		return nil, err
+	}
+
+	flows, err := window.executeQuery(windowQuery(FlowEventsQuery, starttime, endtime))
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving Flow Events %s", err)
+	}
+
+	if err = window.applyFlowEvents(flows); err != nil {
+		return nil, fmt.Errorf("Generating Link %s", err)
+	}
+
+	graphData := window.populateNodesAndLinks()
+
+	// The windows that are not over, or that can still get late events, are built again
+	if endtime.Before(time.Now().Add(-ingestLag)) {
+		g.history.add(key, graphData)
+	}
+
+	return graphData, nil
+}
+
+// keepsDeletion tells if a pu deleted at the given time is removed from the graph.
+// Graphs built for a time window keep the pus deleted during the window.
+func (g *Graph) keepsDeletion(deleted time.Time) bool {
+
+	return g.windowStart.IsZero() || deleted.Before(g.windowStart)
+}
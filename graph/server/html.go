@@ -6,6 +6,7 @@ const js = `
 <style>
     .link {
         stroke: #ccc;
+        stroke-width: 2px;
     }
 
     #accept {
@@ -38,6 +39,53 @@ const js = `
         stroke-width: 1.5px;
     }
 
+    .node.external circle {
+        fill: #4682b4;
+    }
+
+    .node.added circle {
+        stroke: #2ca02c;
+        stroke-width: 4px;
+    }
+
+    .node.removed circle {
+        opacity: 0.4;
+        stroke: #d62728;
+        stroke-width: 4px;
+    }
+
+    .link.added {
+        stroke-dasharray: 8, 2;
+    }
+
+    .link.removed {
+        opacity: 0.4;
+        stroke-dasharray: 2, 4;
+    }
+
+    .link.changed {
+        stroke-dasharray: 10, 4, 2, 4;
+    }
+
+    .link.newlyrejected {
+        stroke: red !important;
+        stroke-dasharray: 6, 3;
+    }
+
+    .link.newlyaccepted {
+        stroke: green !important;
+        stroke-dasharray: 6, 3;
+    }
+
+    .node.anomaly circle {
+        stroke: #ff7f0e;
+        stroke-width: 4px;
+    }
+
+    .node.group circle {
+        fill: #9467bd;
+    }
+
     .node text {
         pointer-events: none;
         font: 9px "Lucida Console", Monaco, monospace;
@@ -50,6 +98,14 @@ const js = `
         margin-bottom: 1px;
     }
 
+    .selector {
+        margin-left: 11px;
+        width: 220px;
+        border: 1px solid black;
+        border-radius: 4px;
+        margin-bottom: 1px;
+    }
+
     .submit {
         border: 1px solid black;
         border-radius: 4px;
@@ -83,12 +139,34 @@ const js = `
             <input name="starttime" class="starttime" type="datetime-local" step="1">
             <br> End Time:
             <input name="endtime" class="endtime" type="datetime-local" step="1">
+            <br> Compare Start:
+            <input name="beforestart" class="starttime" type="datetime-local" step="1">
+            <br> Compare End:
+            <input name="beforeend" class="endtime" type="datetime-local" step="1">
             <br> Namespace:
             <input name="namespace" class="namespace" type="text">
+            <br> Selector:
+            <input name="selector" class="selector" type="text" placeholder="app=web,env in (prod,staging)">
+            <br> Neighbours:
+            <input name="neighbours" type="checkbox" value="true">
+            <br> Group By:
+            <select name="groupby" class="groupby">
+                <option value="">none</option>
+                <option value="namespace">namespace</option>
+                <option value="workload">workload</option>
+                <option value="app">app</option>
+            </select>
             <br>
             <input type="submit" class="submit" value="Filter">
         </div>
     </form>
+    <form name="simulation" onsubmit="simulate(); return false;">
+        <div class="set">
+            Proposed Policies:
+            <input name="policies" type="file" accept=".yaml,.yml" multiple>
+            <input type="submit" class="submit" value="Simulate">
+        </div>
+    </form>
     <script src="//d3js.org/d3.v3.min.js"></script>
     <script>
         var width = 1000,
@@ -103,149 +181,350 @@ const js = `
             .distance(200)
             .charge(-250)
             .size([850, 500]);
-        d3.json({{.Address}}, function(error, json) {
-            if (error) throw error;
-            var edges = [];
-            json.links.forEach(function(e) {
-                var sourceNode = json.nodes.filter(function(n) {
-                        return n.id === e.source;
-                    })[0],
-                    targetNode = json.nodes.filter(function(n) {
-                        return n.id === e.target;
-                    })[0];
-                if (typeof sourceNode != "undefined" && typeof targetNode != "undefined") {
-                    edges.push({
-                        source: sourceNode,
-                        target: targetNode,
-                        time: e.time,
-                        action: e.action,
-                        namespace: e.namespace
-                    });
+        svg.append("svg:defs").selectAll("marker")
+            .data(["accept", "reject", "nowrejected"])
+            .enter().append("svg:marker")
+            .attr("id", String)
+            .attr("viewBox", "0 -5 10 10")
+            .attr("refX", 0)
+            .attr("refY", 0)
+            .attr("markerWidth", 6)
+            .attr("markerHeight", 6)
+            .attr("orient", "auto")
+            .append("svg:path")
+            .attr("d", "M0,-5L10,0L0,5");
+        var linkGroup = svg.append("g"),
+            nodeGroup = svg.append("g");
+        var nodes = [],
+            edges = [],
+            nodesById = {},
+            edgesByKey = {};
+        var link = linkGroup.selectAll(".link"),
+            node = nodeGroup.selectAll(".node");
+        var actionColors = {
+            accept: "green",
+            reject: "red",
+            nowrejected: "orange"
+        };
+        force.on("tick", tick);
+
+        // Nodes and edges are updated in place so that they keep their position in the layout
+        function upsertNode(n) {
+            var existing = nodesById[n.id];
+            if (existing) {
+                for (var k in n) {
+                    existing[k] = n[k];
+                }
+                return;
+            }
+            nodes.push(n);
+            nodesById[n.id] = n;
+        }
+
+        function removeNode(id) {
+            delete nodesById[id];
+            nodes = nodes.filter(function(n) {
+                return n.id !== id;
+            });
+            edges.filter(function(e) {
+                return e.source.id === id || e.target.id === id;
+            }).forEach(removeLink);
+        }
+
+        function upsertLink(e) {
+            var sourceNode = nodesById[e.source],
+                targetNode = nodesById[e.target];
+            if (typeof sourceNode == "undefined" || typeof targetNode == "undefined") {
+                return;
+            }
+            var key = e.source + "|" + e.target;
+            var edge = edgesByKey[key];
+            if (!edge) {
+                edge = {
+                    key: key,
+                    source: sourceNode,
+                    target: targetNode
+                };
+                edges.push(edge);
+                edgesByKey[key] = edge;
+            }
+            edge.time = e.time;
+            edge.action = e.action;
+            edge.namespace = e.namespace;
+            edge.ports = e.ports || [];
+            edge.policies = e.policies || [];
+            edge.flowCount = e.flowCount || 0;
+            edge.acceptedCount = e.acceptedCount || 0;
+            edge.rejectedCount = e.rejectedCount || 0;
+            edge.firstSeen = e.firstSeen;
+            edge.lastSeen = e.lastSeen;
+            edge.diff = e.diff || "";
+            edge.previousAction = e.previousAction;
+            edge.simulated = e.simulated || "";
+        }
+
+        function removeLink(e) {
+            var key = (e.key) ? e.key : e.source + "|" + e.target;
+            delete edgesByKey[key];
+            edges = edges.filter(function(edge) {
+                return edge.key !== key;
+            });
+        }
+
+        function setGraph(json) {
+            var previous = nodesById;
+            nodes = [];
+            edges = [];
+            nodesById = {};
+            edgesByKey = {};
+            (json.nodes || []).forEach(function(n) {
+                if (previous[n.id]) {
+                    n.x = previous[n.id].x;
+                    n.y = previous[n.id].y;
+                    n.px = previous[n.id].px;
+                    n.py = previous[n.id].py;
                 }
+                upsertNode(n);
+            });
+            (json.links || []).forEach(upsertLink);
+            render();
+        }
+
+        function applyDelta(delta) {
+            (delta.removedLinks || []).forEach(removeLink);
+            (delta.removedNodes || []).forEach(removeNode);
+            (delta.nodes || []).forEach(upsertNode);
+            (delta.links || []).forEach(upsertLink);
+            render();
+        }
+
+        function render() {
+            force.nodes(nodes).links(edges);
+
+            // Edges get wider and more saturated with the number of flows
+            var maxCount = d3.max(edges, function(d) {
+                return d.flowCount;
+            }) || 1;
+            var widthScale = d3.scale.log()
+                .domain([1, maxCount + 1])
+                .range([1.5, 8]);
+            var intensityScale = d3.scale.log()
+                .domain([1, maxCount + 1])
+                .range([0.3, 1]);
+
+            link = link.data(edges, function(d) {
+                return d.key;
             });
-            force
-                .nodes(json.nodes)
-                .links(edges)
-                .on("tick", tick)
-                .start();
-            var marker = svg.append("svg:defs").selectAll("marker")
-                .data(["accept", "reject", "nowrejected"])
-                .enter().append("svg:marker")
-                .attr("id", String)
-                .attr("viewBox", "0 -5 10 10")
-                .attr("refX", 0)
-                .attr("refY", 0)
-                .attr("markerWidth", 6)
-                .attr("markerHeight", 6)
-                .attr("orient", "auto")
-                .append("svg:path")
-                .attr("d", "M0,-5L10,0L0,5");
-            var link = svg.selectAll(".link")
-                .data(edges)
-                .enter().append("polyline")
-                .attr("class", function(d) {
-                    return "link " + d.action;
+            link.exit().remove();
+            link.enter().append("polyline")
+                .append("title");
+            link.attr("class", function(d) {
+                    return "link " + d.action + " " + d.diff + " " + d.simulated;
                 })
                 .attr("marker-mid", function(d) {
                     return "url(#" + d.action + ")";
+                })
+                .style("stroke-width", function(d) {
+                    return widthScale(d.flowCount + 1) + "px";
+                })
+                .style("stroke", function(d) {
+                    return d3.interpolateRgb("#ddd", actionColors[d.action] || "#ccc")(intensityScale(d.flowCount + 1));
+                });
+            link.select("title")
+                .text(function(d) {
+                    return d.source.name + " -> " + d.target.name +
+                        (d.diff ? "\n" + d.diff + (d.previousAction ? " from " + d.previousAction : "") : "") +
+                        (d.simulated ? "\nwith proposed policies: " + d.simulated : "") +
+                        "\nflows: " + d.flowCount + " (accepted " + d.acceptedCount + ", rejected " + d.rejectedCount + ")" +
+                        "\nfirst seen: " + d.firstSeen + "\nlast seen: " + d.lastSeen + "\n" +
+                        d.ports.map(function(p) {
+                            return p.port + " (" + p.action + ", " + p.flowCount + " flows)";
+                        }).join("\n") + "\n" +
+                        d.policies.map(function(p) {
+                            return "policy " + (p.policyID || "none") + ": " + p.action +
+                                (p.dropReason ? " (" + p.dropReason + ")" : "") + ", " + p.flowCount + " flows";
+                        }).join("\n");
                 });
-            var node = svg.selectAll(".node")
-                .data(json.nodes)
-                .enter().append("g")
-                .attr("class", "node")
+
+            node = node.data(nodes, function(d) {
+                return d.id;
+            });
+            node.exit().remove();
+            var nodeEnter = node.enter().append("g")
                 .on("mouseover", mouseover)
                 .on("mouseout", mouseout)
+                .on("dblclick", expand)
                 .call(force.drag);
-            node.append("circle")
-                .attr("r", radius);
-            node.append("title")
+            nodeEnter.append("circle");
+            nodeEnter.append("title");
+            nodeEnter.append("text")
+                .attr("dx", 10)
+                .attr("dy", ".35em");
+            node.attr("class", function(d) {
+                return "node " + d.type + " " + (d.diff || "") + (d.anomalies ? " anomaly" : "");
+            });
+            node.select("circle")
+                .attr("r", nodeRadius);
+            node.select("title")
                 .text(function(d) {
-                    return d.id;
+                    return d.id + (d.diff ? " (" + d.diff + ")" : "") +
+                        (d.members ? "\n" + d.members.length + " pus, double click to expand" : "") +
+                        (d.anomalies ? "\nanomalies:\n" + d.anomalies.join("\n") : "");
                 });
-            node.append("text")
-                .attr("dx", 10)
-                .attr("dy", ".35em")
+            node.select("text")
                 .text(function(d) {
                     return d.name
                 });
 
-            var moveItems = (function() {
-                var todoNode = 0;
-                var todoLink = 0;
-                var MAX_NODES = 300;
-                var MAX_LINKS = MAX_NODES / 2;
+            force.start();
+        }
 
-                var restart = false;
+        var moveItems = (function() {
+            var todoNode = 0;
+            var todoLink = 0;
+            var MAX_NODES = 300;
+            var MAX_LINKS = MAX_NODES / 2;
 
-                function moveSomeNodes() {
-                    var n;
-                    var goal = Math.min(todoNode + MAX_NODES, node[0].length);
+            var restart = false;
 
-                    for (var i = todoNode; i < goal; i++) {
-                        n = node[0][i];
-                        n.setAttribute("transform", "translate(" + Math.max(radius, Math.min(width - radius, n.__data__.x)) + "," +
-                            Math.max(radius, Math.min(height - radius, n.__data__.y)) + ")");
-                    }
+            function moveSomeNodes() {
+                var n;
+                var goal = Math.min(todoNode + MAX_NODES, node[0].length);
 
-                    todoNode = goal;
-                    requestAnimationFrame(moveSome)
+                for (var i = todoNode; i < goal; i++) {
+                    n = node[0][i];
+                    if (!n) continue;
+                    n.setAttribute("transform", "translate(" + Math.max(radius, Math.min(width - radius, n.__data__.x)) + "," +
+                        Math.max(radius, Math.min(height - radius, n.__data__.y)) + ")");
                 }
 
-                function moveSomeLinks() {
-                    var l;
-                    var goal = Math.min(todoLink + MAX_LINKS, link[0].length);
+                todoNode = goal;
+                requestAnimationFrame(moveSome)
+            }
 
-                    for (var i = todoLink; i < goal; i++) {
-                        l = link[0][i];
-                        l.setAttribute("points", l.__data__.source.x + "," + l.__data__.source.y + " " +
-                            (l.__data__.source.x + l.__data__.target.x) / 2 + "," + (l.__data__.source.y + l.__data__.target.y) / 2 + " " +
-                            l.__data__.target.x + "," + l.__data__.target.y);
-                    }
+            function moveSomeLinks() {
+                var l;
+                var goal = Math.min(todoLink + MAX_LINKS, link[0].length);
 
-                    todoLink = goal;
-                    requestAnimationFrame(moveSome)
+                for (var i = todoLink; i < goal; i++) {
+                    l = link[0][i];
+                    if (!l) continue;
+                    l.setAttribute("points", l.__data__.source.x + "," + l.__data__.source.y + " " +
+                        (l.__data__.source.x + l.__data__.target.x) / 2 + "," + (l.__data__.source.y + l.__data__.target.y) / 2 + " " +
+                        l.__data__.target.x + "," + l.__data__.target.y);
                 }
 
-                function moveSome() {
-                    if (todoNode < node[0].length)
-                        moveSomeNodes()
+                todoLink = goal;
+                requestAnimationFrame(moveSome)
+            }
+
+            function moveSome() {
+                if (todoNode < node[0].length)
+                    moveSomeNodes()
+                else {
+                    if (todoLink < link[0].length)
+                        moveSomeLinks()
                     else {
-                        if (todoLink < link[0].length)
-                            moveSomeLinks()
-                        else {
-                            if (restart) {
-                                restart = false;
-                                todoNode = 0;
-                                todoLink = 0;
-                                requestAnimationFrame(moveSome);
-                            }
+                        if (restart) {
+                            restart = false;
+                            todoNode = 0;
+                            todoLink = 0;
+                            requestAnimationFrame(moveSome);
                         }
                     }
                 }
+            }
+
+            return function moveItems() {
+                if (!restart) {
+                    restart = true;
+                    requestAnimationFrame(moveSome);
+                }
+            };
+        })();
+
+        function tick() {
+            moveItems();
+        }
+
+        // Groups get larger with the number of pus they hold
+        function nodeRadius(d) {
+            return d.members ? radius + Math.min(12, 2 * Math.sqrt(d.members.length)) : radius;
+        }
+
+        function mouseover() {
+            d3.select(this).select("circle").transition()
+                .duration(750)
+                .attr("r", function(d) {
+                    return nodeRadius(d) + 3;
+                });
+        }
+
+        function mouseout() {
+            d3.select(this).select("circle").transition()
+                .duration(750)
+                .attr("r", nodeRadius);
+        }
+
+        // Expanding a group reloads the graph with the pus of the group
+        function expand(d) {
+            if (d.type !== "group") return;
+            var search = window.location.search ? window.location.search + "&" : "?";
+            window.location.search = search + "expand=" + encodeURIComponent(d.id);
+        }
 
-                return function moveItems() {
-                    if (!restart) {
-                        restart = true;
-                        requestAnimationFrame(moveSome);
+        // The proposed policies are evaluated against the flows of the selected time window
+        // and the links whose flows would change are highlighted
+        function simulate() {
+            var files = document.forms.simulation.policies.files;
+            if (!files.length) return;
+            var documents = [],
+                pending = files.length;
+            Array.prototype.forEach.call(files, function(file, i) {
+                var reader = new FileReader();
+                reader.onload = function() {
+                    documents[i] = reader.result;
+                    if (--pending === 0) {
+                        post(documents.join("\n---\n"));
                     }
                 };
-            })();
-
-            function tick() {
-                moveItems();
-            }
+                reader.readAsText(file);
+            });
 
-            function mouseover() {
-                d3.select(this).select("circle").transition()
-                    .duration(750)
-                    .attr("r", 11);
+            function post(body) {
+                var query = "?format=graph";
+                ["starttime", "endtime"].forEach(function(param) {
+                    var value = document.forms.graphoptions[param].value;
+                    if (value) query += "&" + param + "=" + encodeURIComponent(value);
+                });
+                d3.xhr({{.SimulateAddress}} + query)
+                    .header("Content-Type", "application/yaml")
+                    .post(body, function(error, xhr) {
+                        if (error) {
+                            alert(error.responseText || "Simulation failed");
+                            return;
+                        }
+                        if (source) source.close();
+                        setGraph(JSON.parse(xhr.responseText));
+                    });
             }
+        }
 
-            function mouseout() {
-                d3.select(this).select("circle").transition()
-                    .duration(750)
-                    .attr("r", radius);
-            }
-        });
+        var source;
+        if ({{.Stream}} && window.EventSource) {
+            // The live graph is sent as a snapshot followed by the changes of every generation
+            source = new EventSource({{.StreamAddress}});
+            source.addEventListener("snapshot", function(e) {
+                setGraph(JSON.parse(e.data));
+            });
+            source.addEventListener("delta", function(e) {
+                applyDelta(JSON.parse(e.data));
+            });
+        } else {
+            d3.json({{.Address}}, function(error, json) {
+                if (error) throw error;
+                setGraph(json);
+            });
+        }
     </script>
 `
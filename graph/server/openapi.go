@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aporeto-inc/trireme-statistics/version"
+)
+
+// OpenAPI returns the OpenAPI 3 document describing the routes of the API
+func (a *API) OpenAPI() map[string]interface{} {
+
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+			},
+		},
+	}
+
+	paths := map[string]interface{}{}
+	for path, methods := range a.routes {
+		operations := map[string]interface{}{}
+		for method, route := range methods {
+			operation := map[string]interface{}{
+				"summary":     route.Summary,
+				"operationId": strings.ToLower(method) + operationName(path),
+				"responses": map[string]interface{}{
+					strconv.Itoa(route.Status): successResponse(route),
+					"400":                      errorResponse,
+					"500":                      errorResponse,
+				},
+			}
+
+			if len(route.Parameters) > 0 {
+				var parameters []interface{}
+				for _, p := range route.Parameters {
+					parameters = append(parameters, p.openAPI())
+				}
+				operation["parameters"] = parameters
+			}
+
+			if route.RequestBody != "" {
+				operation["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content": map[string]interface{}{
+						route.RequestBody: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+					},
+				}
+			}
+
+			operations[strings.ToLower(method)] = operation
+		}
+		paths[path] = operations
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "trireme-graph",
+			"version": version.VERSION,
+		},
+		"servers": []interface{}{map[string]interface{}{"url": APIPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"status", "error", "message"},
+					"properties": map[string]interface{}{
+						"status":  map[string]interface{}{"type": "integer"},
+						"error":   map[string]interface{}{"type": "string"},
+						"message": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func successResponse(route *APIRoute) map[string]interface{} {
+
+	response := map[string]interface{}{"description": http.StatusText(route.Status)}
+	if len(route.Responses) > 0 {
+		content := map[string]interface{}{}
+		for _, contentType := range route.Responses {
+			content[contentType] = map[string]interface{}{}
+		}
+		response["content"] = content
+	}
+
+	return response
+}
+
+// operationName returns the camel case name of a path
+func operationName(path string) string {
+
+	var name string
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '.' }) {
+		name += strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	return name
+}
+
+func (p *APIParameter) openAPI() map[string]interface{} {
+
+	schema := map[string]interface{}{"type": p.Type}
+	if p.Type == ParamDateTime {
+		schema = map[string]interface{}{"type": ParamString, "format": ParamDateTime}
+	}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+	if p.Repeated {
+		schema = map[string]interface{}{"type": "array", "items": schema}
+	}
+
+	return map[string]interface{}{
+		"name":        p.Name,
+		"in":          "query",
+		"description": p.Description,
+		"required":    p.Required,
+		"schema":      schema,
+	}
+}
+
+// GetOpenAPI is the handler returning the OpenAPI document of the API
+func (a *API) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.OpenAPI()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"time"
+
+	"github.com/aporeto-inc/trireme-statistics/anomaly"
+)
+
+// Option is used to configure the optional features of the graph
+type Option func(*Graph)
+
+// OptionExternalDetail sets how endpoints outside of Trireme are grouped into nodes.
+// detail is one of ip, cidr, fqdn or world. prefix is the network prefix length
+// used to group IPv4 addresses when no CIDR label is known.
+func OptionExternalDetail(detail string, prefix int) Option {
+
+	return func(g *Graph) {
+		g.externalDetail = detail
+		g.externalCIDRPrefix = prefix
+	}
+}
+
+// OptionHistoryCache sets how many graphs built for past time windows are cached
+// and for how long. A size of 0 disables the cache.
+func OptionHistoryCache(size int, ttl time.Duration) Option {
+
+	return func(g *Graph) {
+		g.history = newHistoryCache(size, ttl)
+	}
+}
+
+// OptionRollups aggregates the flows of the live graph per minute for the given
+// retention. Rankings over windows within the retention are computed from these
+// rollups instead of the flows stored in influxdb.
+func OptionRollups(retention time.Duration) Option {
+
+	return func(g *Graph) {
+		g.rollups = newRollups(retention)
+	}
+}
+
+// OptionAnomalyDetector scores the flows of the live graph against the baseline of
+// their workloads. The anomalies are written to the Anomalies measurement and shown
+// on the nodes of the graph.
+func OptionAnomalyDetector(detector *anomaly.Detector) Option {
+
+	return func(g *Graph) {
+		g.detector = detector
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/aporeto-inc/trireme-statistics/policies"
+)
+
+const (
+	// PolicyFormatJSON returns the generated policies and the unexpressed flows as JSON
+	PolicyFormatJSON = "json"
+	// PolicyFormatNetworkPolicy returns the Kubernetes NetworkPolicies as YAML
+	PolicyFormatNetworkPolicy = "networkpolicy"
+	// PolicyFormatTrireme returns the Trireme rule sets as YAML
+	PolicyFormatTrireme = "trireme"
+	// SimulationFormatGraph returns the graph with the changes of a simulation marked
+	SimulationFormatGraph = "graph"
+
+	// maxPolicySize is the largest policy document accepted for simulation
+	maxPolicySize = 4 << 20
+)
+
+// GraphFlows returns the flows of the graph, one per link, port and decision.
+// The flows of a link without destination port are returned with port 0.
+func GraphFlows(graphData *GraphData) []policies.Flow {
+
+	nodes := make(map[string]Node, len(graphData.Nodes))
+	for _, node := range graphData.Nodes {
+		nodes[node.ContextID] = node
+	}
+
+	var flows []policies.Flow
+	for _, link := range graphData.Links {
+		source := policyEndpoint(link.Source, nodes)
+		destination := policyEndpoint(link.Target, nodes)
+
+		accepted, rejected := link.AcceptedCount, link.RejectedCount
+		for _, port := range link.Ports {
+			if port.AcceptedCount > 0 {
+				flows = append(flows, policies.Flow{Source: source, Destination: destination, Port: port.Port, Count: port.AcceptedCount})
+			}
+			if port.RejectedCount > 0 {
+				flows = append(flows, policies.Flow{Source: source, Destination: destination, Port: port.Port, Count: port.RejectedCount, Rejected: true})
+			}
+			accepted -= port.AcceptedCount
+			rejected -= port.RejectedCount
+		}
+
+		// The flows without destination port are counted on the link only
+		if accepted > 0 {
+			flows = append(flows, policies.Flow{Source: source, Destination: destination, Count: accepted})
+		}
+		if rejected > 0 {
+			flows = append(flows, policies.Flow{Source: source, Destination: destination, Count: rejected, Rejected: true})
+		}
+	}
+
+	return flows
+}
+
+// policyEndpoint returns the end of a flow described by the node of the graph
+func policyEndpoint(id string, nodes map[string]Node) policies.Endpoint {
+
+	node, ok := nodes[id]
+	if !ok || node.Type == NodeTypeExternal {
+		ip := node.IPAddress
+		if ip == "" {
+			ip = strings.TrimPrefix(id, externalNodePrefix)
+		}
+		return policies.Endpoint{ID: id, Name: node.PodName, IP: ip, External: true}
+	}
+
+	return policies.Endpoint{
+		ID:        node.ContextID,
+		Name:      node.PodName,
+		Namespace: node.Namespace,
+		IP:        node.IPAddress,
+		Labels:    node.Labels,
+		Workload:  podWorkload(&node),
+	}
+}
+
+// GetPolicies is the handler generating the network policies allowing the flows
+// accepted to and from the pus of a namespace during a time window
+func (g *Graph) GetPolicies(w http.ResponseWriter, r *http.Request) {
+
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		http.Error(w, "Missing namespace", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = PolicyFormatJSON
+	case PolicyFormatJSON, PolicyFormatNetworkPolicy, PolicyFormatTrireme:
+	default:
+		http.Error(w, "Unknown format "+format, http.StatusBadRequest)
+		return
+	}
+
+	graphData, ok := g.windowGraph(w, r)
+	if !ok {
+		return
+	}
+
+	result := policies.Generate(namespace, GraphFlows(graphData))
+
+	var data []byte
+	var err error
+	switch format {
+	case PolicyFormatNetworkPolicy:
+		w.Header().Set("Content-Type", "application/yaml")
+		data, err = result.NetworkPoliciesYAML()
+	case PolicyFormatTrireme:
+		w.Header().Set("Content-Type", "application/yaml")
+		data, err = result.RuleSetsYAML()
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		data, err = json.Marshal(result)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(data); err != nil {
+		zap.L().Debug("Writing policies", zap.Error(err))
+	}
+}
+
+// windowGraph returns the graph of the time window given by starttime and endtime,
+// or the live graph. Errors are written to the response.
+func (g *Graph) windowGraph(w http.ResponseWriter, r *http.Request) (*GraphData, bool) {
+
+	if r.URL.Query().Get("starttime") == "" && r.URL.Query().Get("endtime") == "" {
+		return g.Snapshot(), true
+	}
+
+	window, err := parseWindow(r, "starttime", "endtime")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	graphData, err := g.historicalGraph(window[0], window[1])
+	if err != nil {
+		zap.L().Error("Building graph for time window", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return graphData, true
+}
+
+// SimulatePolicies is the handler evaluating the policies posted as YAML against the
+// flows of the time window given by starttime and endtime, or of the live graph.
+// With format=graph the graph is returned with the links whose flows change marked.
+func (g *Graph) SimulatePolicies(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Simulation requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != PolicyFormatJSON && format != SimulationFormatGraph {
+		http.Error(w, "Unknown format "+format, http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPolicySize))
+	if err != nil {
+		http.Error(w, "Reading policies "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	set, err := policies.ParsePolicies(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	graphData, ok := g.windowGraph(w, r)
+	if !ok {
+		return
+	}
+
+	simulation := policies.Simulate(set, GraphFlows(graphData))
+
+	w.Header().Set("Content-Type", "application/json")
+	if format == SimulationFormatGraph {
+		err = json.NewEncoder(w).Encode(SimulationOverlay(graphData, simulation))
+	} else {
+		err = json.NewEncoder(w).Encode(simulation)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// SimulationOverlay returns a copy of the graph with the links whose flows change
+// marked. Links with newly rejected flows are marked as such even if others are
+// newly accepted.
+func SimulationOverlay(graphData *GraphData, simulation *policies.Simulation) *GraphData {
+
+	changes := map[LinkID]string{}
+	for _, flow := range simulation.Flows {
+		id := LinkID{Source: flow.SourceID, Target: flow.DestinationID}
+		if changes[id] != policies.NewlyRejected {
+			changes[id] = flow.Change
+		}
+	}
+
+	overlay := &GraphData{Nodes: graphData.Nodes, Links: make([]Link, len(graphData.Links))}
+	for i, link := range graphData.Links {
+		link.Simulated = changes[link.id()]
+		overlay.Links[i] = link
+	}
+
+	return overlay
+}
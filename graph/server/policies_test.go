@@ -0,0 +1,82 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme-statistics/policies"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGraphFlows(t *testing.T) {
+
+	Convey("Given I convert a graph to flows", t, func() {
+		graphData := &GraphData{
+			Nodes: []Node{
+				{ContextID: "web", PodName: "web-1", Namespace: "default", Type: NodeTypePU, Labels: map[string]string{"app": "web"}},
+				{ContextID: "ext:10.1.0.0/24", PodName: "10.1.0.0/24", Type: NodeTypeExternal},
+			},
+			Links: []Link{
+				{Source: "ext:10.1.0.0/24", Target: "web", Ports: []LinkPort{
+					{Port: 80, Action: FlowAccept, FlowCount: 4, AcceptedCount: 4},
+					{Port: 22, Action: FlowReject, FlowCount: 2, RejectedCount: 2},
+				}},
+			},
+		}
+
+		flows := GraphFlows(graphData)
+
+		Convey("Then I should get the flows of every port and decision", func() {
+			So(len(flows), ShouldEqual, 2)
+			So(flows[1].Port, ShouldEqual, 22)
+			So(flows[1].Rejected, ShouldBeTrue)
+			So(flows[0].Rejected, ShouldBeFalse)
+			So(flows[0].Port, ShouldEqual, 80)
+			So(flows[0].Count, ShouldEqual, 4)
+			So(flows[0].Source.External, ShouldBeTrue)
+			So(flows[0].Source.IP, ShouldEqual, "10.1.0.0/24")
+			So(flows[0].Destination.Namespace, ShouldEqual, "default")
+			So(flows[0].Destination.Labels, ShouldResemble, map[string]string{"app": "web"})
+			So(flows[0].Destination.Workload, ShouldEqual, "web")
+		})
+
+		Convey("Then I should be able to overlay a simulation on the graph", func() {
+			overlay := SimulationOverlay(graphData, &policies.Simulation{Flows: []policies.SimulatedFlow{
+				{SourceID: "ext:10.1.0.0/24", DestinationID: "web", Port: 22, Change: policies.NewlyAccepted},
+				{SourceID: "ext:10.1.0.0/24", DestinationID: "web", Port: 80, Change: policies.NewlyRejected},
+			}})
+			So(overlay.Links[0].Simulated, ShouldEqual, policies.NewlyRejected)
+			So(graphData.Links[0].Simulated, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given I convert a graph with an accepted flow without destination port", t, func() {
+		graphData := &GraphData{
+			Nodes: []Node{
+				{ContextID: "web", PodName: "web-1", Namespace: "default", Type: NodeTypePU, Labels: map[string]string{"app": "web"}},
+				{ContextID: "db", PodName: "db-0", Namespace: "default", Type: NodeTypePU, Labels: map[string]string{"app": "db"}},
+			},
+			Links: []Link{
+				{Source: "web", Target: "db", FlowCount: 5, AcceptedCount: 5, Ports: []LinkPort{
+					{Port: 5432, Action: FlowAccept, FlowCount: 4, AcceptedCount: 4},
+				}},
+			},
+		}
+
+		flows := GraphFlows(graphData)
+
+		Convey("Then the flow should be returned with port 0", func() {
+			So(len(flows), ShouldEqual, 2)
+			So(flows[1].Port, ShouldBeZeroValue)
+			So(flows[1].Count, ShouldEqual, 1)
+			So(flows[1].Rejected, ShouldBeFalse)
+		})
+
+		Convey("Then the flow should be reported as not expressed", func() {
+			result := policies.Generate("default", flows)
+			So(len(result.Unexpressed), ShouldEqual, 1)
+			So(result.Unexpressed[0].Count, ShouldEqual, 1)
+			So(result.Unexpressed[0].Reason, ShouldEqual, "unknown destination port")
+		})
+	})
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// rollups aggregates the flows applied to the live graph into links per minute,
+// so that rankings over recent time windows do not query the database. They are
+// written by the generation goroutine and read by the handlers.
+type rollups struct {
+	retention time.Duration
+
+	// buckets holds the links of the flows of every minute, by the unix time of the minute
+	buckets map[int64]map[LinkID]*Link
+	// endpoints holds the name and namespace of the nodes of the links
+	endpoints map[string]TopEndpoint
+
+	// since is the start of the oldest minute kept. Flows before it were dropped.
+	since time.Time
+	// ready is set once the stored flows were replayed
+	ready bool
+
+	sync.Mutex
+}
+
+func newRollups(retention time.Duration) *rollups {
+
+	return &rollups{
+		retention: retention,
+		buckets:   make(map[int64]map[LinkID]*Link),
+		endpoints: make(map[string]TopEndpoint),
+	}
+}
+
+// add records a flow in the bucket of its minute
+func (r *rollups) add(flowAttr *FlowEvents, src TopEndpoint, dst TopEndpoint, timestamp time.Time) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	minute := timestamp.Truncate(time.Minute)
+	if minute.Before(r.since) {
+		return
+	}
+
+	bucket, ok := r.buckets[minute.Unix()]
+	if !ok {
+		bucket = make(map[LinkID]*Link)
+		r.buckets[minute.Unix()] = bucket
+	}
+
+	key := LinkID{Source: src.ID, Target: dst.ID}
+	link, ok := bucket[key]
+	if !ok {
+		link = &Link{Source: src.ID, Target: dst.ID, Action: flowAttr.action, Time: minute}
+		bucket[key] = link
+	} else {
+		link.Action = nextAction(link.Action, flowAttr.action)
+	}
+	link.addFlow(flowAttr.dstPort, flowAttr.action, flowAttr.policyID, flowAttr.dropReason, flowAttr.counter, timestamp)
+
+	r.endpoints[src.ID] = src
+	r.endpoints[dst.ID] = dst
+}
+
+// complete marks the stored flows as replayed and drops the minutes older than the retention
+func (r *rollups) complete(now time.Time) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.ready = true
+	r.since = now.Add(-r.retention).Truncate(time.Minute)
+	dropped := false
+	for minute := range r.buckets {
+		if time.Unix(minute, 0).Before(r.since) {
+			delete(r.buckets, minute)
+			dropped = true
+		}
+	}
+
+	if !dropped {
+		return
+	}
+
+	// Only the endpoints of the links of the remaining minutes are kept
+	endpoints := make(map[string]TopEndpoint, len(r.endpoints))
+	for _, bucket := range r.buckets {
+		for _, link := range bucket {
+			endpoints[link.Source] = r.endpoints[link.Source]
+			endpoints[link.Target] = r.endpoints[link.Target]
+		}
+	}
+	r.endpoints = endpoints
+}
+
+// covers tells if the rollups hold all the flows from the given time
+func (r *rollups) covers(starttime time.Time) bool {
+
+	r.Lock()
+	defer r.Unlock()
+
+	return r.ready && !starttime.Before(r.since)
+}
+
+// links returns the links of the minutes between starttime and endtime and their endpoints
+func (r *rollups) links(starttime time.Time, endtime time.Time) ([]Link, map[string]TopEndpoint) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	start := starttime.Truncate(time.Minute)
+
+	var links []Link
+	endpoints := map[string]TopEndpoint{}
+	for minute, bucket := range r.buckets {
+		t := time.Unix(minute, 0)
+		if t.Before(start) || t.After(endtime) {
+			continue
+		}
+
+		for _, link := range bucket {
+			copied := *link
+			// Ports and policies are updated in place by the next generations
+			copied.Ports = append([]LinkPort(nil), link.Ports...)
+			copied.Policies = append([]LinkPolicy(nil), link.Policies...)
+			links = append(links, copied)
+
+			endpoints[link.Source] = r.endpoints[link.Source]
+			endpoints[link.Target] = r.endpoints[link.Target]
+		}
+	}
+
+	return links, endpoints
+}
+
+// reset drops the rollups before the graph is rebuilt
+func (r *rollups) reset() {
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.buckets = make(map[int64]map[LinkID]*Link)
+	r.endpoints = make(map[string]TopEndpoint)
+	r.since = time.Time{}
+	r.ready = false
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/aporeto-inc/trireme-statistics/anomaly"
+)
+
+var windowParameters = []APIParameter{
+	{Name: "starttime", Type: ParamDateTime, Description: "Start of the time window (RFC3339)"},
+	{Name: "endtime", Type: ParamDateTime, Description: "End of the time window (RFC3339), now by default"},
+}
+
+// graphRoutes returns the routes of the API served by the graph
+func graphRoutes(g *Graph) []APIRoute {
+
+	exports := make([]string, 0, len(exportFormats))
+	for format := range exportFormats {
+		exports = append(exports, format)
+	}
+	sort.Strings(exports)
+
+	return []APIRoute{
+		{
+			Method:  http.MethodGet,
+			Path:    "/graph",
+			Summary: "Get the live graph, or the graph of a time window, filtered and grouped",
+			Parameters: append([]APIParameter{
+				{Name: "format", Type: ParamString, Description: "Export format", Enum: exports},
+				{Name: "namespace", Type: ParamString, Description: "Only keep the nodes and links of the namespace"},
+				{Name: "selector", Type: ParamString, Description: "Only keep the nodes matching the label selector"},
+				{Name: "neighbours", Type: ParamBoolean, Description: "Keep the neighbours of the selected nodes"},
+				{Name: "action", Type: ParamString, Description: "Only keep the links with flows of the action", Enum: []string{FlowAccept, FlowReject}},
+				{Name: "policy", Type: ParamString, Description: "Only keep the links with flows decided by the policy"},
+				{Name: "dropreason", Type: ParamString, Description: "Only keep the links with flows dropped for the reason"},
+				{Name: "groupby", Type: ParamString, Description: "Group the pus into nodes", Enum: []string{GroupByNamespace, GroupByWorkload, GroupByApp}},
+				{Name: "expand", Type: ParamString, Description: "Groups shown as their pus", Repeated: true},
+			}, windowParameters...),
+			Responses: []string{"application/json", "application/graphml+xml", "text/vnd.graphviz", "application/gexf+xml"},
+			Handler:   g.GetData,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/graph/rebuild",
+			Summary: "Rebuild the live graph from the events stored in influxdb",
+			Status:  http.StatusAccepted,
+			Handler: g.RebuildGraph,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/graph/diff",
+			Summary: "Compare the graphs of two time windows",
+			Parameters: []APIParameter{
+				{Name: "beforestart", Type: ParamDateTime, Description: "Start of the first time window (RFC3339)"},
+				{Name: "beforeend", Type: ParamDateTime, Description: "End of the first time window (RFC3339), now by default"},
+				{Name: "afterstart", Type: ParamDateTime, Description: "Start of the second time window (RFC3339)"},
+				{Name: "afterend", Type: ParamDateTime, Description: "End of the second time window (RFC3339), now by default"},
+			},
+			Responses: []string{"application/json"},
+			Handler:   g.GetDiff,
+		},
+		{
+			Method:    http.MethodGet,
+			Path:      "/graph/stream",
+			Summary:   "Stream the graph as Server-Sent Events, a snapshot then a delta per generation",
+			Responses: []string{"text/event-stream"},
+			Handler:   g.StreamGraph,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/policies",
+			Summary: "Generate the network policies allowing the flows accepted in a namespace",
+			Parameters: append([]APIParameter{
+				{Name: "namespace", Type: ParamString, Description: "Namespace of the pus", Required: true},
+				{Name: "format", Type: ParamString, Description: "Format of the policies", Enum: []string{PolicyFormatJSON, PolicyFormatNetworkPolicy, PolicyFormatTrireme}},
+			}, windowParameters...),
+			Responses: []string{"application/json", "application/yaml"},
+			Handler:   g.GetPolicies,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/policies/simulate",
+			Summary: "Evaluate proposed NetworkPolicies or Trireme rule sets against the flows",
+			Parameters: append([]APIParameter{
+				{Name: "format", Type: ParamString, Description: "Return the simulation, or the graph with the changed links marked", Enum: []string{PolicyFormatJSON, SimulationFormatGraph}},
+			}, windowParameters...),
+			RequestBody: "application/yaml",
+			Responses:   []string{"application/json"},
+			Handler:     g.SimulatePolicies,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/anomalies",
+			Summary: "List the anomalies detected in the flows, of the last day by default",
+			Parameters: append([]APIParameter{
+				{Name: "namespace", Type: ParamString, Description: "Namespace of the workloads"},
+				{Name: "workload", Type: ParamString, Description: "Name of the workload"},
+				{Name: "kind", Type: ParamString, Description: "Kind of anomaly", Enum: []string{anomaly.KindNewPeer, anomaly.KindNewPort, anomaly.KindFlowSpike, anomaly.KindRejectSpike}},
+			}, windowParameters...),
+			Responses: []string{"application/json"},
+			Handler:   g.GetAnomalies,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/top",
+			Summary: "Rank the sources, destinations, pairs, ports or policies by flows, of the last hour by default",
+			Parameters: append([]APIParameter{
+				{Name: "by", Type: ParamString, Description: "Ranking, sources by default", Enum: []string{TopSources, TopDestinations, TopPairs, TopPorts, TopPolicies}},
+				{Name: "action", Type: ParamString, Description: "Only rank the flows of the action", Enum: []string{FlowAccept, FlowReject}},
+				{Name: "namespace", Type: ParamString, Description: "Only rank the flows from or to the namespace"},
+				{Name: "limit", Type: ParamInteger, Description: "Number of entries, " + strconv.Itoa(defaultTopLimit) + " by default"},
+			}, windowParameters...),
+			Responses: []string{"application/json"},
+			Handler:   g.GetTop,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/flows",
+			Summary: "Search the stored flow events, of the last day by default",
+			Parameters: append([]APIParameter{
+				{Name: "sourceid", Type: ParamString, Description: "ID of the source pu"},
+				{Name: "sourceip", Type: ParamString, Description: "IP or CIDR of the source"},
+				{Name: "destinationid", Type: ParamString, Description: "ID of the destination pu"},
+				{Name: "destinationip", Type: ParamString, Description: "IP or CIDR of the destination"},
+				{Name: "port", Type: ParamInteger, Description: "Destination port"},
+				{Name: "action", Type: ParamString, Description: "Action of the flows", Enum: []string{FlowAccept, FlowReject}},
+				{Name: "policy", Type: ParamString, Description: "Policy deciding the flows"},
+				{Name: "namespace", Type: ParamString, Description: "Namespace of the flows"},
+				{Name: "sort", Type: ParamString, Description: "Sort key, prefixed by - for a descending order, -time by default", Enum: flowSortParams()},
+				{Name: "limit", Type: ParamInteger, Description: "Number of flows, " + strconv.Itoa(defaultFlowLimit) + " by default"},
+				{Name: "cursor", Type: ParamString, Description: "Cursor of the page returned with the previous page"},
+				{Name: "format", Type: ParamString, Description: "Format of the flows", Enum: []string{FormatJSON, FormatCSV}},
+			}, windowParameters...),
+			Responses: []string{"application/json", "text/csv"},
+			Handler:   g.GetFlows,
+		},
+	}
+}
+
+func flowSortParams() []string {
+
+	var sorts []string
+	for sort := range flowSorts {
+		sorts = append(sorts, sort, "-"+sort)
+	}
+	sort.Strings(sorts)
+
+	return sorts
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selector operators
+const (
+	selectorEquals       = "="
+	selectorNotEquals    = "!="
+	selectorIn           = "in"
+	selectorNotIn        = "notin"
+	selectorExists       = "exists"
+	selectorDoesNotExist = "!"
+)
+
+// Selector is a Kubernetes style label selector such as app=web,tier!=db,env in (prod,staging)
+type Selector []requirement
+
+type requirement struct {
+	key      string
+	operator string
+	values   []string
+}
+
+// ParseSelector parses a comma separated list of requirements. The supported
+// requirements are key, !key, key=value, key==value, key!=value, key in (a,b)
+// and key notin (a,b).
+func ParseSelector(selector string) (Selector, error) {
+
+	var s Selector
+
+	for _, expression := range splitSelector(selector) {
+		expression = strings.TrimSpace(expression)
+		if expression == "" {
+			continue
+		}
+
+		r, err := parseRequirement(expression)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, r)
+	}
+
+	return s, nil
+}
+
+// Matches tells if all the requirements of the selector match the labels
+func (s Selector) Matches(labels map[string]string) bool {
+
+	for _, r := range s {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitSelector splits the requirements on the commas that are not within a set of values
+func splitSelector(selector string) []string {
+
+	var expressions []string
+	var depth, start int
+
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				expressions = append(expressions, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(expressions, selector[start:])
+}
+
+func parseRequirement(expression string) (requirement, error) {
+
+	if strings.HasPrefix(expression, "!") {
+		key := strings.TrimSpace(expression[1:])
+		if !validLabelKey(key) {
+			return requirement{}, fmt.Errorf("Invalid selector %s", expression)
+		}
+		return requirement{key: key, operator: selectorDoesNotExist}, nil
+	}
+
+	if fields := strings.Fields(expression); len(fields) >= 2 && (fields[1] == selectorIn || fields[1] == selectorNotIn) {
+		set := strings.TrimSpace(strings.TrimPrefix(expression, fields[0]))
+		set = strings.TrimSpace(strings.TrimPrefix(set, fields[1]))
+		if !validLabelKey(fields[0]) || !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+			return requirement{}, fmt.Errorf("Invalid selector %s", expression)
+		}
+
+		r := requirement{key: fields[0], operator: fields[1]}
+		for _, value := range strings.Split(set[1:len(set)-1], ",") {
+			r.values = append(r.values, strings.TrimSpace(value))
+		}
+		return r, nil
+	}
+
+	for _, operator := range []string{"!=", "==", "="} {
+		if index := strings.Index(expression, operator); index >= 0 {
+			key := strings.TrimSpace(expression[:index])
+			value := strings.TrimSpace(expression[index+len(operator):])
+			if !validLabelKey(key) {
+				return requirement{}, fmt.Errorf("Invalid selector %s", expression)
+			}
+			if operator == "!=" {
+				return requirement{key: key, operator: selectorNotEquals, values: []string{value}}, nil
+			}
+			return requirement{key: key, operator: selectorEquals, values: []string{value}}, nil
+		}
+	}
+
+	if !validLabelKey(expression) {
+		return requirement{}, fmt.Errorf("Invalid selector %s", expression)
+	}
+
+	return requirement{key: expression, operator: selectorExists}, nil
+}
+
+func validLabelKey(key string) bool {
+
+	return key != "" && !strings.ContainsAny(key, " \t=!(),")
+}
+
+func (r requirement) matches(labels map[string]string) bool {
+
+	value, ok := labels[r.key]
+
+	switch r.operator {
+	case selectorExists:
+		return ok
+	case selectorDoesNotExist:
+		return !ok
+	case selectorEquals:
+		return ok && value == r.values[0]
+	case selectorNotEquals:
+		return !ok || value != r.values[0]
+	case selectorIn:
+		return ok && contains(r.values, value)
+	case selectorNotIn:
+		return !ok || !contains(r.values, value)
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseLabels extracts the user labels from the tags stored with a container event
+func parseLabels(tags string) map[string]string {
+
+	tags = strings.TrimPrefix(tags, "&{[")
+	tags = strings.TrimRight(tags, "]}")
+
+	labels := map[string]string{}
+	for _, tag := range strings.Fields(tags) {
+		if !strings.HasPrefix(tag, userLabelPrefix) {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(tag, userLabelPrefix), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		labels[kv[0]] = kv[1]
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	return labels
+}
+
+// FindNodesAndLinksMatchingSelector keeps the nodes matching the selector and the links
+// between these nodes. With neighbours, the links from or to these nodes and their
+// other ends are kept too.
+func FindNodesAndLinksMatchingSelector(graphData *GraphData, selector Selector, neighbours bool) *GraphData {
+
+	selected := map[string]bool{}
+	for _, node := range graphData.Nodes {
+		if selector.Matches(node.Labels) {
+			selected[node.ContextID] = true
+		}
+	}
+
+	result := &GraphData{Nodes: []Node{}, Links: []Link{}}
+	kept := map[string]bool{}
+	for id := range selected {
+		kept[id] = true
+	}
+
+	for _, link := range graphData.Links {
+		if selected[link.Source] && selected[link.Target] {
+			result.Links = append(result.Links, link)
+		} else if neighbours && (selected[link.Source] || selected[link.Target]) {
+			result.Links = append(result.Links, link)
+			kept[link.Source] = true
+			kept[link.Target] = true
+		}
+	}
+
+	for _, node := range graphData.Nodes {
+		if kept[node.ContextID] {
+			result.Nodes = append(result.Nodes, node)
+		}
+	}
+
+	return result
+}
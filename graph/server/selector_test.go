@@ -0,0 +1,79 @@
+package server
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSelector(t *testing.T) {
+
+	labels := map[string]string{"app": "web", "tier": "frontend", "env": "prod"}
+
+	Convey("Given I parse valid selectors", t, func() {
+		tests := map[string]bool{
+			"app=web":                          true,
+			"app==web":                         true,
+			"app=db":                           false,
+			"tier!=db":                         true,
+			"app=web,tier!=frontend":           false,
+			"env in (prod,staging)":            true,
+			"env in (staging, dev)":            false,
+			"env notin (staging)":              true,
+			"app=web,env in (prod,staging),!x": true,
+			"app":                              true,
+			"!app":                             false,
+			"":                                 true,
+		}
+
+		for expression, expected := range tests {
+			selector, err := ParseSelector(expression)
+			So(err, ShouldBeNil)
+			So(selector.Matches(labels), ShouldEqual, expected)
+		}
+	})
+
+	Convey("Given I parse invalid selectors", t, func() {
+		for _, expression := range []string{"=web", "env in prod", "!", "a b"} {
+			_, err := ParseSelector(expression)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Given I parse the labels of container tags", t, func() {
+		parsed := parseLabels("&{[@sys:image=nginx @usr:app=web @usr:io.kubernetes.pod.namespace=default]}")
+
+		Convey("Then I should only get the user labels", func() {
+			So(parsed, ShouldResemble, map[string]string{"app": "web", "io.kubernetes.pod.namespace": "default"})
+		})
+	})
+
+	Convey("Given I select nodes in a graph", t, func() {
+		graphData := &GraphData{
+			Nodes: []Node{
+				{ContextID: "web", Labels: map[string]string{"app": "web"}},
+				{ContextID: "web-b", Labels: map[string]string{"app": "web"}},
+				{ContextID: "db", Labels: map[string]string{"app": "db"}},
+				{ContextID: "cache", Labels: map[string]string{"app": "cache"}},
+			},
+			Links: []Link{
+				{Source: "web", Target: "db"},
+				{Source: "web", Target: "web-b"},
+				{Source: "db", Target: "cache"},
+			},
+		}
+		selector, _ := ParseSelector("app=web")
+
+		Convey("Then I should get the selected nodes and the links between them", func() {
+			result := FindNodesAndLinksMatchingSelector(graphData, selector, false)
+			So(len(result.Nodes), ShouldEqual, 2)
+			So(result.Links, ShouldResemble, []Link{{Source: "web", Target: "web-b"}})
+		})
+
+		Convey("Then I should get their neighbours and the links to them when requested", func() {
+			result := FindNodesAndLinksMatchingSelector(graphData, selector, true)
+			So(len(result.Nodes), ShouldEqual, 3)
+			So(result.Links, ShouldResemble, []Link{{Source: "web", Target: "db"}, {Source: "web", Target: "web-b"}})
+		})
+	})
+}
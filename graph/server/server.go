@@ -1,10 +1,11 @@
 package server
 
 import (
-	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,54 +16,139 @@ import (
 )
 
 // NewGraph is the handler for graph generators
-func NewGraph(httpClient influxdb.DataAdder, dbname string) *Graph {
+func NewGraph(httpClient influxdb.DataAdder, dbname string, opts ...Option) *Graph {
+
+	g := &Graph{
+		httpClient:         httpClient,
+		dbname:             dbname,
+		nodeMap:            make(map[string]*Node),
+		linkMap:            make(map[LinkID]*Link),
+		externalMap:        make(map[string]*Node),
+		externalDetail:     defaultExternalDetail,
+		externalCIDRPrefix: defaultExternalCIDRPrefix,
+		rebuild:            make(chan struct{}, 1),
+		history:            newHistoryCache(defaultHistoryCacheSize, defaultHistoryCacheTTL),
+		stream:             newBroadcaster(),
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
 
-	return &Graph{
-		httpClient: httpClient,
-		dbname:     dbname,
-		nodesChan:  make(chan []Node),
-		linksChan:  make(chan []Link),
-		nodeMap:    make(map[string]*Node),
-		linkMap:    make(map[string]*Link),
+	if err := validateExternalDetail(g.externalDetail, g.externalCIDRPrefix); err != nil {
+		zap.L().Warn("Using default external detail", zap.Error(err))
+		g.externalDetail = defaultExternalDetail
+		g.externalCIDRPrefix = defaultExternalCIDRPrefix
 	}
+
+	return g
 }
 
 // GetData is called by the client which generates json with a logic that defines the nodes and links for graph
 func (g *Graph) GetData(w http.ResponseWriter, r *http.Request) {
-	var graphData *GraphData
 
-	starttime, err := time.Parse(time.RFC3339, r.URL.Query().Get("starttime")+"Z")
-	if err != nil {
-		zap.L().Warn("Parsing Time ", zap.Error(err))
+	graphData := g.Snapshot()
+
+	format := r.URL.Query().Get("format")
+	if _, ok := exportFormats[format]; !ok && format != "" {
+		http.Error(w, "Unknown format "+format, http.StatusBadRequest)
+		return
 	}
 
-	endtime, err := time.Parse(time.RFC3339, r.URL.Query().Get("endtime")+"Z")
+	window, err := parseWindow(r, "starttime", "endtime")
 	if err != nil {
-		zap.L().Warn("Parsing Time ", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	starttime, endtime := window[0], window[1]
 
 	namespace := r.URL.Query().Get("namespace")
 
-	if r.URL.Query().Get("starttime") != "" || r.URL.Query().Get("endtime") != "" || namespace != "" {
-		// Launching parallely to aggregate nodes and links for given input
-		go g.FindLinksBetweenGivenTimeAndOrNamespace(starttime, endtime, namespace)
-		go g.FindNodesBetweenGivenTimeAndOrNamespace(starttime, endtime, namespace)
-		graphData = &GraphData{Nodes: <-g.nodesChan, Links: <-g.linksChan}
-	} else {
-		graphData = g.jsonData
+	if r.URL.Query().Get("starttime") != "" || r.URL.Query().Get("endtime") != "" {
+		// Time windows are built from the events stored in influxdb
+		graphData, err = g.historicalGraph(starttime, endtime)
+		if err != nil {
+			zap.L().Error("Building graph for time window", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		starttime = time.Time{}
+		endtime = time.Time{}
+	}
+
+	if namespace != "" {
+		graphData = &GraphData{
+			Nodes: FindNodesBetweenGivenTimeAndOrNamespace(graphData.Nodes, starttime, endtime, namespace),
+			Links: FindLinksBetweenGivenTimeAndOrNamespace(graphData.Links, starttime, endtime, namespace),
+		}
 	}
 
-	err = json.NewEncoder(w).Encode(graphData)
+	if r.URL.Query().Get("selector") != "" {
+		selector, err := ParseSelector(r.URL.Query().Get("selector"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		neighbours, _ := strconv.ParseBool(r.URL.Query().Get("neighbours"))
+		graphData = FindNodesAndLinksMatchingSelector(graphData, selector, neighbours)
+	}
+
+	action := r.URL.Query().Get("action")
+	policyID := r.URL.Query().Get("policy")
+	dropReason := r.URL.Query().Get("dropreason")
+	if action != "" || policyID != "" || dropReason != "" {
+		graphData = FindLinksMatchingDecision(graphData, action, policyID, dropReason)
+	}
+
+	if groupby := r.URL.Query().Get("groupby"); groupby != "" {
+		graphData, err = GroupGraph(graphData, groupby, splitParam(r.URL.Query()["expand"]))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if format != "" && format != FormatJSON {
+		w.Header().Set("Content-Type", exportFormats[format].contentType)
+		w.Header().Set("Content-Disposition", "attachment; filename=graph."+exportFormats[format].extension)
+	}
+
+	err = WriteGraph(w, graphData, format)
 	if err != nil {
-		http.Error(w, err.Error(), 3)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Snapshot returns the latest published graph. The returned graph must not be modified.
+func (g *Graph) Snapshot() *GraphData {
+
+	if graphData, ok := g.snapshot.Load().(*GraphData); ok {
+		return graphData
+	}
+
+	return &GraphData{Nodes: []Node{}, Links: []Link{}}
+}
+
+// publish makes a generated graph visible to the handlers and sends its changes to the streaming clients
+func (g *Graph) publish(graphData *GraphData) {
+
+	previous := g.Snapshot()
+	g.snapshot.Store(graphData)
+
+	if !g.stream.active() {
+		return
+	}
+
+	if delta := computeDelta(previous, graphData); !delta.empty() {
+		g.stream.send(delta)
 	}
 }
 
 // FindNodesBetweenGivenTimeAndOrNamespace will aggregate nodes within the specified time, namespaces or both
-func (g *Graph) FindNodesBetweenGivenTimeAndOrNamespace(starttime time.Time, endtime time.Time, namespace string) {
+func FindNodesBetweenGivenTimeAndOrNamespace(allNodes []Node, starttime time.Time, endtime time.Time, namespace string) []Node {
 	var nodes []Node
 
-	for _, node := range g.jsonData.Nodes {
+	for _, node := range allNodes {
 		switch {
 		case node.Time.After(starttime) && node.Time.Before(endtime) && node.Namespace == namespace:
 			nodes = append(nodes, node)
@@ -72,15 +158,15 @@ func (g *Graph) FindNodesBetweenGivenTimeAndOrNamespace(starttime time.Time, end
 			nodes = append(nodes, node)
 		}
 	}
-	g.nodesChan <- nodes
-	return
+
+	return nodes
 }
 
 // FindLinksBetweenGivenTimeAndOrNamespace will aggregate links within the specified time, namespaces or both
-func (g *Graph) FindLinksBetweenGivenTimeAndOrNamespace(starttime time.Time, endtime time.Time, namespace string) {
+func FindLinksBetweenGivenTimeAndOrNamespace(allLinks []Link, starttime time.Time, endtime time.Time, namespace string) []Link {
 	var links []Link
 
-	for _, link := range g.jsonData.Links {
+	for _, link := range allLinks {
 		switch {
 		case link.Time.After(starttime) && link.Time.Before(endtime) && link.Namespace == namespace:
 			links = append(links, link)
@@ -88,37 +174,109 @@ func (g *Graph) FindLinksBetweenGivenTimeAndOrNamespace(starttime time.Time, end
 			links = append(links, link)
 		case link.Namespace == namespace:
 			links = append(links, link)
-		default:
-			links = append(links, DefaultLink())
 		}
 	}
-	g.linksChan <- links
-	return
+
+	return links
 }
 
-// Start is used to start generating jsonData for every 15 seconds
+// FindLinksMatchingDecision keeps the links with flows decided with the given action,
+// policy and drop reason, and the nodes these links touch. Empty criteria match any value.
+func FindLinksMatchingDecision(graphData *GraphData, action string, policyID string, dropReason string) *GraphData {
+
+	result := &GraphData{Nodes: []Node{}, Links: []Link{}}
+	kept := map[string]bool{}
+
+	for _, link := range graphData.Links {
+		for _, p := range link.Policies {
+			if (action == "" || p.Action == action) && (policyID == "" || p.PolicyID == policyID) && (dropReason == "" || p.DropReason == dropReason) {
+				result.Links = append(result.Links, link)
+				kept[link.Source] = true
+				kept[link.Target] = true
+				break
+			}
+		}
+	}
+
+	for _, node := range graphData.Nodes {
+		if kept[node.ContextID] {
+			result.Nodes = append(result.Nodes, node)
+		}
+	}
+
+	return result
+}
+
+// Start is used to start generating the graph for every interval
+// The graph is fully built at startup then only the new events are applied.
+// The generation state is only accessed by this goroutine, the handlers read
+// the published snapshots.
 func (g *Graph) Start(interval int) {
 	zap.L().Info("Starting to Generate JSON every", zap.Any("Interval", interval))
 	go func() {
-		for range time.Tick(time.Second * time.Duration(interval)) {
-			res, err := g.getContainerEvents()
-			if err != nil {
-				zap.L().Error("Retrieving container events from DB", zap.Error(err))
-			}
-			g.jsonData, err = g.transform(res)
-			if err != nil {
-				zap.L().Error("Transforming to nodes and links", zap.Error(err))
+		ticker := time.NewTicker(time.Second * time.Duration(interval))
+		defer ticker.Stop()
+
+		g.generate()
+		for {
+			select {
+			case <-ticker.C:
+			case <-g.rebuild:
+				zap.L().Info("Rebuilding graph from scratch")
+				g.clearDataStores()
 			}
+			g.generate()
 		}
 	}()
 }
 
+// Rebuild requests a full rebuild of the graph on the next generation
+func (g *Graph) Rebuild() {
+
+	select {
+	case g.rebuild <- struct{}{}:
+	default:
+		// A rebuild is already pending
+	}
+}
+
+// RebuildGraph is the handler used to request a full rebuild of the graph
+func (g *Graph) RebuildGraph(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Rebuild requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.Rebuild()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// generate applies the events stored since the last generation and publishes the graph
+func (g *Graph) generate() {
+
+	res, err := g.getContainerEvents()
+	if err != nil {
+		zap.L().Error("Retrieving container events from DB", zap.Error(err))
+		return
+	}
+
+	graphData, err := g.transform(res)
+	if err != nil {
+		zap.L().Error("Transforming to nodes and links", zap.Error(err))
+		return
+	}
+
+	g.publish(graphData)
+}
+
 // GetGraph is used to parse html with custom address to request for json
 func (g *Graph) GetGraph(w http.ResponseWriter, r *http.Request) {
 
 	htmlData, err := template.New("graph").Parse(js)
 	if err != nil {
-		http.Error(w, err.Error(), 0)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	graphDataAddress := r.URL.Query().Get("address")
@@ -129,31 +287,54 @@ func (g *Graph) GetGraph(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
 	data := struct {
-		Address string
+		Address         string
+		Stream          bool
+		StreamAddress   string
+		SimulateAddress string
 	}{
-		Address: graphDataAddress,
+		Address:         graphDataAddress,
+		StreamAddress:   defaultStreamAddress,
+		SimulateAddress: defaultSimulateAddress,
 	}
 
-	switch {
-	case len(r.Form["starttime"]) > 0 && len(r.Form["endtime"]) > 0 && len(r.Form["namespace"]) > 0:
-		data.Address = data.Address + "?starttime=" + r.Form["starttime"][0] + "&endtime=" + r.Form["endtime"][0] + "&namespace=" + r.Form["namespace"][0]
-	case len(r.Form["starttime"]) > 0 && len(r.Form["endtime"]) > 0:
-		data.Address = data.Address + "?starttime=" + r.Form["starttime"][0] + "&endtime=" + r.Form["endtime"][0]
-	case len(r.Form["namespace"]) > 0:
-		data.Address = data.Address + "?namespace=" + r.Form["namespace"][0]
+	query := url.Values{}
+	if r.Form.Get("beforestart") != "" || r.Form.Get("beforeend") != "" {
+		// Highlight the differences from the compared window to the selected one
+		data.Address = defaultDiffAddress
+		query.Set("beforestart", r.Form.Get("beforestart"))
+		query.Set("beforeend", r.Form.Get("beforeend"))
+		query.Set("afterstart", r.Form.Get("starttime"))
+		query.Set("afterend", r.Form.Get("endtime"))
+	} else if r.Form.Get("starttime") != "" && r.Form.Get("endtime") != "" {
+		query.Set("starttime", r.Form.Get("starttime"))
+		query.Set("endtime", r.Form.Get("endtime"))
 	}
-
-	err = htmlData.Execute(w, data)
-	if err != nil {
-		http.Error(w, err.Error(), 1)
+	for _, param := range []string{"namespace", "selector", "neighbours", "action", "policy", "dropreason", "groupby"} {
+		if r.Form.Get(param) != "" {
+			query.Set(param, r.Form.Get(param))
+		}
+	}
+	for _, expand := range r.Form["expand"] {
+		query.Add("expand", expand)
+	}
+	if len(query) > 0 {
+		data.Address = data.Address + "?" + query.Encode()
 	}
 
+	// The live graph is streamed, filtered and historical graphs are loaded once
+	data.Stream = len(query) == 0 && r.URL.Query().Get("address") == ""
+
 	w.Header().Set("Content-Type", "text/html")
+
+	// The page may be partially written, the error can only be logged
+	if err = htmlData.Execute(w, data); err != nil {
+		zap.L().Error("Writing graph page", zap.Error(err))
+	}
 }
 
 func (g *Graph) getContainerEvents() (*client.Response, error) {
 	zap.L().Info("Retrieving ContainerEvents from DB")
-	res, err := g.executeQuery(ContainerEventsQuery)
+	res, err := g.executeQuery(incrementalQuery(ContainerEventsQuery, g.lastContainerTime))
 	if err != nil {
 		return nil, fmt.Errorf("Executing Query %s", err)
 	}
@@ -163,7 +344,7 @@ func (g *Graph) getContainerEvents() (*client.Response, error) {
 
 func (g *Graph) getFlowEvents(httpClient influxdb.DataAdder, dbname string) (*client.Response, error) {
 	zap.L().Info("Retrieving FlowEvents from DB")
-	res, err := g.executeQuery(FlowEventsQuery)
+	res, err := g.executeQuery(incrementalQuery(FlowEventsQuery, g.lastFlowTime))
 	if err != nil {
 		return nil, fmt.Errorf("Executing Query %s", err)
 	}
@@ -185,6 +366,7 @@ func (g *Graph) executeQuery(query string) (*client.Response, error) {
 // the nodes are retrieved from influxdb and stored in map of nodes
 // then later this map is used to generate links and links are stored in map of links
 // the link generator basically generates the link by comparing the ipidhash with the flows hash
+// the maps are kept between generations so that only new events need to be applied
 func (g *Graph) transform(res *client.Response) (*GraphData, error) {
 	zap.L().Info("Transforming to Node and Link")
 
@@ -192,15 +374,41 @@ func (g *Graph) transform(res *client.Response) (*GraphData, error) {
 		return nil, fmt.Errorf("No Response from InfluxDB")
 	}
 
+	if err := g.applyContainerEvents(res); err != nil {
+		return nil, err
+	}
+
+	err := g.generateLinks()
+	if err != nil {
+		return nil, fmt.Errorf("Generating Link %s", err)
+	}
+
+	return g.populateNodesAndLinks(), nil
+}
+
+// applyContainerEvents adds the started pus to the map of nodes and removes the deleted ones
+func (g *Graph) applyContainerEvents(res *client.Response) error {
+
 	var startEvents = []string{ContainerUpdate}
 
 	if len(res.Results[0].Series) > 0 {
 		if res.Results[0].Series[0].Name == ContainerEvent {
+			columns := newColumnIndex(res.Results[0].Series[0].Columns)
 			for _, containerEvent := range res.Results[0].Series[0].Values {
 				var node Node
-				containerAttr := extractContainerEventAttributes(containerEvent)
+				containerAttr := extractContainerEventAttributes(columns, containerEvent)
 				if containerAttr == nil {
-					return nil, fmt.Errorf("Empty Container Attributes ")
+					return fmt.Errorf("Empty Container Attributes ")
+				}
+				eventTime, err := time.Parse(time.RFC3339, containerAttr.timestamp)
+				if err != nil {
+					return fmt.Errorf("Parsing Time %s", err)
+				}
+				if eventTime.After(g.lastContainerTime) {
+					g.lastContainerTime = eventTime
+				}
+				if !g.firstApplication(eventKey{ContainerEvent, eventTime.UnixNano(), containerAttr.contextID, containerAttr.ipAddress, containerAttr.event}) {
+					continue
 				}
 				if containerAttr.event == ContainerUpdate {
 					for _, containerEvent := range startEvents {
@@ -208,38 +416,26 @@ func (g *Graph) transform(res *client.Response) (*GraphData, error) {
 							ipIDHash := getHash(containerAttr.contextID, containerAttr.ipAddress)
 							if _, ok := g.nodeMap[ipIDHash]; !ok {
 								node.ContextID = containerAttr.contextID
-								parsedTime, err := time.Parse(time.RFC3339, containerAttr.timestamp)
-								if err != nil {
-									return nil, fmt.Errorf("Parsing Time %s", err)
-								}
-								node.Time = parsedTime
+								node.Time = eventTime
 								node.IPAddress = containerAttr.ipAddress
 								node.Namespace = g.parseTag(containerAttr.tags, PODNamespaceFromContainerTags)
 								node.PodName = g.parseTag(containerAttr.tags, PODNameFromContainerTags)
+								node.Type = NodeTypePU
+								node.Labels = parseLabels(containerAttr.tags)
+								node.Attributes = containerAttr.attributes
 								g.nodeMap[ipIDHash] = &node
 							}
 						}
 					}
-				} else if containerAttr.event == ContainerDelete {
-					go g.deleteContainerEvents(containerAttr.contextID)
+				} else if containerAttr.event == ContainerDelete && g.keepsDeletion(eventTime) {
+					g.deleteContainerEvents(containerAttr.contextID)
 				}
 			}
+			g.pruneApplied(ContainerEvent, g.lastContainerTime)
 		}
 	}
 
-	err := g.generateLinks()
-	if err != nil {
-		return nil, fmt.Errorf("Generating Link %s", err)
-	}
-
-	g.populateNodesAndLinks()
-
-	jsonData := GraphData{Nodes: g.nodes, Links: g.links}
-
-	// Clears the structures and maps
-	go g.clearDataStores()
-
-	return &jsonData, nil
+	return nil
 }
 
 func (g *Graph) generateLinks() error {
@@ -249,41 +445,64 @@ func (g *Graph) generateLinks() error {
 		return fmt.Errorf("Retrieving Flow Events %s", err)
 	}
 
+	if err := g.applyFlowEvents(res); err != nil {
+		return err
+	}
+
+	if g.rollups != nil {
+		g.rollups.complete(time.Now())
+	}
+
+	return nil
+}
+
+// applyFlowEvents adds the flows to the map of links
+func (g *Graph) applyFlowEvents(res *client.Response) error {
+
 	if len(res.Results[0].Series) > 0 {
 		if res.Results[0].Series[0].Name == FlowEvent {
+			columns := newColumnIndex(res.Results[0].Series[0].Columns)
+			// Flows replayed after a rebuild were already scored
+			scoredUntil := g.anomalyTime
 			for _, flowEvent := range res.Results[0].Series[0].Values {
 				var link Link
-				flowAttr := extractFlowEventAttributes(flowEvent)
+				flowAttr := extractFlowEventAttributes(columns, flowEvent)
 				if flowAttr == nil {
 					return fmt.Errorf("Empty Flow Attributes ")
 				}
-				srcHash := getHash(flowAttr.srcID, flowAttr.srcIP)
-				dstHash := getHash(flowAttr.dstID, flowAttr.dstIP)
-				key := srcHash + dstHash
+				parsedTime, err := time.Parse(time.RFC3339, flowAttr.timestamp)
+				if err != nil {
+					return fmt.Errorf("Parsing Time %s", err)
+				}
+				if parsedTime.After(g.lastFlowTime) {
+					g.lastFlowTime = parsedTime
+				}
+				if !g.firstApplication(eventKey{FlowEvent, parsedTime.UnixNano(), flowAttr.contextID, flowAttr.srcID + "/" + flowAttr.srcIP, flowAttr.dstID + "/" + flowAttr.dstIP + "/" + strconv.Itoa(flowAttr.dstPort)}) {
+					continue
+				}
+				srcNode := g.endpointNode(flowAttr.srcID, flowAttr.srcIP, flowAttr.srcType, flowAttr.srcAttributes, parsedTime)
+				dstNode := g.endpointNode(flowAttr.dstID, flowAttr.dstIP, flowAttr.dstType, flowAttr.dstAttributes, parsedTime)
+				if g.detector != nil && parsedTime.After(scoredUntil) {
+					g.scoreFlow(flowAttr, srcNode, dstNode, parsedTime)
+				}
+				if g.rollups != nil {
+					g.rollups.add(flowAttr, g.topEndpoint(srcNode, flowAttr.srcID, flowAttr.srcIP), g.topEndpoint(dstNode, flowAttr.dstID, flowAttr.dstIP), parsedTime)
+				}
+				key := LinkID{Source: srcNode, Target: dstNode}
 				if _, ok := g.linkMap[key]; !ok {
-					if srcNode, ok := g.nodeMap[srcHash]; ok {
-						link.Source = srcNode.ContextID
-					}
-					if dstNode, ok := g.nodeMap[dstHash]; ok {
-						link.Target = dstNode.ContextID
-					}
-
-					if link.Source != "" && link.Target != "" {
-						link.Action = flowAttr.action
-						link.Namespace = g.parseTag(flowAttr.tags, PODNamespaceFromFlowTags)
-						parsedTime, err := time.Parse(time.RFC3339, flowAttr.timestamp)
-						if err != nil {
-							return fmt.Errorf("Parsing Time %s", err)
-						}
-						link.Time = parsedTime
-						g.linkMap[key] = &link
-					}
+					link.Source = srcNode
+					link.Target = dstNode
+					link.Action = flowAttr.action
+					link.Namespace = g.parseTag(flowAttr.tags, PODNamespaceFromFlowTags)
+					link.Time = parsedTime
+					link.addFlow(flowAttr.dstPort, flowAttr.action, flowAttr.policyID, flowAttr.dropReason, flowAttr.counter, parsedTime)
+					g.linkMap[key] = &link
 				} else {
-					if g.linkMap[key].Action != flowAttr.action {
-						g.linkMap[key].Action = FlowNowRejected
-					}
+					g.linkMap[key].Action = nextAction(g.linkMap[key].Action, flowAttr.action)
+					g.linkMap[key].addFlow(flowAttr.dstPort, flowAttr.action, flowAttr.policyID, flowAttr.dropReason, flowAttr.counter, parsedTime)
 				}
 			}
+			g.pruneApplied(FlowEvent, g.lastFlowTime)
 		}
 	}
 
@@ -298,27 +517,95 @@ func (g *Graph) deleteContainerEvents(contextID string) {
 			delete(g.nodeMap, ipIDHash)
 		}
 	}
-	return
+
+	// Links are kept between generations and must not point to deleted nodes
+	removed := false
+	for key, link := range g.linkMap {
+		if link.Source == contextID || link.Target == contextID {
+			delete(g.linkMap, key)
+			removed = true
+		}
+	}
+
+	if removed {
+		g.pruneExternalNodes()
+	}
+}
+
+// pruneExternalNodes removes the external nodes that no link references anymore
+func (g *Graph) pruneExternalNodes() {
+
+	referenced := make(map[string]bool, len(g.externalMap))
+	for _, link := range g.linkMap {
+		referenced[link.Source] = true
+		referenced[link.Target] = true
+	}
+
+	for nodeID := range g.externalMap {
+		if !referenced[nodeID] {
+			delete(g.externalMap, nodeID)
+		}
+	}
 }
 
-func (g *Graph) populateNodesAndLinks() {
+// populateNodesAndLinks copies the generation state into a new graph that is
+// not modified by the next generations
+func (g *Graph) populateNodesAndLinks() *GraphData {
+
+	graphData := &GraphData{
+		Nodes: make([]Node, 0, len(g.nodeMap)+len(g.externalMap)),
+		Links: make([]Link, 0, len(g.linkMap)),
+	}
+
+	known := make(map[string]bool, len(g.nodeMap)+len(g.externalMap))
 
 	for _, node := range g.nodeMap {
-		g.nodes = append(g.nodes, *node)
+		known[node.ContextID] = true
+		published := *node
+		if g.detector != nil {
+			published.Anomalies = g.recentAnomalies(node)
+		}
+		graphData.Nodes = append(graphData.Nodes, published)
+	}
+
+	for _, node := range g.externalMap {
+		known[node.ContextID] = true
+		graphData.Nodes = append(graphData.Nodes, *node)
 	}
 
 	for _, link := range g.linkMap {
-		g.links = append(g.links, *link)
+		// The links of the pus without container event yet are published once it is applied
+		if !known[link.Source] || !known[link.Target] {
+			continue
+		}
+		published := *link
+		// Ports are updated in place by the next generations
+		published.Ports = append([]LinkPort(nil), link.Ports...)
+		published.Policies = append([]LinkPolicy(nil), link.Policies...)
+		graphData.Links = append(graphData.Links, published)
 	}
+
+	return graphData
 }
 
+// clearDataStores resets the graph state so that the next generation rebuilds it from scratch
 func (g *Graph) clearDataStores() {
 
-	g.links = nil
-	g.nodes = nil
 	for k := range g.linkMap {
 		delete(g.linkMap, k)
 	}
+	for k := range g.externalMap {
+		delete(g.externalMap, k)
+	}
+	for k := range g.nodeMap {
+		delete(g.nodeMap, k)
+	}
+	g.lastContainerTime = time.Time{}
+	g.lastFlowTime = time.Time{}
+	g.applied = nil
+	if g.rollups != nil {
+		g.rollups.reset()
+	}
 	return
 }
 
@@ -340,26 +627,30 @@ func (g *Graph) parseTag(tag string, parseType string) string {
 }
 
 func (g *Graph) getNameOrNamespaceFromTag(tags string, tagExtractor string) string {
+	var result string
 
 	if strings.Contains(tags, tagExtractor) {
 		for _, tag := range strings.Split(tags, " ") {
 			tagCollection := strings.SplitAfter(tag, "=")
 			for _, tagcollection := range tagCollection {
-				g.extractTagValue(tagCollection, tagcollection, tagExtractor)
+				if value, ok := extractTagValue(tagCollection, tagcollection, tagExtractor); ok {
+					result = value
+				}
 			}
 		}
 	}
 
-	return g.tagValue
+	return result
 }
 
-func (g *Graph) extractTagValue(tagCollection []string, tagcollection string, tagExtractor string) {
+func extractTagValue(tagCollection []string, tagcollection string, tagExtractor string) (string, bool) {
 
 	if tagcollection == tagExtractor+"=" || tagcollection == "&{["+tagExtractor+"=" {
 		if index := strings.IndexByte(tagCollection[1], ']'); index >= 0 {
-			g.tagValue = tagCollection[1][:index]
-		} else {
-			g.tagValue = tagCollection[1]
+			return tagCollection[1][:index], true
 		}
+		return tagCollection[1], true
 	}
+
+	return "", false
 }
@@ -1,10 +1,20 @@
 package server
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"git.cloud.top/DSec/trireme-lib/collector"
+	"git.cloud.top/DSec/trireme-lib/policy"
+	"github.com/aporeto-inc/trireme-statistics/influxdb"
 	"github.com/aporeto-inc/trireme-statistics/influxdb/mock"
 	gomock "github.com/golang/mock/gomock"
 	client "github.com/influxdata/influxdb/client/v2"
@@ -47,6 +57,8 @@ func getSampleInlfuxDBResponse(eventType string) client.Response {
 		testValues[0][FlowDestinationIDIndex] = "14138259f129"
 		testValues[0][FlowDestinationIPIndex] = "10.20.2.59"
 		testValues[0][FlowActionIndex] = "accept"
+		testValues[0][FlowDestinationPortIndex] = json.Number("8086")
+		testValues[0][FlowCounterIndex] = json.Number("3")
 		testValues[0][FlowTagsIndex] = `&{[app=aporeto-influxdb @namespace=kube-system AporetoContextID=14138259f129]}]`
 		testRow.Values = testValues
 	}
@@ -66,11 +78,14 @@ func sampleGraphData(reverse bool) (*GraphData, []Node, []Link) {
 	var link Link
 	nodes := make([]Node, 2)
 	links := make([]Link, 1)
+	containerEvents := getSampleInlfuxDBResponse(ContainerEvent).Results[0].Series[0].Values
 
 	srcNode.ContextID = "6f4b63dde673"
 	srcNode.IPAddress = "10.20.0.1"
 	srcNode.Namespace = "kube-system"
 	srcNode.PodName = "aporeto-collector-sp9v9"
+	srcNode.Type = NodeTypePU
+	srcNode.Labels = parseLabels(containerEvents[0][ContainerTagsIndex].(string))
 	parsedTime, _ := time.Parse(time.RFC3339, "2017-11-08T06:14:44.843219756Z")
 	srcNode.Time = parsedTime
 
@@ -78,6 +93,8 @@ func sampleGraphData(reverse bool) (*GraphData, []Node, []Link) {
 	dstNode.IPAddress = "10.20.2.59"
 	dstNode.Namespace = "kube-system"
 	dstNode.PodName = "aporeto-influxdb-j5hm6"
+	dstNode.Type = NodeTypePU
+	dstNode.Labels = parseLabels(containerEvents[1][ContainerTagsIndex].(string))
 	parsedTime, _ = time.Parse(time.RFC3339, "2017-11-08T06:14:44.843219756Z")
 	dstNode.Time = parsedTime
 
@@ -93,8 +110,14 @@ func sampleGraphData(reverse bool) (*GraphData, []Node, []Link) {
 	link.Target = "14138259f129"
 	link.Action = "accept"
 	link.Namespace = "kube-system"
+	link.Ports = []LinkPort{{Port: 8086, Action: "accept", FlowCount: 3, AcceptedCount: 3}}
+	link.Policies = []LinkPolicy{{Action: "accept", FlowCount: 3}}
 	parsedTime, _ = time.Parse(time.RFC3339, "2017-11-08T06:14:46.314517734Z")
 	link.Time = parsedTime
+	link.FlowCount = 3
+	link.AcceptedCount = 3
+	link.FirstSeen = parsedTime
+	link.LastSeen = parsedTime
 
 	links[0] = link
 
@@ -210,6 +233,23 @@ func TestDeleteContainerEvents(t *testing.T) {
 				So(len(newTestGraph.nodeMap), ShouldEqual, 1)
 			})
 		})
+
+		Convey("Given I delete a pu talking to external endpoints", func() {
+			newTestGraph.nodeMap[getHash("web", "10.1.1.1")] = &Node{ContextID: "web", IPAddress: "10.1.1.1"}
+			newTestGraph.nodeMap[getHash("db", "10.1.1.2")] = &Node{ContextID: "db", IPAddress: "10.1.1.2"}
+			newTestGraph.externalMap["ext:8.8.8.0/24"] = &Node{ContextID: "ext:8.8.8.0/24"}
+			newTestGraph.externalMap["ext:1.1.1.0/24"] = &Node{ContextID: "ext:1.1.1.0/24"}
+			newTestGraph.linkMap[LinkID{Source: "web", Target: "ext:8.8.8.0/24"}] = &Link{Source: "web", Target: "ext:8.8.8.0/24"}
+			newTestGraph.linkMap[LinkID{Source: "web", Target: "ext:1.1.1.0/24"}] = &Link{Source: "web", Target: "ext:1.1.1.0/24"}
+			newTestGraph.linkMap[LinkID{Source: "db", Target: "ext:1.1.1.0/24"}] = &Link{Source: "db", Target: "ext:1.1.1.0/24"}
+			newTestGraph.deleteContainerEvents("web")
+
+			Convey("Then only the external nodes still linked should be kept", func() {
+				So(len(newTestGraph.linkMap), ShouldEqual, 1)
+				So(newTestGraph.externalMap, ShouldContainKey, "ext:1.1.1.0/24")
+				So(newTestGraph.externalMap, ShouldNotContainKey, "ext:8.8.8.0/24")
+			})
+		})
 	})
 }
 
@@ -252,6 +292,41 @@ func TestTransform(t *testing.T) {
 	})
 }
 
+func TestIncrementalGeneration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I generate a graph", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB")
+
+		testContainerResponse := getSampleInlfuxDBResponse(ContainerEvent)
+		testFlowResponse := getSampleInlfuxDBResponse(FlowEvent)
+		mockDataAdder.EXPECT().ExecuteQuery(FlowEventsQuery, "testDB").Return(&testFlowResponse, nil).Times(1)
+		_, err := newTestGraph.transform(&testContainerResponse)
+		So(err, ShouldBeNil)
+
+		Convey("When a flow is written just behind the latest flow applied", func() {
+			lateFlowResponse := getSampleInlfuxDBResponse(FlowEvent)
+			lateFlow := append([]interface{}(nil), lateFlowResponse.Results[0].Series[0].Values[0]...)
+			lateFlow[FlowTimestampIndex] = "2017-11-08T06:14:40Z"
+			lateFlow[FlowCounterIndex] = json.Number("2")
+			lateFlowResponse.Results[0].Series[0].Values = append(lateFlowResponse.Results[0].Series[0].Values, lateFlow)
+
+			mockDataAdder.EXPECT().ExecuteQuery(FlowEventsQuery+" WHERE time > '2017-11-08T06:13:46.314517734Z'", "testDB").Return(&lateFlowResponse, nil).Times(1)
+			So(newTestGraph.generateLinks(), ShouldBeNil)
+
+			Convey("Then the late flow should be applied and the flow read again should not", func() {
+				So(len(newTestGraph.linkMap), ShouldEqual, 1)
+				for _, link := range newTestGraph.linkMap {
+					So(link.FlowCount, ShouldEqual, 5)
+				}
+			})
+		})
+	})
+}
+
 func TestClearDataStores(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -262,17 +337,20 @@ func TestClearDataStores(t *testing.T) {
 		newTestGraph := NewGraph(mockDataAdder, "testDB")
 
 		Convey("Given I try to empty the data stores", func() {
-			_, nodes, links := sampleGraphData(false)
-			newTestGraph.nodes = nodes
-			newTestGraph.links = links
-			So(newTestGraph.nodes, ShouldNotBeNil)
-			So(newTestGraph.links, ShouldNotBeNil)
+			testContainerResponse := getSampleInlfuxDBResponse(ContainerEvent)
+			testFlowResponse := getSampleInlfuxDBResponse(FlowEvent)
+			mockDataAdder.EXPECT().ExecuteQuery(FlowEventsQuery, "testDB").Return(&testFlowResponse, nil).Times(1)
+			_, err := newTestGraph.transform(&testContainerResponse)
+			So(err, ShouldBeNil)
+			So(len(newTestGraph.nodeMap), ShouldEqual, 2)
+			So(len(newTestGraph.linkMap), ShouldEqual, 1)
 
 			newTestGraph.clearDataStores()
 			Convey("I should see empty data stores", func() {
-				So(newTestGraph.nodes, ShouldBeNil)
-				So(newTestGraph.links, ShouldBeNil)
+				So(len(newTestGraph.nodeMap), ShouldBeZeroValue)
 				So(len(newTestGraph.linkMap), ShouldBeZeroValue)
+				So(newTestGraph.lastContainerTime.IsZero(), ShouldBeTrue)
+				So(newTestGraph.lastFlowTime.IsZero(), ShouldBeTrue)
 			})
 		})
 	})
@@ -323,3 +401,498 @@ func TestParseTag(t *testing.T) {
 		})
 	})
 }
+
+func TestExternalGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create a graph grouping external endpoints by CIDR", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB", OptionExternalDetail(ExternalDetailCIDR, 24))
+
+		Convey("Then addresses should be grouped by network", func() {
+			key, name := newTestGraph.externalGroup("8.8.8.8", nil)
+			So(key, ShouldEqual, "8.8.8.0/24")
+			So(name, ShouldEqual, "8.8.8.0/24")
+		})
+
+		Convey("Then a CIDR label should take precedence", func() {
+			key, name := newTestGraph.externalGroup("10.8.1.1", map[string]string{"Label": "corp-vpn"})
+			So(key, ShouldEqual, "label/corp-vpn")
+			So(name, ShouldEqual, "corp-vpn")
+		})
+
+		Convey("Then a flow to an unknown endpoint should create an external node", func() {
+			testContainerResponse := getSampleInlfuxDBResponse(ContainerEvent)
+			testFlowResponse := getSampleInlfuxDBResponse(FlowEvent)
+			testFlowResponse.Results[0].Series[0].Values[0][FlowDestinationIDIndex] = "default"
+			testFlowResponse.Results[0].Series[0].Values[0][FlowDestinationIPIndex] = "8.8.4.4"
+			mockDataAdder.EXPECT().ExecuteQuery(FlowEventsQuery, "testDB").Return(&testFlowResponse, nil).Times(1)
+			res, err := newTestGraph.transform(&testContainerResponse)
+			So(err, ShouldBeNil)
+			So(len(res.Nodes), ShouldEqual, 3)
+			So(len(res.Links), ShouldEqual, 1)
+			So(res.Links[0].Target, ShouldEqual, "ext:8.8.4.0/24")
+		})
+	})
+
+	Convey("Given I create a graph with an invalid external detail", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB", OptionExternalDetail("planet", 24))
+
+		Convey("Then the default detail should be used", func() {
+			So(newTestGraph.externalDetail, ShouldEqual, ExternalDetailCIDR)
+		})
+	})
+}
+
+func TestEndpointType(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I have a graph knowing the source pu only", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB")
+
+		containerResponse := getSampleInlfuxDBResponse(ContainerEvent)
+		sourceResponse := getSampleInlfuxDBResponse(ContainerEvent)
+		sourceResponse.Results[0].Series[0].Values = sourceResponse.Results[0].Series[0].Values[:1]
+		So(newTestGraph.applyContainerEvents(&sourceResponse), ShouldBeNil)
+
+		Convey("When I apply flows giving the type of their endpoints", func() {
+			// The types are stored as numbers, or as names by the older collectors
+			pu := json.Number(strconv.Itoa(int(collector.EnpointTypePU)))
+			flowResponse := client.Response{Results: []client.Result{{Series: []models.Row{{
+				Name:    FlowEvent,
+				Columns: []string{"time", "SourceID", "SourceIP", "SourceType", "DestinationID", "DestinationIP", "DestinationType", "DestinationPort", "Action", "Counter"},
+				Values: [][]interface{}{
+					{"2017-11-08T06:14:46Z", "6f4b63dde673", "10.20.0.1", "pu", "14138259f129", "10.20.2.59", pu, json.Number("8086"), "accept", json.Number("1")},
+					{"2017-11-08T06:14:47Z", "6f4b63dde673", "10.20.0.1", pu, "6f4b63dde673", "10.20.0.1", "ext", json.Number("443"), "accept", json.Number("1")},
+				},
+			}}}}}
+			So(newTestGraph.applyFlowEvents(&flowResponse), ShouldBeNil)
+			res := newTestGraph.populateNodesAndLinks()
+
+			Convey("Then the external endpoint should not be resolved to a pu", func() {
+				So(len(res.Nodes), ShouldEqual, 2)
+				So(len(res.Links), ShouldEqual, 1)
+				So(res.Links[0].Target, ShouldEqual, "ext:10.20.0.0/24")
+			})
+
+			Convey("Then the link to the unknown pu should be shown once its container event is applied", func() {
+				So(newTestGraph.applyContainerEvents(&containerResponse), ShouldBeNil)
+				res := newTestGraph.populateNodesAndLinks()
+				So(len(res.Nodes), ShouldEqual, 3)
+				So(len(res.Links), ShouldEqual, 2)
+				So(newTestGraph.linkMap, ShouldContainKey, LinkID{Source: "6f4b63dde673", Target: "14138259f129"})
+			})
+		})
+	})
+}
+
+func TestFlowEventEncoding(t *testing.T) {
+
+	Convey("Given I collect a flow with the influxdb collector", t, func() {
+		written := make(chan []byte, 1)
+		influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/query":
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"results":[{"statement_id":0}]}`)
+			case "/write":
+				body, _ := ioutil.ReadAll(r.Body)
+				written <- body
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer influx.Close()
+
+		db, err := influxdb.NewDBConnection("", "", influx.URL, "testDB", false)
+		So(err, ShouldBeNil)
+		So(db.Start(), ShouldBeNil)
+		defer db.Stop()
+
+		db.CollectFlowEvent(&collector.FlowRecord{
+			ContextID:   "14138259f129",
+			Count:       1,
+			Source:      &collector.EndPoint{ID: "6f4b63dde673", IP: "10.20.0.1", Port: 43210, Type: collector.EnpointTypePU},
+			Destination: &collector.EndPoint{ID: "default", IP: "8.8.8.8", Port: 53, Type: collector.EndPointTypeExternalIP},
+			Tags:        &policy.TagStore{Tags: []string{"@namespace=kube-system"}},
+			Action:      policy.Accept,
+		})
+
+		var body []byte
+		select {
+		case body = <-written:
+		case <-time.After(5 * time.Second):
+		}
+		So(body, ShouldNotBeEmpty)
+
+		Convey("When I read the stored point back", func() {
+			points, err := models.ParsePoints(body)
+			So(err, ShouldBeNil)
+			So(len(points), ShouldEqual, 1)
+
+			fields, err := points[0].Fields()
+			So(err, ShouldBeNil)
+
+			// InfluxDB returns the integers as numbers and the other fields as they are
+			columns := []string{"time"}
+			row := []interface{}{points[0].Time().UTC().Format(time.RFC3339Nano)}
+			for name, value := range fields {
+				if i, ok := value.(int64); ok {
+					value = json.Number(strconv.FormatInt(i, 10))
+				}
+				columns = append(columns, name)
+				row = append(row, value)
+			}
+			flowAttr := extractFlowEventAttributes(newColumnIndex(columns), row)
+
+			Convey("Then the endpoint types should be read as written", func() {
+				So(flowAttr.srcType, ShouldEqual, endpointTypePU)
+				So(flowAttr.dstType, ShouldEqual, endpointTypeExternal)
+				So(flowAttr.dstPort, ShouldEqual, 53)
+				So(flowAttr.action, ShouldEqual, FlowAccept)
+			})
+		})
+	})
+}
+
+func TestGetDataConcurrently(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+	newTestGraph := NewGraph(mockDataAdder, "testDB")
+
+	Convey("Given I request the graph before it is generated", t, func() {
+		w := httptest.NewRecorder()
+		newTestGraph.GetData(w, httptest.NewRequest("GET", "/get", nil))
+
+		Convey("Then I should get an empty graph", func() {
+			var graphData GraphData
+			So(json.NewDecoder(w.Body).Decode(&graphData), ShouldBeNil)
+			So(graphData.Nodes, ShouldBeEmpty)
+			So(graphData.Links, ShouldBeEmpty)
+		})
+	})
+
+	testSampleGraphData, _, _ := sampleGraphData(false)
+	newTestGraph.publish(testSampleGraphData)
+
+	// Keep publishing new generations while the requests are served
+	done := make(chan struct{})
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			graphData, _, _ := sampleGraphData(i%2 == 0)
+			newTestGraph.publish(graphData)
+		}
+	}()
+
+	t.Run("requests", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			namespace := ""
+			if i%2 == 0 {
+				namespace = "kube-system"
+			}
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+				t.Parallel()
+
+				w := httptest.NewRecorder()
+				newTestGraph.GetData(w, httptest.NewRequest("GET", "/get?namespace="+namespace, nil))
+
+				var graphData GraphData
+				if err := json.NewDecoder(w.Body).Decode(&graphData); err != nil {
+					t.Fatalf("Decoding graph %s", err)
+				}
+				if len(graphData.Nodes) != 2 || len(graphData.Links) != 1 {
+					t.Fatalf("Unexpected graph %d nodes %d links", len(graphData.Nodes), len(graphData.Links))
+				}
+			})
+		}
+	})
+
+	close(done)
+	<-published
+}
+
+func TestHistoricalGraph(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create a new graph instance", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB")
+		starttime, _ := time.Parse(time.RFC3339, "2017-11-08T06:00:00Z")
+		endtime, _ := time.Parse(time.RFC3339, "2017-11-08T07:00:00Z")
+
+		Convey("Given I request a time window", func() {
+			testContainerResponse := getSampleInlfuxDBResponse(ContainerEvent)
+			testFlowResponse := getSampleInlfuxDBResponse(FlowEvent)
+			mockDataAdder.EXPECT().ExecuteQuery(ContainerEventsQuery+" WHERE time <= '2017-11-08T07:00:00Z'", "testDB").Return(&testContainerResponse, nil).Times(1)
+			mockDataAdder.EXPECT().ExecuteQuery(FlowEventsQuery+" WHERE time >= '2017-11-08T06:00:00Z' AND time <= '2017-11-08T07:00:00Z'", "testDB").Return(&testFlowResponse, nil).Times(1)
+
+			w := httptest.NewRecorder()
+			newTestGraph.GetData(w, httptest.NewRequest("GET", "/get?starttime=2017-11-08T06:00:00&endtime=2017-11-08T07:00:00", nil))
+
+			Convey("Then the graph should be built from the events of the window", func() {
+				var graphData GraphData
+				So(json.NewDecoder(w.Body).Decode(&graphData), ShouldBeNil)
+				So(len(graphData.Nodes), ShouldEqual, 2)
+				So(len(graphData.Links), ShouldEqual, 1)
+				So(len(newTestGraph.nodeMap), ShouldBeZeroValue)
+			})
+
+			Convey("Then the same window should be served from the cache", func() {
+				graphData, err := newTestGraph.historicalGraph(starttime, endtime)
+				So(err, ShouldBeNil)
+				So(len(graphData.Nodes), ShouldEqual, 2)
+			})
+		})
+
+		Convey("Given a pu is deleted during the window", func() {
+			testContainerResponse := getSampleInlfuxDBResponse(ContainerEvent)
+			testContainerResponse.Results[0].Series[0].Values = append(testContainerResponse.Results[0].Series[0].Values,
+				[]interface{}{"2017-11-08T06:30:00Z", "6f4b63dde673", "delete", nil, nil, "10.20.0.1", ""})
+			testFlowResponse := getSampleInlfuxDBResponse(FlowEvent)
+			mockDataAdder.EXPECT().ExecuteQuery(gomock.Any(), "testDB").Return(&testContainerResponse, nil).Times(1)
+			mockDataAdder.EXPECT().ExecuteQuery(gomock.Any(), "testDB").Return(&testFlowResponse, nil).Times(1)
+
+			graphData, err := newTestGraph.historicalGraph(starttime, endtime)
+
+			Convey("Then the pu should still be in the graph", func() {
+				So(err, ShouldBeNil)
+				So(len(graphData.Nodes), ShouldEqual, 2)
+			})
+		})
+
+		Convey("Given I request a window that is not over", func() {
+			testContainerResponse := getSampleInlfuxDBResponse(ContainerEvent)
+			testFlowResponse := getSampleInlfuxDBResponse(FlowEvent)
+			mockDataAdder.EXPECT().ExecuteQuery(gomock.Any(), "testDB").Return(&testContainerResponse, nil).Times(1)
+			mockDataAdder.EXPECT().ExecuteQuery(gomock.Any(), "testDB").Return(&testFlowResponse, nil).Times(1)
+			mockDataAdder.EXPECT().ExecuteQuery(gomock.Any(), "testDB").Return(&testContainerResponse, nil).Times(1)
+			mockDataAdder.EXPECT().ExecuteQuery(gomock.Any(), "testDB").Return(&testFlowResponse, nil).Times(1)
+
+			future := time.Now().Add(time.Hour)
+			_, err := newTestGraph.historicalGraph(starttime, future)
+			So(err, ShouldBeNil)
+			_, err = newTestGraph.historicalGraph(starttime, future)
+
+			Convey("Then it should not be cached", func() {
+				So(err, ShouldBeNil)
+				So(len(newTestGraph.history.entries), ShouldBeZeroValue)
+			})
+		})
+
+		Convey("Given I request an invalid window", func() {
+			_, err := newTestGraph.historicalGraph(endtime, starttime)
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestLinkActions(t *testing.T) {
+
+	Convey("Given I record flows on a link", t, func() {
+		var link Link
+		now := time.Now()
+
+		Convey("When a port accepted is then rejected", func() {
+			link.addFlow(5432, FlowAccept, "", "", 1, now)
+			link.addFlow(5432, FlowReject, "", "", 1, now)
+
+			Convey("Then the port should be marked as now rejected", func() {
+				So(link.Ports[0].Action, ShouldEqual, FlowNowRejected)
+			})
+
+			Convey("Then it should stay rejected until a flow is accepted again", func() {
+				link.addFlow(5432, FlowReject, "", "", 1, now)
+				So(link.Ports[0].Action, ShouldEqual, FlowNowRejected)
+				link.addFlow(5432, FlowAccept, "", "", 1, now)
+				So(link.Ports[0].Action, ShouldEqual, FlowAccept)
+			})
+		})
+
+		Convey("When a port rejected is then accepted", func() {
+			link.addFlow(5432, FlowReject, "", "", 1, now)
+			link.addFlow(5432, FlowAccept, "", "", 1, now)
+
+			Convey("Then the port should be marked as accepted", func() {
+				So(link.Ports[0].Action, ShouldEqual, FlowAccept)
+				So(link.Ports[0].RejectedCount, ShouldEqual, 1)
+				So(link.Ports[0].AcceptedCount, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestFindLinksMatchingDecision(t *testing.T) {
+
+	Convey("Given I have a graph with accepted and rejected flows", t, func() {
+		graphData := &GraphData{
+			Nodes: []Node{{ContextID: "web", Namespace: "a"}, {ContextID: "db", Namespace: "a"}, {ContextID: "cache", Namespace: "b"}},
+			Links: []Link{
+				{Source: "web", Target: "db", Namespace: "a", Policies: []LinkPolicy{{PolicyID: "allow-db", Action: FlowAccept, FlowCount: 2}}},
+				{Source: "web", Target: "cache", Namespace: "b", Policies: []LinkPolicy{
+					{PolicyID: "allow-db", Action: FlowAccept, FlowCount: 1},
+					{PolicyID: "default", Action: FlowReject, DropReason: "policy", FlowCount: 4},
+				}},
+			},
+		}
+
+		Convey("Then I should only get the rejected links and their nodes", func() {
+			result := FindLinksMatchingDecision(graphData, FlowReject, "", "")
+			So(len(result.Links), ShouldEqual, 1)
+			So(result.Links[0].Target, ShouldEqual, "cache")
+			So(len(result.Nodes), ShouldEqual, 2)
+		})
+
+		Convey("Then criteria should match the same decision", func() {
+			So(len(FindLinksMatchingDecision(graphData, FlowAccept, "allow-db", "").Links), ShouldEqual, 2)
+			So(len(FindLinksMatchingDecision(graphData, FlowReject, "allow-db", "").Links), ShouldEqual, 0)
+			So(len(FindLinksMatchingDecision(graphData, "", "", "policy").Links), ShouldEqual, 1)
+		})
+
+		Convey("Then filtering by namespace should not add placeholder links", func() {
+			So(FindLinksBetweenGivenTimeAndOrNamespace(graphData.Links, time.Time{}, time.Time{}, "a"), ShouldResemble, graphData.Links[:1])
+		})
+	})
+}
+
+func TestDiffGraphs(t *testing.T) {
+
+	Convey("Given I have two graphs", t, func() {
+		before := &GraphData{
+			Nodes: []Node{{ContextID: "web"}, {ContextID: "db"}, {ContextID: "old"}},
+			Links: []Link{
+				{Source: "web", Target: "db", Action: FlowAccept},
+				{Source: "web", Target: "old", Action: FlowAccept},
+			},
+		}
+		after := &GraphData{
+			Nodes: []Node{{ContextID: "web"}, {ContextID: "db"}, {ContextID: "new"}},
+			Links: []Link{
+				{Source: "web", Target: "db", Action: FlowReject},
+				{Source: "web", Target: "new", Action: FlowAccept},
+			},
+		}
+
+		diff := DiffGraphs(before, after)
+
+		Convey("Then I should get the added, removed and changed elements", func() {
+			So(diff.Summary, ShouldResemble, DiffSummary{AddedNodes: 1, RemovedNodes: 1, AddedLinks: 1, RemovedLinks: 1, ChangedLinks: 1})
+			So(len(diff.Nodes), ShouldEqual, 4)
+			So(len(diff.Links), ShouldEqual, 3)
+			So(diff.Links[0].Diff, ShouldEqual, DiffChanged)
+			So(diff.Links[0].PreviousAction, ShouldEqual, FlowAccept)
+			So(diff.Links[1].Diff, ShouldEqual, DiffAdded)
+			So(diff.Links[2].Diff, ShouldEqual, DiffRemoved)
+			So(diff.Nodes[0].Diff, ShouldBeEmpty)
+			So(diff.Nodes[2].Diff, ShouldEqual, DiffAdded)
+			So(diff.Nodes[3].Diff, ShouldEqual, DiffRemoved)
+		})
+	})
+
+	Convey("Given I have two graphs with links whose node IDs concatenate alike", t, func() {
+		before := &GraphData{Links: []Link{{Source: "ext:10.0.0.0/2", Target: "4db", Action: FlowAccept}}}
+		after := &GraphData{Links: []Link{{Source: "ext:10.0.0.0/24", Target: "db", Action: FlowAccept}}}
+
+		diff := DiffGraphs(before, after)
+
+		Convey("Then the links should not be mistaken for one another", func() {
+			So(diff.Summary, ShouldResemble, DiffSummary{AddedLinks: 1, RemovedLinks: 1})
+		})
+	})
+}
+
+func TestStreamGraph(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I compute the delta between two generations", t, func() {
+		previous, _, _ := sampleGraphData(false)
+		next, _, _ := sampleGraphData(false)
+		next.Nodes = append(next.Nodes[:1], Node{ContextID: "new"})
+		next.Links[0].FlowCount = 10
+
+		delta := computeDelta(previous, next)
+
+		Convey("Then I should get the added, updated and removed elements", func() {
+			So(delta.Nodes, ShouldResemble, []Node{{ContextID: "new"}})
+			So(delta.RemovedNodes, ShouldResemble, []string{"14138259f129"})
+			So(len(delta.Links), ShouldEqual, 1)
+			So(delta.Links[0].FlowCount, ShouldEqual, 10)
+			So(delta.RemovedLinks, ShouldBeEmpty)
+		})
+
+		Convey("Then the same generation should have no delta", func() {
+			So(computeDelta(next, next).empty(), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a client streams the graph", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB")
+		testSampleGraphData, _, _ := sampleGraphData(false)
+		newTestGraph.publish(testSampleGraphData)
+
+		ts := httptest.NewServer(http.HandlerFunc(newTestGraph.StreamGraph))
+		defer ts.Close()
+
+		resp, err := http.Get(ts.URL)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		reader := bufio.NewReader(resp.Body)
+
+		readEvent := func() (string, string) {
+			var event, data string
+			for {
+				line, err := reader.ReadString('\n')
+				So(err, ShouldBeNil)
+				line = strings.TrimSuffix(line, "\n")
+				switch {
+				case line == "" && event != "":
+					return event, data
+				case strings.HasPrefix(line, "event: "):
+					event = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					data = strings.TrimPrefix(line, "data: ")
+				}
+			}
+		}
+
+		Convey("Then I should get the snapshot then the deltas", func() {
+			event, data := readEvent()
+			So(event, ShouldEqual, "snapshot")
+			var graphData GraphData
+			So(json.Unmarshal([]byte(data), &graphData), ShouldBeNil)
+			So(len(graphData.Nodes), ShouldEqual, 2)
+
+			next, _, _ := sampleGraphData(false)
+			next.Links = nil
+			newTestGraph.publish(next)
+
+			event, data = readEvent()
+			So(event, ShouldEqual, "delta")
+			var delta GraphDelta
+			So(json.Unmarshal([]byte(data), &delta), ShouldBeNil)
+			So(delta.RemovedLinks, ShouldResemble, []LinkID{{Source: "6f4b63dde673", Target: "14138259f129"}})
+		})
+	})
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// GraphDelta holds the changes between two generations of the graph. Nodes and
+// Links hold the added and updated elements.
+type GraphDelta struct {
+	Nodes        []Node   `json:"nodes"`
+	Links        []Link   `json:"links"`
+	RemovedNodes []string `json:"removedNodes"`
+	RemovedLinks []LinkID `json:"removedLinks"`
+}
+
+// LinkID identifies a link by its ends
+type LinkID struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// empty tells if the delta holds no change
+func (d *GraphDelta) empty() bool {
+
+	return len(d.Nodes) == 0 && len(d.Links) == 0 && len(d.RemovedNodes) == 0 && len(d.RemovedLinks) == 0
+}
+
+// computeDelta returns the changes from one generation of the graph to the next
+func computeDelta(previous *GraphData, next *GraphData) *GraphDelta {
+
+	delta := &GraphDelta{Nodes: []Node{}, Links: []Link{}, RemovedNodes: []string{}, RemovedLinks: []LinkID{}}
+
+	previousNodes := make(map[string]Node, len(previous.Nodes))
+	for _, node := range previous.Nodes {
+		previousNodes[node.ContextID] = node
+	}
+
+	nextNodes := make(map[string]bool, len(next.Nodes))
+	for _, node := range next.Nodes {
+		nextNodes[node.ContextID] = true
+		if old, ok := previousNodes[node.ContextID]; !ok || !reflect.DeepEqual(old, node) {
+			delta.Nodes = append(delta.Nodes, node)
+		}
+	}
+
+	for _, node := range previous.Nodes {
+		if !nextNodes[node.ContextID] {
+			delta.RemovedNodes = append(delta.RemovedNodes, node.ContextID)
+		}
+	}
+
+	previousLinks := make(map[LinkID]Link, len(previous.Links))
+	for _, link := range previous.Links {
+		previousLinks[link.id()] = link
+	}
+
+	nextLinks := make(map[LinkID]bool, len(next.Links))
+	for _, link := range next.Links {
+		id := link.id()
+		nextLinks[id] = true
+		if old, ok := previousLinks[id]; !ok || !reflect.DeepEqual(old, link) {
+			delta.Links = append(delta.Links, link)
+		}
+	}
+
+	for _, link := range previous.Links {
+		id := link.id()
+		if !nextLinks[id] {
+			delta.RemovedLinks = append(delta.RemovedLinks, id)
+		}
+	}
+
+	return delta
+}
+
+// broadcaster sends the deltas of the graph to the streaming clients
+type broadcaster struct {
+	subscribers map[chan *GraphDelta]struct{}
+
+	sync.Mutex
+}
+
+func newBroadcaster() *broadcaster {
+
+	return &broadcaster{
+		subscribers: make(map[chan *GraphDelta]struct{}),
+	}
+}
+
+func (b *broadcaster) active() bool {
+
+	b.Lock()
+	defer b.Unlock()
+
+	return len(b.subscribers) > 0
+}
+
+func (b *broadcaster) subscribe() chan *GraphDelta {
+
+	b.Lock()
+	defer b.Unlock()
+
+	c := make(chan *GraphDelta, streamBufferSize)
+	b.subscribers[c] = struct{}{}
+
+	return c
+}
+
+func (b *broadcaster) unsubscribe(c chan *GraphDelta) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.subscribers[c]; ok {
+		delete(b.subscribers, c)
+		close(c)
+	}
+}
+
+// send sends the delta to all the subscribers. Slow subscribers are disconnected
+// and get a new snapshot when they reconnect.
+func (b *broadcaster) send(delta *GraphDelta) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	for c := range b.subscribers {
+		select {
+		case c <- delta:
+		default:
+			zap.L().Warn("Disconnecting slow graph stream client")
+			delete(b.subscribers, c)
+			close(c)
+		}
+	}
+}
+
+// StreamGraph is the handler sending the graph as Server-Sent Events. A snapshot
+// event with the whole graph is sent first, then a delta event for every generation.
+func (g *Graph) StreamGraph(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribing before reading the snapshot ensures no generation is missed
+	deltas := g.stream.subscribe()
+	defer g.stream.unsubscribe(deltas)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if err := writeEvent(w, "snapshot", g.Snapshot()); err != nil {
+		zap.L().Debug("Writing graph snapshot", zap.Error(err))
+		return
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(streamKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case delta, ok := <-deltas:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, "delta", delta); err != nil {
+				zap.L().Debug("Writing graph delta", zap.Error(err))
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("Encoding %s %s", event, err)
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+
+	return err
+}
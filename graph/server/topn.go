@@ -0,0 +1,294 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// TopSources ranks the nodes sending flows
+	TopSources = "sources"
+	// TopDestinations ranks the nodes receiving flows
+	TopDestinations = "destinations"
+	// TopPairs ranks the couples of source and destination nodes
+	TopPairs = "pairs"
+	// TopPorts ranks the destination ports
+	TopPorts = "ports"
+	// TopPolicies ranks the policies deciding the flows
+	TopPolicies = "policies"
+
+	// TopOriginRollups is the origin of rankings computed from the rollups of the live graph
+	TopOriginRollups = "rollups"
+	// TopOriginFlows is the origin of rankings computed from the flows stored in influxdb
+	TopOriginFlows = "flows"
+)
+
+var topDimensions = map[string]bool{
+	TopSources:      true,
+	TopDestinations: true,
+	TopPairs:        true,
+	TopPorts:        true,
+	TopPolicies:     true,
+}
+
+// TopEndpoint is the name and namespace of a node
+type TopEndpoint struct {
+	ID        string `json:"-"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// TopEntry is a ranked source, destination, pair, port or policy with its flows
+type TopEntry struct {
+	Source        *TopEndpoint `json:"source,omitempty"`
+	Destination   *TopEndpoint `json:"destination,omitempty"`
+	Port          int          `json:"port,omitempty"`
+	PolicyID      string       `json:"policyID,omitempty"`
+	FlowCount     int          `json:"flowCount"`
+	AcceptedCount int          `json:"acceptedCount"`
+	RejectedCount int          `json:"rejectedCount"`
+}
+
+// TopResult is the ranking returned by the top API
+type TopResult struct {
+	By        string     `json:"by"`
+	Action    string     `json:"action,omitempty"`
+	Namespace string     `json:"namespace,omitempty"`
+	Start     time.Time  `json:"start"`
+	End       time.Time  `json:"end"`
+	Origin    string     `json:"origin"`
+	Entries   []TopEntry `json:"entries"`
+}
+
+// topEndpoint returns the name and namespace of a node of the live graph
+func (g *Graph) topEndpoint(nodeID string, id string, ip string) TopEndpoint {
+
+	if node, ok := g.nodeMap[getHash(id, ip)]; ok {
+		return nodeEndpoint(node)
+	}
+
+	endpoint := TopEndpoint{ID: nodeID, Name: nodeID}
+	if node, ok := g.externalMap[nodeID]; ok {
+		endpoint.Name = node.PodName
+	}
+
+	return endpoint
+}
+
+func nodeEndpoint(node *Node) TopEndpoint {
+
+	name := node.PodName
+	if name == "" {
+		name = node.ContextID
+	}
+
+	return TopEndpoint{ID: node.ContextID, Name: name, Namespace: node.Namespace}
+}
+
+// TopTalkers ranks the sources, destinations, pairs, ports or policies of the links
+// by their number of flows. With an action only the accepted or rejected flows are
+// ranked. With a namespace only the flows from or to the namespace are ranked.
+// Nodes are ranked by name so that the pus of a restarted pod are counted together.
+func TopTalkers(links []Link, endpoints map[string]TopEndpoint, by string, action string, namespace string, limit int) []TopEntry {
+
+	entries := map[string]*TopEntry{}
+	entry := func(key string, template TopEntry) *TopEntry {
+		e, ok := entries[key]
+		if !ok {
+			e = &template
+			entries[key] = e
+		}
+		return e
+	}
+
+	for _, link := range links {
+		src := endpoint(endpoints, link.Source)
+		dst := endpoint(endpoints, link.Target)
+		if namespace != "" && src.Namespace != namespace && dst.Namespace != namespace {
+			continue
+		}
+
+		switch by {
+		case TopSources:
+			entry(src.Namespace+"/"+src.Name, TopEntry{Source: &src}).add(link.AcceptedCount, link.RejectedCount)
+		case TopDestinations:
+			entry(dst.Namespace+"/"+dst.Name, TopEntry{Destination: &dst}).add(link.AcceptedCount, link.RejectedCount)
+		case TopPairs:
+			entry(src.Namespace+"/"+src.Name+" "+dst.Namespace+"/"+dst.Name, TopEntry{Source: &src, Destination: &dst}).add(link.AcceptedCount, link.RejectedCount)
+		case TopPorts:
+			for _, p := range link.Ports {
+				entry(strconv.Itoa(p.Port), TopEntry{Port: p.Port}).add(p.AcceptedCount, p.RejectedCount)
+			}
+		case TopPolicies:
+			for _, p := range link.Policies {
+				e := entry(p.PolicyID, TopEntry{PolicyID: p.PolicyID})
+				if p.Action == FlowAccept {
+					e.add(p.FlowCount, 0)
+				} else {
+					e.add(0, p.FlowCount)
+				}
+			}
+		}
+	}
+
+	result := []TopEntry{}
+	for _, e := range entries {
+		if e.count(action) > 0 {
+			result = append(result, *e)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		ci, cj := result[i].count(action), result[j].count(action)
+		if ci != cj {
+			return ci > cj
+		}
+		return result[i].key() < result[j].key()
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
+
+func endpoint(endpoints map[string]TopEndpoint, id string) TopEndpoint {
+
+	if e, ok := endpoints[id]; ok {
+		return e
+	}
+
+	return TopEndpoint{ID: id, Name: id}
+}
+
+func (e *TopEntry) add(accepted int, rejected int) {
+
+	e.AcceptedCount += accepted
+	e.RejectedCount += rejected
+	e.FlowCount += accepted + rejected
+}
+
+// count returns the flows of the entry ranked for the action
+func (e *TopEntry) count(action string) int {
+
+	switch action {
+	case FlowAccept:
+		return e.AcceptedCount
+	case FlowReject:
+		return e.RejectedCount
+	default:
+		return e.FlowCount
+	}
+}
+
+// key orders the entries with the same count
+func (e *TopEntry) key() string {
+
+	var key string
+	if e.Source != nil {
+		key += e.Source.Namespace + "/" + e.Source.Name
+	}
+	if e.Destination != nil {
+		key += " " + e.Destination.Namespace + "/" + e.Destination.Name
+	}
+
+	return fmt.Sprintf("%s%05d%s", key, e.Port, e.PolicyID)
+}
+
+// topLinks returns the links of the flows between starttime and endtime and their
+// endpoints, from the rollups when they cover the window
+func (g *Graph) topLinks(starttime time.Time, endtime time.Time) ([]Link, map[string]TopEndpoint, string, error) {
+
+	if g.rollups != nil && g.rollups.covers(starttime) {
+		links, endpoints := g.rollups.links(starttime, endtime)
+		return links, endpoints, TopOriginRollups, nil
+	}
+
+	graphData, err := g.historicalGraph(starttime, endtime)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	endpoints := make(map[string]TopEndpoint, len(graphData.Nodes))
+	for i := range graphData.Nodes {
+		endpoints[graphData.Nodes[i].ContextID] = nodeEndpoint(&graphData.Nodes[i])
+	}
+
+	return graphData.Links, endpoints, TopOriginFlows, nil
+}
+
+// GetTop is the handler ranking the sources, destinations, pairs, ports or policies
+// given by "by" by their number of flows between starttime and endtime, the last
+// hour by default. The ranking can be restricted to an action and a namespace.
+func (g *Graph) GetTop(w http.ResponseWriter, r *http.Request) {
+
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = TopSources
+	}
+	if !topDimensions[by] {
+		http.Error(w, "Unknown ranking "+by, http.StatusBadRequest)
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	if action != "" && action != FlowAccept && action != FlowReject {
+		http.Error(w, "Unknown action "+action, http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultTopLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxTopLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit %s, must be between 1 and %d", value, maxTopLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	window, err := parseWindow(r, "starttime", "endtime")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if window[1].IsZero() {
+		window[1] = time.Now()
+	}
+	if window[0].IsZero() {
+		window[0] = window[1].Add(-defaultTopWindow)
+	}
+	if window[1].Before(window[0]) {
+		http.Error(w, fmt.Sprintf("Invalid Time Window %s is before %s", window[1], window[0]), http.StatusBadRequest)
+		return
+	}
+
+	links, endpoints, origin, err := g.topLinks(window[0], window[1])
+	if err != nil {
+		zap.L().Error("Retrieving flows for ranking", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	result := TopResult{
+		By:        by,
+		Action:    action,
+		Namespace: namespace,
+		Start:     window[0],
+		End:       window[1],
+		Origin:    origin,
+		Entries:   TopTalkers(links, endpoints, by, action, namespace, limit),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme-statistics/influxdb/mock"
+	gomock "github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTopTalkers(t *testing.T) {
+
+	Convey("Given I rank the flows of links", t, func() {
+		endpoints := map[string]TopEndpoint{
+			"web-a": {ID: "web-a", Name: "web", Namespace: "default"},
+			"web-b": {ID: "web-b", Name: "web", Namespace: "default"},
+			"db":    {ID: "db", Name: "db", Namespace: "storage"},
+			"api":   {ID: "api", Name: "api", Namespace: "default"},
+		}
+		links := []Link{
+			{Source: "web-a", Target: "db", FlowCount: 5, AcceptedCount: 2, RejectedCount: 3,
+				Ports:    []LinkPort{{Port: 5432, FlowCount: 5, AcceptedCount: 2, RejectedCount: 3}},
+				Policies: []LinkPolicy{{PolicyID: "allow-db", Action: FlowAccept, FlowCount: 2}, {Action: FlowReject, FlowCount: 3}}},
+			{Source: "web-b", Target: "db", FlowCount: 4, AcceptedCount: 0, RejectedCount: 4,
+				Ports:    []LinkPort{{Port: 5432, FlowCount: 4, RejectedCount: 4}},
+				Policies: []LinkPolicy{{Action: FlowReject, FlowCount: 4}}},
+			{Source: "api", Target: "web-a", FlowCount: 10, AcceptedCount: 10,
+				Ports:    []LinkPort{{Port: 80, FlowCount: 10, AcceptedCount: 10}},
+				Policies: []LinkPolicy{{PolicyID: "allow-web", Action: FlowAccept, FlowCount: 10}}},
+		}
+
+		Convey("Then the sources should be ranked by flows with the pus of a pod counted together", func() {
+			entries := TopTalkers(links, endpoints, TopSources, "", "", 10)
+			So(len(entries), ShouldEqual, 2)
+			So(entries[0].Source.Name, ShouldEqual, "api")
+			So(entries[1].Source.Name, ShouldEqual, "web")
+			So(entries[1].FlowCount, ShouldEqual, 9)
+			So(entries[1].RejectedCount, ShouldEqual, 7)
+		})
+
+		Convey("Then the rejected flows should only rank the sources with rejected flows", func() {
+			entries := TopTalkers(links, endpoints, TopSources, FlowReject, "", 10)
+			So(len(entries), ShouldEqual, 1)
+			So(entries[0].Source.Name, ShouldEqual, "web")
+		})
+
+		Convey("Then the ports, pairs and policies should be ranked", func() {
+			So(TopTalkers(links, endpoints, TopPorts, "", "", 1), ShouldResemble, []TopEntry{{Port: 80, FlowCount: 10, AcceptedCount: 10}})
+
+			pairs := TopTalkers(links, endpoints, TopPairs, FlowReject, "", 10)
+			So(len(pairs), ShouldEqual, 1)
+			So(pairs[0].Destination.Name, ShouldEqual, "db")
+			So(pairs[0].RejectedCount, ShouldEqual, 7)
+
+			policies := TopTalkers(links, endpoints, TopPolicies, FlowReject, "", 10)
+			So(policies, ShouldResemble, []TopEntry{{FlowCount: 7, RejectedCount: 7}})
+		})
+
+		Convey("Then a namespace should keep the flows from or to it", func() {
+			entries := TopTalkers(links, endpoints, TopDestinations, "", "storage", 10)
+			So(len(entries), ShouldEqual, 1)
+			So(entries[0].Destination.Name, ShouldEqual, "db")
+		})
+	})
+}
+
+func TestGetTop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create a graph with rollups", t, func() {
+		newTestGraph := NewGraph(mockDataAdder, "testDB", OptionRollups(time.Hour))
+
+		testContainerResponse := getSampleInlfuxDBResponse(ContainerEvent)
+		testFlowResponse := getSampleInlfuxDBResponse(FlowEvent)
+		testFlowResponse.Results[0].Series[0].Values[0][FlowTimestampIndex] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano)
+
+		mockDataAdder.EXPECT().ExecuteQuery(FlowEventsQuery, "testDB").Return(&testFlowResponse, nil).Times(1)
+		_, err := newTestGraph.transform(&testContainerResponse)
+		So(err, ShouldBeNil)
+
+		Convey("When I request the top sources of the last hour", func() {
+			w := httptest.NewRecorder()
+			newTestGraph.GetTop(w, httptest.NewRequest("GET", "/top?by=sources&namespace=kube-system", nil))
+
+			var result TopResult
+			So(json.Unmarshal(w.Body.Bytes(), &result), ShouldBeNil)
+
+			Convey("Then they should be served from the rollups", func() {
+				So(w.Code, ShouldEqual, 200)
+				So(result.Origin, ShouldEqual, TopOriginRollups)
+				So(len(result.Entries), ShouldEqual, 1)
+				So(result.Entries[0].Source.Name, ShouldEqual, "aporeto-collector-sp9v9")
+				So(result.Entries[0].AcceptedCount, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When I request a window older than the rollups", func() {
+			start := time.Date(2017, 11, 8, 6, 0, 0, 0, time.UTC)
+			end := start.Add(time.Hour)
+			mockDataAdder.EXPECT().ExecuteQuery(windowQuery(ContainerEventsQuery, time.Time{}, end), "testDB").Return(&testContainerResponse, nil).Times(1)
+			mockDataAdder.EXPECT().ExecuteQuery(windowQuery(FlowEventsQuery, start, end), "testDB").Return(&testFlowResponse, nil).Times(1)
+
+			w := httptest.NewRecorder()
+			newTestGraph.GetTop(w, httptest.NewRequest("GET", "/top?by=ports&starttime=2017-11-08T06:00:00Z&endtime=2017-11-08T07:00:00Z", nil))
+
+			var result TopResult
+			So(json.Unmarshal(w.Body.Bytes(), &result), ShouldBeNil)
+
+			Convey("Then they should be computed from the stored flows", func() {
+				So(result.Origin, ShouldEqual, TopOriginFlows)
+				So(result.Entries, ShouldResemble, []TopEntry{{Port: 8086, FlowCount: 3, AcceptedCount: 3}})
+			})
+		})
+
+		Convey("When the minutes of the flows leave the retention", func() {
+			newTestGraph.rollups.complete(time.Now().Add(2 * time.Hour))
+
+			Convey("Then their endpoints should be dropped too", func() {
+				So(len(newTestGraph.rollups.buckets), ShouldBeZeroValue)
+				So(len(newTestGraph.rollups.endpoints), ShouldBeZeroValue)
+			})
+		})
+
+		Convey("When I request an unknown ranking", func() {
+			w := httptest.NewRecorder()
+			newTestGraph.GetTop(w, httptest.NewRequest("GET", "/top?by=hosts", nil))
+
+			Convey("Then I should get a bad request", func() {
+				So(w.Code, ShouldEqual, 400)
+			})
+		})
+	})
+}
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"sync/atomic"
 	"time"
 
+	"github.com/aporeto-inc/trireme-statistics/anomaly"
 	"github.com/aporeto-inc/trireme-statistics/influxdb"
 )
 
@@ -14,52 +16,129 @@ type GraphData struct {
 
 // Node which holds pu information
 type Node struct {
-	Time      time.Time `json:"time"`
-	ContextID string    `json:"id"`
-	PodName   string    `json:"name"`
-	IPAddress string    `json:"ipaddress"`
-	Namespace string    `json:"namespace"`
+	Time       time.Time         `json:"time"`
+	ContextID  string            `json:"id"`
+	PodName    string            `json:"name"`
+	IPAddress  string            `json:"ipaddress"`
+	Namespace  string            `json:"namespace"`
+	Type       string            `json:"type"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Members    []string          `json:"members,omitempty"`
+	Diff       string            `json:"diff,omitempty"`
+	// Anomalies describes the recent anomalies of the workload of the pu
+	Anomalies []string `json:"anomalies,omitempty"`
 }
 
 // Link which holds the links between pu's
 type Link struct {
-	Time      time.Time `json:"time"`
-	Source    string    `json:"source"`
-	Target    string    `json:"target"`
-	Action    string    `json:"action"`
-	Namespace string    `json:"namespace"`
+	Time      time.Time    `json:"time"`
+	Source    string       `json:"source"`
+	Target    string       `json:"target"`
+	Action    string       `json:"action"`
+	Namespace string       `json:"namespace"`
+	Ports     []LinkPort   `json:"ports,omitempty"`
+	Policies  []LinkPolicy `json:"policies,omitempty"`
+
+	FlowCount     int       `json:"flowCount"`
+	AcceptedCount int       `json:"acceptedCount"`
+	RejectedCount int       `json:"rejectedCount"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+
+	Diff           string `json:"diff,omitempty"`
+	PreviousAction string `json:"previousAction,omitempty"`
+
+	// Simulated marks the links with flows whose decision changes with proposed policies
+	Simulated string `json:"simulated,omitempty"`
+}
+
+// id returns the ID of the link, made of its ends
+func (l *Link) id() LinkID {
+
+	return LinkID{Source: l.Source, Target: l.Target}
+}
+
+// LinkPort holds the action and volume of the flows to one destination port of a link
+type LinkPort struct {
+	Port          int    `json:"port"`
+	Action        string `json:"action"`
+	FlowCount     int    `json:"flowCount"`
+	AcceptedCount int    `json:"acceptedCount"`
+	RejectedCount int    `json:"rejectedCount"`
+}
+
+// LinkPolicy holds the number of flows of a link decided by a policy with the same action and drop reason
+type LinkPolicy struct {
+	PolicyID   string `json:"policyID"`
+	Action     string `json:"action"`
+	DropReason string `json:"dropReason,omitempty"`
+	FlowCount  int    `json:"flowCount"`
 }
 
 // Graph which holds the fields for graph creation
 type Graph struct {
-	jsonData   *GraphData
+	// snapshot holds the latest published *GraphData, it is never modified once stored
+	snapshot   atomic.Value
 	httpClient influxdb.DataAdder
 	dbname     string
-	nodes      []Node
-	links      []Link
-	nodesChan  chan []Node
-	linksChan  chan []Link
 	nodeMap    map[string]*Node
-	linkMap    map[string]*Link
-	tagValue   string
+	linkMap    map[LinkID]*Link
+
+	// externalMap holds the nodes grouping the endpoints outside of Trireme
+	externalMap        map[string]*Node
+	externalDetail     string
+	externalCIDRPrefix int
+
+	// lastContainerTime and lastFlowTime are the time of the latest events applied to the graph
+	lastContainerTime time.Time
+	lastFlowTime      time.Time
+	// applied holds the events that the next generation reads again, to apply them once
+	applied map[eventKey]bool
+	rebuild chan struct{}
+
+	// history caches the graphs built for past time windows
+	history *historyCache
+	// stream sends the changes of every generation to the streaming clients
+	stream *broadcaster
+	// windowStart is the start of the time window of a graph built from history
+	windowStart time.Time
+
+	// detector scores the flows against the baseline of their workloads
+	detector *anomaly.Detector
+	// anomalyTime is the time of the latest flow scored by the detector
+	anomalyTime time.Time
+
+	// rollups aggregates the flows per minute for the rankings
+	rollups *rollups
 }
 
 // ContainerEvents struct to hold container event attributes
 type ContainerEvents struct {
-	contextID string
-	ipAddress string
-	timestamp string
-	tags      string
-	event     string
+	contextID  string
+	ipAddress  string
+	timestamp  string
+	tags       string
+	event      string
+	attributes map[string]string
 }
 
 // FlowEvents struct to hold flow event attributes
 type FlowEvents struct {
-	timestamp string
-	srcID     string
-	srcIP     string
-	dstID     string
-	dstIP     string
-	action    string
-	tags      string
+	timestamp     string
+	contextID     string
+	srcID         string
+	srcIP         string
+	srcType       int
+	dstID         string
+	dstIP         string
+	dstType       int
+	dstPort       int
+	counter       int
+	action        string
+	tags          string
+	policyID      string
+	dropReason    string
+	srcAttributes map[string]string
+	dstAttributes map[string]string
 }
@@ -0,0 +1,118 @@
+package enrichment
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+type cidrLabel struct {
+	network *net.IPNet
+	label   string
+}
+
+// CIDREnricher maps ip addresses to the label of the most specific CIDR they belong to
+type CIDREnricher struct {
+	networks []*cidrLabel
+}
+
+// NewCIDREnricherFromFile loads the CIDR labels from a file
+// Each line holds a CIDR followed by its label, for example
+//
+//	10.8.0.0/16   corp-vpn
+//	10.20.4.0/24  payments-db subnet
+//
+// Empty lines and lines starting with # are ignored
+func NewCIDREnricherFromFile(path string) (*CIDREnricher, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Opening CIDR file %s", err)
+	}
+	defer file.Close()
+
+	return NewCIDREnricher(file)
+}
+
+// NewCIDREnricher loads the CIDR labels from the given reader
+func NewCIDREnricher(r io.Reader) (*CIDREnricher, error) {
+
+	var networks []*cidrLabel
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// The CIDR ends at the first run of spaces or tabs, the label is the rest of the line
+		cidr := strings.Fields(text)[0]
+		label := strings.TrimSpace(strings.TrimPrefix(text, cidr))
+		if label == "" {
+			return nil, fmt.Errorf("Missing label on line %d", line)
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CIDR on line %d: %s", line, err)
+		}
+
+		networks = append(networks, &cidrLabel{
+			network: network,
+			label:   label,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Reading CIDR labels %s", err)
+	}
+
+	// Most specific networks first so that the first match wins
+	sort.SliceStable(networks, func(i, j int) bool {
+		si, _ := networks[i].network.Mask.Size()
+		sj, _ := networks[j].network.Mask.Size()
+		return si > sj
+	})
+
+	return &CIDREnricher{
+		networks: networks,
+	}, nil
+}
+
+// Enrich implements the Enricher interface
+func (c *CIDREnricher) Enrich(ip string) *Attributes {
+
+	label := c.Lookup(ip)
+	if label == "" {
+		return nil
+	}
+
+	return &Attributes{
+		Tags: map[string]string{
+			Label: label,
+		},
+	}
+}
+
+// Lookup returns the label of the most specific CIDR containing ip
+func (c *CIDREnricher) Lookup(ip string) string {
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return ""
+	}
+
+	for _, network := range c.networks {
+		if network.network.Contains(parsedIP) {
+			return network.label
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,61 @@
+package enrichment
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCIDREnricher(t *testing.T) {
+
+	Convey("Given I load CIDR labels", t, func() {
+		labels := `
+# corporate networks
+10.8.0.0/16 corp-vpn
+10.20.4.0/24 payments-db subnet
+10.20.0.0/16 cluster
+10.30.0.0/16	staging cluster
+10.40.0.0/16 	  build farm
+`
+		enricher, err := NewCIDREnricher(strings.NewReader(labels))
+		So(err, ShouldBeNil)
+
+		Convey("Then the most specific label should win", func() {
+			So(enricher.Lookup("10.20.4.12"), ShouldEqual, "payments-db subnet")
+			So(enricher.Lookup("10.20.9.1"), ShouldEqual, "cluster")
+			So(enricher.Lookup("10.8.1.1"), ShouldEqual, "corp-vpn")
+		})
+
+		Convey("Then the labels should be split from the CIDR on any whitespace", func() {
+			So(enricher.Lookup("10.30.0.1"), ShouldEqual, "staging cluster")
+			So(enricher.Lookup("10.40.0.1"), ShouldEqual, "build farm")
+		})
+
+		Convey("Then unknown addresses should not be enriched", func() {
+			So(enricher.Enrich("192.168.0.1"), ShouldBeNil)
+			So(enricher.Enrich("invalidIP"), ShouldBeNil)
+		})
+
+		Convey("Then the label should be written as a tag", func() {
+			tags := map[string]string{}
+			fields := map[string]interface{}{}
+			Apply([]Enricher{enricher}, "10.8.0.1", "Source", tags, fields)
+			So(tags["SourceLabel"], ShouldEqual, "corp-vpn")
+			So(len(fields), ShouldBeZeroValue)
+		})
+	})
+
+	Convey("Given I load invalid CIDR labels", t, func() {
+
+		Convey("Then a missing label should fail", func() {
+			_, err := NewCIDREnricher(strings.NewReader("10.0.0.0/8"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Then an invalid CIDR should fail", func() {
+			_, err := NewCIDREnricher(strings.NewReader("10.0.0.300/8 label"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,150 @@
+package enrichment
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDNSTimeout    = 500 * time.Millisecond
+	defaultDNSTTL        = 10 * time.Minute
+	defaultDNSCacheLimit = 10000
+	defaultDNSLookups    = 16
+)
+
+type dnsCacheEntry struct {
+	hostname string
+	expiry   time.Time
+}
+
+// DNSEnricher resolves ip addresses to hostnames and caches the answers
+// The lookups run in the background so that the worker never waits on DNS:
+// the records of an address are written without hostname until it is resolved.
+// Failed lookups are cached as well so that unresolvable addresses are not
+// looked up again on every record.
+type DNSEnricher struct {
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	timeout    time.Duration
+	ttl        time.Duration
+	cacheLimit int
+	maxLookups int
+	cache      map[string]*dnsCacheEntry
+	pending    map[string]bool
+	lookups    sync.WaitGroup
+
+	sync.Mutex
+}
+
+// NewDNSEnricher returns an enricher doing reverse DNS lookups
+// A zero timeout or ttl selects the default value
+func NewDNSEnricher(timeout time.Duration, ttl time.Duration) *DNSEnricher {
+
+	if timeout == 0 {
+		timeout = defaultDNSTimeout
+	}
+	if ttl == 0 {
+		ttl = defaultDNSTTL
+	}
+
+	return &DNSEnricher{
+		lookupAddr: net.DefaultResolver.LookupAddr,
+		timeout:    timeout,
+		ttl:        ttl,
+		cacheLimit: defaultDNSCacheLimit,
+		maxLookups: defaultDNSLookups,
+		cache:      make(map[string]*dnsCacheEntry),
+		pending:    make(map[string]bool),
+	}
+}
+
+// Enrich implements the Enricher interface
+func (d *DNSEnricher) Enrich(ip string) *Attributes {
+
+	hostname := d.lookup(ip)
+	if hostname == "" {
+		return nil
+	}
+
+	return &Attributes{
+		Fields: map[string]interface{}{
+			Hostname: hostname,
+		},
+	}
+}
+
+// lookup returns the cached hostname of ip and starts resolving it in the
+// background when it is missing or expired. Expired hostnames are still
+// returned while they are refreshed.
+func (d *DNSEnricher) lookup(ip string) string {
+
+	d.Lock()
+	defer d.Unlock()
+
+	entry, ok := d.cache[ip]
+	if ok && time.Now().Before(entry.expiry) {
+		return entry.hostname
+	}
+
+	// At most maxLookups run at once, the others are retried on the next record
+	if !d.pending[ip] && len(d.pending) < d.maxLookups {
+		d.pending[ip] = true
+		d.lookups.Add(1)
+		go d.resolve(ip)
+	}
+
+	if ok {
+		return entry.hostname
+	}
+
+	return ""
+}
+
+// resolve does the reverse lookup of ip and caches the answer
+func (d *DNSEnricher) resolve(ip string) {
+
+	defer d.lookups.Done()
+
+	var hostname string
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	names, err := d.lookupAddr(ctx, ip)
+	if err != nil {
+		zap.L().Debug("Reverse DNS lookup failed", zap.String("ip", ip), zap.Error(err))
+	} else if len(names) > 0 {
+		hostname = strings.TrimSuffix(names[0], ".")
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	delete(d.pending, ip)
+	if len(d.cache) >= d.cacheLimit {
+		d.purge()
+	}
+	d.cache[ip] = &dnsCacheEntry{
+		hostname: hostname,
+		expiry:   time.Now().Add(d.ttl),
+	}
+}
+
+// purge removes the expired entries from the cache. If the cache is still full
+// it is reset. Must be called with the lock held.
+func (d *DNSEnricher) purge() {
+
+	now := time.Now()
+	for ip, entry := range d.cache {
+		if now.After(entry.expiry) {
+			delete(d.cache, ip)
+		}
+	}
+
+	if len(d.cache) >= d.cacheLimit {
+		d.cache = make(map[string]*dnsCacheEntry)
+	}
+}
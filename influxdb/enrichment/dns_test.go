@@ -0,0 +1,105 @@
+package enrichment
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDNSEnricher(t *testing.T) {
+
+	Convey("Given I have a DNS enricher", t, func() {
+		enricher := NewDNSEnricher(20*time.Millisecond, time.Minute)
+
+		var calls int32
+		enricher.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+			atomic.AddInt32(&calls, 1)
+			if addr == "10.0.0.1" {
+				return []string{"db.example.com."}, nil
+			}
+			return nil, fmt.Errorf("no such host")
+		}
+
+		Convey("When I enrich a new address", func() {
+			attributes := enricher.Enrich("10.0.0.1")
+
+			Convey("Then it should not wait for the lookup", func() {
+				So(attributes, ShouldBeNil)
+			})
+
+			Convey("Then the hostname should be cached once resolved", func() {
+				enricher.lookups.Wait()
+				So(enricher.Enrich("10.0.0.1").Fields[Hostname], ShouldEqual, "db.example.com")
+				So(enricher.Enrich("10.0.0.1").Fields[Hostname], ShouldEqual, "db.example.com")
+				So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When I enrich an unresolvable address", func() {
+			enricher.Enrich("10.0.0.2")
+			enricher.lookups.Wait()
+
+			Convey("Then the miss should be cached", func() {
+				So(enricher.Enrich("10.0.0.2"), ShouldBeNil)
+				enricher.lookups.Wait()
+				So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the cached hostname expires", func() {
+			enricher.Enrich("10.0.0.1")
+			enricher.lookups.Wait()
+			enricher.cache["10.0.0.1"].expiry = time.Now().Add(-time.Second)
+
+			Convey("Then it should still be returned while it is refreshed", func() {
+				So(enricher.Enrich("10.0.0.1").Fields[Hostname], ShouldEqual, "db.example.com")
+				enricher.lookups.Wait()
+				So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+				So(enricher.cache["10.0.0.1"].expiry, ShouldHappenAfter, time.Now())
+			})
+		})
+	})
+
+	Convey("Given I have a DNS enricher with a server that does not answer", t, func() {
+		enricher := NewDNSEnricher(20*time.Millisecond, time.Minute)
+		enricher.maxLookups = 2
+
+		var calls int32
+		enricher.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+			atomic.AddInt32(&calls, 1)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+
+		Convey("When I enrich addresses", func() {
+			start := time.Now()
+			enricher.Enrich("10.0.0.1")
+			enricher.Enrich("10.0.0.1")
+			enricher.Enrich("10.0.0.2")
+			enricher.Enrich("10.0.0.3")
+			elapsed := time.Since(start)
+			enricher.lookups.Wait()
+
+			Convey("Then the enrichment should not block on the lookups", func() {
+				So(elapsed, ShouldBeLessThan, 20*time.Millisecond)
+			})
+
+			Convey("Then the lookups in flight should be bounded", func() {
+				So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+				So(enricher.cache, ShouldNotContainKey, "10.0.0.3")
+			})
+
+			Convey("Then the timed out lookups should be cached as misses", func() {
+				So(enricher.Enrich("10.0.0.1"), ShouldBeNil)
+				So(enricher.Enrich("10.0.0.2"), ShouldBeNil)
+				enricher.lookups.Wait()
+				So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+				So(len(enricher.pending), ShouldBeZeroValue)
+			})
+		})
+	})
+}
@@ -0,0 +1,52 @@
+package enrichment
+
+const (
+	// Hostname is the attribute holding the reverse DNS name of an ip address
+	Hostname = "Hostname"
+	// Label is the attribute holding the label of the CIDR an ip address belongs to
+	Label = "Label"
+	// Country is the attribute holding the ISO code of the country an ip address is located in
+	Country = "Country"
+	// ASN is the attribute holding the autonomous system number of an ip address
+	ASN = "ASN"
+	// ASOrganization is the attribute holding the autonomous system organization of an ip address
+	ASOrganization = "ASOrganization"
+)
+
+// AttributeNames is the list of all the attributes the built-in enrichers can produce
+var AttributeNames = []string{Hostname, Label, Country, ASN, ASOrganization}
+
+// Attributes holds the context added by an enricher for a given ip address
+// Tags are indexed by InfluxDB and should be kept low cardinality
+type Attributes struct {
+	Tags   map[string]string
+	Fields map[string]interface{}
+}
+
+// Enricher is the interface implemented by every enrichment stage
+type Enricher interface {
+	// Enrich returns the attributes known for the given ip address or nil
+	Enrich(ip string) *Attributes
+}
+
+// Apply runs all the enrichers for the given ip address and merges the attributes
+// into tags and fields, prefixing every key with prefix
+func Apply(enrichers []Enricher, ip string, prefix string, tags map[string]string, fields map[string]interface{}) {
+
+	if ip == "" {
+		return
+	}
+
+	for _, enricher := range enrichers {
+		attributes := enricher.Enrich(ip)
+		if attributes == nil {
+			continue
+		}
+		for k, v := range attributes.Tags {
+			tags[prefix+k] = v
+		}
+		for k, v := range attributes.Fields {
+			fields[prefix+k] = v
+		}
+	}
+}
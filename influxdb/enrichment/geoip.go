@@ -0,0 +1,92 @@
+package enrichment
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	maxminddb "github.com/oschwald/maxminddb-golang"
+)
+
+// geoRecord holds the subset of the MaxMind Country, City and ASN databases we use
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN            uint   `maxminddb:"autonomous_system_number"`
+	ASOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// GeoIPEnricher looks up the country and autonomous system of ip addresses
+// in local MaxMind-format databases
+type GeoIPEnricher struct {
+	readers []*maxminddb.Reader
+}
+
+// NewGeoIPEnricher opens the given MaxMind databases. A country (or city) and
+// an ASN database can be given together, the results are merged.
+func NewGeoIPEnricher(paths ...string) (*GeoIPEnricher, error) {
+
+	g := &GeoIPEnricher{}
+
+	for _, path := range paths {
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			g.Close()
+			return nil, fmt.Errorf("Opening GeoIP database %s: %s", path, err)
+		}
+		g.readers = append(g.readers, reader)
+	}
+
+	return g, nil
+}
+
+// Enrich implements the Enricher interface
+func (g *GeoIPEnricher) Enrich(ip string) *Attributes {
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil
+	}
+
+	var record geoRecord
+	for _, reader := range g.readers {
+		if err := reader.Lookup(parsedIP, &record); err != nil {
+			zap.L().Debug("GeoIP lookup failed", zap.String("ip", ip), zap.Error(err))
+		}
+	}
+
+	if record.Country.ISOCode == "" && record.ASN == 0 {
+		return nil
+	}
+
+	attributes := &Attributes{
+		Tags:   map[string]string{},
+		Fields: map[string]interface{}{},
+	}
+	if record.Country.ISOCode != "" {
+		attributes.Tags[Country] = record.Country.ISOCode
+	}
+	if record.ASN != 0 {
+		attributes.Tags[ASN] = strconv.FormatUint(uint64(record.ASN), 10)
+	}
+	if record.ASOrganization != "" {
+		attributes.Fields[ASOrganization] = record.ASOrganization
+	}
+
+	return attributes
+}
+
+// Close releases the databases
+func (g *GeoIPEnricher) Close() error {
+
+	for _, reader := range g.readers {
+		if err := reader.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package enrichment
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mmdbValue encodes a value of the MaxMind DB data section, only the types used
+// by the test databases are supported
+func mmdbValue(v interface{}) []byte {
+
+	// Sizes from 29 to 284 are given by the byte following the type
+	control := func(kind byte, size int) []byte {
+		var extra []byte
+		if size >= 29 {
+			size, extra = 29, []byte{byte(size - 29)}
+		}
+		return append([]byte{kind<<5 | byte(size)}, extra...)
+	}
+
+	unsigned := func(kind byte, n uint64) []byte {
+		var data []byte
+		for ; n > 0; n >>= 8 {
+			data = append([]byte{byte(n)}, data...)
+		}
+		return append(control(kind, len(data)), data...)
+	}
+
+	switch value := v.(type) {
+	case string:
+		return append(control(2, len(value)), value...)
+	case uint16:
+		return unsigned(5, uint64(value))
+	case uint32:
+		return unsigned(6, uint64(value))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		data := control(7, len(value))
+		for _, k := range keys {
+			data = append(data, mmdbValue(k)...)
+			data = append(data, mmdbValue(value[k])...)
+		}
+		return data
+	}
+
+	panic("unsupported MaxMind DB value")
+}
+
+// writeMMDB writes an IPv4 MaxMind DB resolving every address to record
+func writeMMDB(path string, record map[string]interface{}) {
+
+	// A single node whose both records point to the first data entry
+	tree := make([]byte, 8)
+	binary.BigEndian.PutUint32(tree[0:4], 1+16)
+	binary.BigEndian.PutUint32(tree[4:8], 1+16)
+
+	var db []byte
+	db = append(db, tree[1:4]...)
+	db = append(db, tree[5:8]...)
+	db = append(db, make([]byte, 16)...)
+	db = append(db, mmdbValue(record)...)
+	db = append(db, "\xAB\xCD\xEFMaxMind.com"...)
+	db = append(db, mmdbValue(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"database_type":               "Test",
+		"ip_version":                  uint16(4),
+		"node_count":                  uint32(1),
+		"record_size":                 uint16(24),
+	})...)
+
+	So(ioutil.WriteFile(path, db, 0600), ShouldBeNil)
+}
+
+func TestGeoIPEnricher(t *testing.T) {
+
+	Convey("Given I have a country and an ASN database", t, func() {
+		dir, err := ioutil.TempDir("", "geoip")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		country := filepath.Join(dir, "country.mmdb")
+		writeMMDB(country, map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "FR"},
+		})
+		asn := filepath.Join(dir, "asn.mmdb")
+		writeMMDB(asn, map[string]interface{}{
+			"autonomous_system_number":       uint32(3215),
+			"autonomous_system_organization": "Orange",
+		})
+
+		Convey("When I open them together", func() {
+			enricher, err := NewGeoIPEnricher(country, asn)
+			So(err, ShouldBeNil)
+			defer enricher.Close()
+
+			Convey("Then the results should be merged", func() {
+				attributes := enricher.Enrich("90.84.1.1")
+				So(attributes.Tags, ShouldResemble, map[string]string{Country: "FR", ASN: "3215"})
+				So(attributes.Fields, ShouldResemble, map[string]interface{}{ASOrganization: "Orange"})
+			})
+
+			Convey("Then invalid addresses should not be enriched", func() {
+				So(enricher.Enrich("invalidIP"), ShouldBeNil)
+			})
+		})
+
+		Convey("When I open a database without country or ASN", func() {
+			empty := filepath.Join(dir, "empty.mmdb")
+			writeMMDB(empty, map[string]interface{}{"city": "Paris"})
+			enricher, err := NewGeoIPEnricher(empty)
+			So(err, ShouldBeNil)
+			defer enricher.Close()
+
+			Convey("Then the addresses should not be enriched", func() {
+				So(enricher.Enrich("90.84.1.1"), ShouldBeNil)
+			})
+		})
+
+		Convey("When I open a database that does not exist", func() {
+			_, err := NewGeoIPEnricher(country, filepath.Join(dir, "missing.mmdb"))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,366 @@
+package filter
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.cloud.top/DSec/trireme-lib/collector"
+	"git.cloud.top/DSec/trireme-lib/policy"
+)
+
+const (
+	// namespaceFromContainerTags is the tag holding the namespace of a pu in container events
+	namespaceFromContainerTags = "@usr:io.kubernetes.pod.namespace"
+	// namespaceFromFlowTags is the tag holding the namespace of the pu reporting a flow
+	namespaceFromFlowTags = "@namespace"
+
+	defaultLimitInterval = time.Minute
+)
+
+// RuleStats holds the counters of a rule
+type RuleStats struct {
+	Name    string `json:"name"`
+	Hits    uint64 `json:"hits"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// compiledRule is a rule with its criteria parsed and its counters
+type compiledRule struct {
+	hits    uint64
+	dropped uint64
+
+	rule             *Rule
+	cidrs            []*net.IPNet
+	sourceCIDRs      []*net.IPNet
+	destinationCIDRs []*net.IPNet
+	sourcePorts      []portRange
+	destinationPorts []portRange
+
+	// sampling and limiting state
+	seen        int
+	windowStart time.Time
+	windowCount int
+}
+
+// Filter decides which events are written to the database
+// Events are processed by a single worker but the counters can be read concurrently
+type Filter struct {
+	rules []*compiledRule
+
+	// namespaces maps the ContextID of known pus to their namespace
+	namespaces map[string]string
+
+	sync.Mutex
+}
+
+// NewFilter compiles the rules into a filter
+func NewFilter(rules *Rules) (*Filter, error) {
+
+	f := &Filter{
+		namespaces: make(map[string]string),
+	}
+
+	if rules == nil {
+		return f, nil
+	}
+
+	for i, rule := range rules.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("Rule %s: %s", rule.Name, err)
+		}
+		f.rules = append(f.rules, compiled)
+	}
+
+	return f, nil
+}
+
+func compileRule(rule *Rule) (*compiledRule, error) {
+
+	switch rule.Match.Event {
+	case "", EventFlow, EventContainer:
+	default:
+		return nil, fmt.Errorf("Unknown event %s", rule.Match.Event)
+	}
+
+	switch rule.Action {
+	case ActionDrop:
+	case ActionSample:
+		if rule.Every < 1 {
+			return nil, fmt.Errorf("Sample requires every to be at least 1")
+		}
+	case ActionLimit:
+		if rule.Limit < 0 {
+			return nil, fmt.Errorf("Limit can not be negative")
+		}
+		if rule.Interval == 0 {
+			rule.Interval = defaultLimitInterval
+		}
+	default:
+		return nil, fmt.Errorf("Unknown action %s", rule.Action)
+	}
+
+	compiled := &compiledRule{rule: rule}
+
+	var err error
+	if compiled.cidrs, err = parseCIDRs(rule.Match.CIDR); err != nil {
+		return nil, err
+	}
+	if compiled.sourceCIDRs, err = parseCIDRs(rule.Match.SourceCIDR); err != nil {
+		return nil, err
+	}
+	if compiled.destinationCIDRs, err = parseCIDRs(rule.Match.DestinationCIDR); err != nil {
+		return nil, err
+	}
+	if compiled.sourcePorts, err = parsePortRanges(rule.Match.SourcePort); err != nil {
+		return nil, err
+	}
+	if compiled.destinationPorts, err = parsePortRanges(rule.Match.DestinationPort); err != nil {
+		return nil, err
+	}
+
+	return compiled, nil
+}
+
+// KeepFlow returns false if the flow event must be dropped
+func (f *Filter) KeepFlow(record *collector.FlowRecord) bool {
+
+	f.Lock()
+	defer f.Unlock()
+
+	for _, rule := range f.rules {
+		if rule.matchFlow(record, f.flowNamespace(record, record.Source), f.flowNamespace(record, record.Destination)) {
+			return rule.apply()
+		}
+	}
+
+	return true
+}
+
+// KeepContainer returns false if the container event must be dropped
+// Every container event is used to learn the namespace of the pus, including dropped ones.
+func (f *Filter) KeepContainer(record *collector.ContainerRecord) bool {
+
+	f.Lock()
+	defer f.Unlock()
+
+	namespace := tagValue(record.Tags, namespaceFromContainerTags)
+
+	switch record.Event {
+	case collector.ContainerDelete, collector.ContainerStop:
+		delete(f.namespaces, record.ContextID)
+	default:
+		if namespace != "" {
+			f.namespaces[record.ContextID] = namespace
+		}
+	}
+
+	for _, rule := range f.rules {
+		if rule.matchContainer(record, namespace) {
+			return rule.apply()
+		}
+	}
+
+	return true
+}
+
+// Stats returns the counters of every rule
+func (f *Filter) Stats() []RuleStats {
+
+	stats := make([]RuleStats, len(f.rules))
+	for i, rule := range f.rules {
+		stats[i] = RuleStats{
+			Name:    rule.rule.Name,
+			Hits:    atomic.LoadUint64(&rule.hits),
+			Dropped: atomic.LoadUint64(&rule.dropped),
+		}
+	}
+
+	return stats
+}
+
+// flowNamespace returns the namespace of one end of a flow. Must be called with the lock held.
+func (f *Filter) flowNamespace(record *collector.FlowRecord, endpoint *collector.EndPoint) string {
+
+	if namespace, ok := f.namespaces[endpoint.ID]; ok {
+		return namespace
+	}
+
+	// The tags of a flow belong to the pu reporting it
+	if endpoint.ID == record.ContextID {
+		return tagValue(record.Tags, namespaceFromFlowTags)
+	}
+
+	return ""
+}
+
+// apply counts a hit and returns whether the event is kept
+func (r *compiledRule) apply() bool {
+
+	atomic.AddUint64(&r.hits, 1)
+
+	keep := false
+	switch r.rule.Action {
+	case ActionSample:
+		r.seen++
+		if r.seen >= r.rule.Every {
+			r.seen = 0
+			keep = true
+		}
+	case ActionLimit:
+		now := time.Now()
+		if now.Sub(r.windowStart) >= r.rule.Interval {
+			r.windowStart = now
+			r.windowCount = 0
+		}
+		if r.windowCount < r.rule.Limit {
+			r.windowCount++
+			keep = true
+		}
+	}
+
+	if !keep {
+		atomic.AddUint64(&r.dropped, 1)
+	}
+
+	return keep
+}
+
+func (r *compiledRule) matchFlow(record *collector.FlowRecord, srcNamespace string, dstNamespace string) bool {
+
+	m := r.rule.Match
+
+	if m.Event == EventContainer || len(m.Namespace) > 0 || len(r.cidrs) > 0 {
+		return false
+	}
+
+	return matchString(m.SourceNamespace, srcNamespace) &&
+		matchString(m.DestinationNamespace, dstNamespace) &&
+		matchTags(m.Tags, record.Tags) &&
+		matchCIDR(r.sourceCIDRs, record.Source.IP) &&
+		matchCIDR(r.destinationCIDRs, record.Destination.IP) &&
+		matchPort(r.sourcePorts, record.Source.Port) &&
+		matchPort(r.destinationPorts, record.Destination.Port) &&
+		matchString(m.Action, record.Action.ActionString())
+}
+
+func (r *compiledRule) matchContainer(record *collector.ContainerRecord, namespace string) bool {
+
+	m := r.rule.Match
+
+	if m.Event == EventFlow || len(m.SourceNamespace) > 0 || len(m.DestinationNamespace) > 0 ||
+		len(r.sourceCIDRs) > 0 || len(r.destinationCIDRs) > 0 ||
+		len(r.sourcePorts) > 0 || len(r.destinationPorts) > 0 || len(m.Action) > 0 {
+		return false
+	}
+
+	if !matchString(m.Namespace, namespace) || !matchTags(m.Tags, record.Tags) {
+		return false
+	}
+
+	if len(r.cidrs) == 0 {
+		return true
+	}
+
+	for _, ip := range record.IPAddress {
+		if matchCIDR(r.cidrs, ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchString(values []string, value string) bool {
+
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchTags(tags []string, store *policy.TagStore) bool {
+
+	for _, tag := range tags {
+		if store == nil || !hasTag(store.Tags, tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasTag(tags []string, tag string) bool {
+
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchCIDR(networks []*net.IPNet, ip string) bool {
+
+	if len(networks) == 0 {
+		return true
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(parsedIP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchPort(ranges []portRange, port uint16) bool {
+
+	if len(ranges) == 0 {
+		return true
+	}
+
+	for _, r := range ranges {
+		if port >= r.from && port <= r.to {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tagValue(store *policy.TagStore, key string) string {
+
+	if store == nil {
+		return ""
+	}
+
+	prefix := key + "="
+	for _, tag := range store.Tags {
+		if len(tag) > len(prefix) && tag[:len(prefix)] == prefix {
+			return tag[len(prefix):]
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,120 @@
+package filter
+
+import (
+	"testing"
+
+	"git.cloud.top/DSec/trireme-lib/collector"
+	"git.cloud.top/DSec/trireme-lib/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testRules = `
+rules:
+  - name: kubelet-probes
+    match:
+      event: flow
+      destinationNamespace: [kube-system]
+      destinationPort: ["10250-10255"]
+      action: [accept]
+    action: drop
+  - name: dns
+    match:
+      destinationCIDR: [10.0.0.10]
+      destinationPort: [53]
+    action: sample
+    every: 3
+  - name: pause-containers
+    match:
+      event: container
+      tags: ["@sys:image=gcr.io/google_containers/pause-amd64:3.0"]
+    action: drop
+`
+
+func flowRecord(dstID string, dstIP string, dstPort uint16) *collector.FlowRecord {
+
+	return &collector.FlowRecord{
+		ContextID:   "src",
+		Source:      &collector.EndPoint{ID: "src", IP: "10.20.0.1", Port: 40000},
+		Destination: &collector.EndPoint{ID: dstID, IP: dstIP, Port: dstPort},
+		Tags:        &policy.TagStore{Tags: []string{"@namespace=default"}},
+		Action:      policy.Accept,
+	}
+}
+
+func TestFilter(t *testing.T) {
+
+	Convey("Given I load filtering rules", t, func() {
+		rules, err := ParseRules([]byte(testRules))
+		So(err, ShouldBeNil)
+		f, err := NewFilter(rules)
+		So(err, ShouldBeNil)
+
+		Convey("When the destination namespace was learnt from a container event", func() {
+			So(f.KeepContainer(&collector.ContainerRecord{
+				ContextID: "kubelet",
+				Event:     collector.ContainerStart,
+				Tags:      &policy.TagStore{Tags: []string{"@usr:io.kubernetes.pod.namespace=kube-system"}},
+			}), ShouldBeTrue)
+
+			Convey("Then probes to it should be dropped and counted", func() {
+				So(f.KeepFlow(flowRecord("kubelet", "10.20.1.1", 10250)), ShouldBeFalse)
+				So(f.KeepFlow(flowRecord("kubelet", "10.20.1.1", 8080)), ShouldBeTrue)
+				So(f.Stats()[0], ShouldResemble, RuleStats{Name: "kubelet-probes", Hits: 1, Dropped: 1})
+			})
+		})
+
+		Convey("When the destination namespace is unknown", func() {
+
+			Convey("Then probes should be kept", func() {
+				So(f.KeepFlow(flowRecord("kubelet", "10.20.1.1", 10250)), ShouldBeTrue)
+			})
+		})
+
+		Convey("When flows are sampled", func() {
+			kept := 0
+			for i := 0; i < 9; i++ {
+				if f.KeepFlow(flowRecord("dns", "10.0.0.10", 53)) {
+					kept++
+				}
+			}
+
+			Convey("Then one out of every 3 should be kept", func() {
+				So(kept, ShouldEqual, 3)
+				So(f.Stats()[1], ShouldResemble, RuleStats{Name: "dns", Hits: 9, Dropped: 6})
+			})
+		})
+
+		Convey("When a container event matches the tags", func() {
+
+			Convey("Then it should be dropped", func() {
+				So(f.KeepContainer(&collector.ContainerRecord{
+					ContextID: "pause",
+					Event:     collector.ContainerStart,
+					Tags:      &policy.TagStore{Tags: []string{"@sys:image=gcr.io/google_containers/pause-amd64:3.0"}},
+				}), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given I load invalid filtering rules", t, func() {
+
+		Convey("Then an unknown action should fail", func() {
+			rules, err := ParseRules([]byte("rules:\n  - name: x\n    action: explode\n"))
+			So(err, ShouldBeNil)
+			_, err = NewFilter(rules)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Then an invalid port range should fail", func() {
+			rules, err := ParseRules([]byte("rules:\n  - action: drop\n    match:\n      destinationPort: [\"90-80\"]\n"))
+			So(err, ShouldBeNil)
+			_, err = NewFilter(rules)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Then an unknown field should fail", func() {
+			_, err := ParseRules([]byte("rules:\n  - action: drop\n    match:\n      port: [80]\n"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// ActionDrop drops every matching event
+	ActionDrop = "drop"
+	// ActionSample keeps one out of every N matching events
+	ActionSample = "sample"
+	// ActionLimit keeps at most N matching events per interval
+	ActionLimit = "limit"
+)
+
+const (
+	// EventFlow restricts a rule to flow events
+	EventFlow = "flow"
+	// EventContainer restricts a rule to container events
+	EventContainer = "container"
+)
+
+// Rules is the list of filtering rules. The first matching rule decides the fate of an event.
+//
+//	rules:
+//	  - name: kubelet-probes
+//	    match:
+//	      event: flow
+//	      destinationNamespace: [kube-system]
+//	      destinationPort: ["10250-10255"]
+//	      action: [accept]
+//	    action: drop
+//	  - name: dns
+//	    match:
+//	      destinationPort: [53]
+//	    action: sample
+//	    every: 100
+type Rules struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Rule describes the events to match and what to do with them
+type Rule struct {
+	Name     string        `yaml:"name"`
+	Match    Match         `yaml:"match"`
+	Action   string        `yaml:"action"`
+	Every    int           `yaml:"every"`
+	Limit    int           `yaml:"limit"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Match holds the criteria of a rule. All the criteria given must match.
+// Within a criterion matching any of the values is enough.
+type Match struct {
+	// Event is either flow or container. Empty matches both.
+	Event string `yaml:"event"`
+	// Namespace matches the namespace of the pu of a container event
+	Namespace []string `yaml:"namespace"`
+	// CIDR matches the ip of the pu of a container event
+	CIDR []string `yaml:"cidr"`
+	// Tags are key=value tags that must all be present on the event
+	Tags []string `yaml:"tags"`
+
+	SourceNamespace      []string `yaml:"sourceNamespace"`
+	DestinationNamespace []string `yaml:"destinationNamespace"`
+	SourceCIDR           []string `yaml:"sourceCIDR"`
+	DestinationCIDR      []string `yaml:"destinationCIDR"`
+	SourcePort           []string `yaml:"sourcePort"`
+	DestinationPort      []string `yaml:"destinationPort"`
+	Action               []string `yaml:"action"`
+}
+
+// LoadRulesFile loads the filtering rules from a YAML file
+func LoadRulesFile(path string) (*Rules, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading filter rules %s", err)
+	}
+
+	return ParseRules(data)
+}
+
+// ParseRules parses YAML filtering rules
+func ParseRules(data []byte) (*Rules, error) {
+
+	var rules Rules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("Parsing filter rules %s", err)
+	}
+
+	return &rules, nil
+}
+
+// portRange is an inclusive range of ports
+type portRange struct {
+	from uint16
+	to   uint16
+}
+
+func parsePortRanges(ports []string) ([]portRange, error) {
+	var ranges []portRange
+
+	for _, port := range ports {
+		bounds := strings.SplitN(port, "-", 2)
+		from, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid port %s", port)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 16); err != nil || to < from {
+				return nil, fmt.Errorf("Invalid port range %s", port)
+			}
+		}
+		ranges = append(ranges, portRange{from: uint16(from), to: uint16(to)})
+	}
+
+	return ranges, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr = cidr + "/128"
+			} else {
+				cidr = cidr + "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CIDR %s", cidr)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
@@ -2,6 +2,8 @@ package influxdb
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"time"
 
 	"go.uber.org/zap"
@@ -17,6 +19,8 @@ type Influxdb struct {
 
 	stopWorker chan struct{}
 	worker     *worker
+
+	quarantinePath string
 }
 
 //DataAdder interface has all the methods required to interact with influxdb api
@@ -27,7 +31,7 @@ type DataAdder interface {
 }
 
 // NewDBConnection is used to create a new client and return influxdb handle
-func NewDBConnection(user string, pass string, addr string, db string, insecureSkipVerify bool) (*Influxdb, error) {
+func NewDBConnection(user string, pass string, addr string, db string, insecureSkipVerify bool, opts ...Option) (*Influxdb, error) {
 	zap.L().Debug("Initializing InfluxDBConnection")
 	httpClient, err := createHTTPClient(user, pass, addr, insecureSkipVerify)
 	if err != nil {
@@ -47,6 +51,18 @@ func NewDBConnection(user string, pass string, addr string, db string, insecureS
 	worker := newWorker(dbConnection.stopWorker, dbConnection)
 	dbConnection.worker = worker
 
+	for _, opt := range opts {
+		opt(dbConnection)
+	}
+
+	if dbConnection.quarantinePath != "" {
+		quarantine, err := newQuarantine(dbConnection.quarantinePath)
+		if err != nil {
+			return nil, err
+		}
+		worker.quarantine = quarantine
+	}
+
 	// Attempt to create the Database. Silently fail if it already exists.
 	if err := dbConnection.CreateDB(db); err != nil {
 		return nil, fmt.Errorf("Error: Creating Database: %s", err)
@@ -117,6 +133,20 @@ func (d *Influxdb) Stop() error {
 	d.stopWorker <- struct{}{}
 	d.httpClient.Close()
 
+	if d.worker.quarantine != nil {
+		if err := d.worker.quarantine.close(); err != nil {
+			zap.L().Warn("Closing quarantine file", zap.Error(err))
+		}
+	}
+
+	for _, enricher := range d.worker.enrichers {
+		if closer, ok := enricher.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				zap.L().Warn("Closing enricher", zap.Error(err))
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -143,6 +173,12 @@ func (d *Influxdb) AddData(tags map[string]string, fields map[string]interface{}
 			return fmt.Errorf("Couldn't add FlowEvent: %s", err)
 		}
 		bp.AddPoint(pt)
+	} else if tags[EventName] == EventTypeAnomaly {
+		pt, err := client.NewPoint(EventTypeAnomaly, tags, fields, time.Now())
+		if err != nil {
+			return fmt.Errorf("Couldn't add Anomaly: %s", err)
+		}
+		bp.AddPoint(pt)
 	}
 	if err := d.httpClient.Write(bp); err != nil {
 		return fmt.Errorf("Couldn't add data: %s", err)
@@ -151,6 +187,35 @@ func (d *Influxdb) AddData(tags map[string]string, fields map[string]interface{}
 	return nil
 }
 
+// Stats returns the current counters of the collector
+func (d *Influxdb) Stats() Stats {
+
+	stats := d.worker.stats.snapshot()
+	if d.worker.filter != nil {
+		stats.FilterRules = d.worker.filter.Stats()
+	}
+
+	return stats
+}
+
+// Ready returns an error if the worker is not running or is not making progress
+func (d *Influxdb) Ready() error {
+
+	return d.worker.liveness.check()
+}
+
+// ReadinessProbe is the http handler used by readiness probes
+// It fails with 503 when collection is stuck
+func (d *Influxdb) ReadinessProbe(w http.ResponseWriter, r *http.Request) {
+
+	if err := d.Ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // CollectFlowEvent implements trireme collector interface
 func (d *Influxdb) CollectFlowEvent(record *tcollector.FlowRecord) {
 	d.worker.addEvent(
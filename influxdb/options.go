@@ -0,0 +1,54 @@
+package influxdb
+
+import (
+	"time"
+
+	"github.com/aporeto-inc/trireme-statistics/influxdb/enrichment"
+	"github.com/aporeto-inc/trireme-statistics/influxdb/filter"
+	"github.com/aporeto-inc/trireme-statistics/influxdb/tagpolicy"
+)
+
+// Option is used to configure the optional features of the collector
+type Option func(*Influxdb)
+
+// OptionEnrichers adds enrichment stages run on every record before it is written
+func OptionEnrichers(enrichers ...enrichment.Enricher) Option {
+
+	return func(d *Influxdb) {
+		d.worker.enrichers = append(d.worker.enrichers, enrichers...)
+	}
+}
+
+// OptionFilter drops or samples the events matching the filtering rules before they are written
+func OptionFilter(f *filter.Filter) Option {
+
+	return func(d *Influxdb) {
+		d.worker.filter = f
+	}
+}
+
+// OptionTagPolicy restricts and transforms the tags of the records before they are stored
+func OptionTagPolicy(p *tagpolicy.Policy) Option {
+
+	return func(d *Influxdb) {
+		d.worker.tagPolicy = p
+	}
+}
+
+// OptionQuarantineFile stores the records failing validation in the given file
+// with the reason attached. Invalid records are only counted when it is not set.
+func OptionQuarantineFile(path string) Option {
+
+	return func(d *Influxdb) {
+		d.quarantinePath = path
+	}
+}
+
+// OptionLivenessTimeout sets the time without progress after which the worker
+// is reported as stuck by Ready
+func OptionLivenessTimeout(timeout time.Duration) Option {
+
+	return func(d *Influxdb) {
+		d.worker.liveness.timeout = timeout
+	}
+}
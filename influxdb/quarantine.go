@@ -0,0 +1,74 @@
+package influxdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// quarantinedRecord is the entry written to the quarantine file for every invalid record
+type quarantinedRecord struct {
+	Time            time.Time   `json:"time"`
+	Reason          string      `json:"reason"`
+	EventName       string      `json:"eventName"`
+	FlowRecord      interface{} `json:"flowRecord,omitempty"`
+	ContainerRecord interface{} `json:"containerRecord,omitempty"`
+}
+
+// quarantine stores the records that failed validation, one JSON document per line
+type quarantine struct {
+	file    *os.File
+	encoder *json.Encoder
+
+	sync.Mutex
+}
+
+func newQuarantine(path string) (*quarantine, error) {
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Opening quarantine file %s", err)
+	}
+
+	return &quarantine{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// add writes the event to the quarantine file with the reason attached
+func (q *quarantine) add(wevent *workerEvent, reason error) error {
+
+	entry := &quarantinedRecord{
+		Time:   time.Now(),
+		Reason: reason.Error(),
+	}
+
+	switch wevent.event {
+	case flowEvent:
+		entry.EventName = EventTypeFlow
+		if wevent.flowRecord != nil {
+			entry.FlowRecord = wevent.flowRecord
+		}
+	case containerEvent:
+		entry.EventName = EventTypeContainer
+		if wevent.containerRecord != nil {
+			entry.ContainerRecord = wevent.containerRecord
+		}
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	return q.encoder.Encode(entry)
+}
+
+func (q *quarantine) close() error {
+
+	q.Lock()
+	defer q.Unlock()
+
+	return q.file.Close()
+}
@@ -0,0 +1,47 @@
+package influxdb
+
+import (
+	"sync/atomic"
+
+	"github.com/aporeto-inc/trireme-statistics/influxdb/filter"
+)
+
+// Stats holds the counters of the collector
+type Stats struct {
+	// Received is the number of events handed to the collector
+	Received uint64
+	// Dropped is the number of events dropped because the queue was full
+	Dropped uint64
+	// Filtered is the number of events dropped by the filtering rules
+	Filtered uint64
+	// Invalid is the number of records that failed validation and were quarantined
+	Invalid uint64
+	// Written is the number of records written to InfluxDB
+	Written uint64
+	// Failed is the number of records that could not be written to InfluxDB
+	Failed uint64
+	// Panics is the number of events that caused a panic while being processed
+	Panics uint64
+	// Restarts is the number of times the worker loop was restarted
+	Restarts uint64
+	// Skipped is the number of ignored and failed container events, that are not written
+	Skipped uint64
+
+	// FilterRules holds the hit counters of every filtering rule
+	FilterRules []filter.RuleStats
+}
+
+func (s *Stats) snapshot() Stats {
+
+	return Stats{
+		Received: atomic.LoadUint64(&s.Received),
+		Dropped:  atomic.LoadUint64(&s.Dropped),
+		Filtered: atomic.LoadUint64(&s.Filtered),
+		Invalid:  atomic.LoadUint64(&s.Invalid),
+		Written:  atomic.LoadUint64(&s.Written),
+		Failed:   atomic.LoadUint64(&s.Failed),
+		Panics:   atomic.LoadUint64(&s.Panics),
+		Restarts: atomic.LoadUint64(&s.Restarts),
+		Skipped:  atomic.LoadUint64(&s.Skipped),
+	}
+}
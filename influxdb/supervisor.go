@@ -0,0 +1,142 @@
+package influxdb
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultLivenessTimeout is the time without activity after which the worker is considered stuck
+	defaultLivenessTimeout = time.Minute
+
+	heartbeatInterval = 5 * time.Second
+	minRestartBackoff = 100 * time.Millisecond
+	maxRestartBackoff = 30 * time.Second
+)
+
+// liveness tracks whether the worker is running and when it was last seen making progress
+type liveness struct {
+	running      bool
+	lastActivity time.Time
+	timeout      time.Duration
+
+	sync.Mutex
+}
+
+func (l *liveness) setRunning(running bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.running = running
+	l.lastActivity = time.Now()
+}
+
+func (l *liveness) heartbeat() {
+	l.Lock()
+	defer l.Unlock()
+
+	l.lastActivity = time.Now()
+}
+
+func (l *liveness) check() error {
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.running {
+		return fmt.Errorf("Worker is not running")
+	}
+
+	if idle := time.Since(l.lastActivity); idle > l.timeout {
+		return fmt.Errorf("Worker stuck for %s", idle.Round(time.Second))
+	}
+
+	return nil
+}
+
+// startWorker start processing the event for this worker until it is stopped.
+// The worker loop is restarted with a capped exponential backoff if it exits
+// unexpectedly. The panics of the events are recovered by safeProcessEvent.
+// Blocking... Use go.
+func (w *worker) startWorker() {
+	zap.L().Info("Starting InfluxDBworker")
+
+	backoff := minRestartBackoff
+	for {
+		started := time.Now()
+		if w.run() {
+			return
+		}
+
+		// A loop that ran for a while failed on its own, not because of the previous restart
+		if time.Since(started) > maxRestartBackoff {
+			backoff = minRestartBackoff
+		}
+
+		atomic.AddUint64(&w.stats.Restarts, 1)
+		zap.L().Error("InfluxDB worker exited unexpectedly, restarting", zap.Duration("backoff", backoff))
+
+		select {
+		case <-time.After(backoff):
+		case <-w.stop:
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+// run processes the events until the worker is stopped. It returns false if the loop panics.
+func (w *worker) run() (stopped bool) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			zap.L().Error("Panic in InfluxDB worker loop", zap.Any("panic", r), zap.ByteString("stack", debug.Stack()))
+			stopped = false
+		}
+	}()
+
+	w.liveness.setRunning(true)
+	defer w.liveness.setRunning(false)
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-w.events:
+			w.process(event)
+			w.liveness.heartbeat()
+		case <-ticker.C:
+			w.liveness.heartbeat()
+		case <-w.stop:
+			return true
+		}
+	}
+}
+
+// safeProcessEvent processes an event and recovers if it panics so that one
+// malformed event does not take the worker down
+func (w *worker) safeProcessEvent(wevent *workerEvent) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&w.stats.Panics, 1)
+			zap.L().Error("Panic while processing event",
+				zap.Any("panic", r),
+				zap.Any("flowRecord", wevent.flowRecord),
+				zap.Any("containerRecord", wevent.containerRecord),
+				zap.ByteString("stack", debug.Stack()),
+			)
+		}
+	}()
+
+	w.processEvent(wevent)
+}
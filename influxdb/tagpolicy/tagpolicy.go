@@ -0,0 +1,233 @@
+package tagpolicy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// Redacted replaces the redacted values
+	Redacted = "[REDACTED]"
+	// hashPrefix is prepended to hashed values
+	hashPrefix = "sha256:"
+	// hashLength is the number of hex characters kept from the hash
+	hashLength = 16
+)
+
+// Config describes which tag keys are stored and how their values are transformed
+// Keys are matched with patterns where * matches any sequence of characters.
+//
+//	allow: ["@usr:app", "@usr:io.kubernetes.pod.*", "@namespace", "AporetoContextID"]
+//	deny: ["@usr:annotation.kubernetes.io/*"]
+//	redact:
+//	  - key: "@usr:*password*"
+//	  - value: "(?i)bearer [a-z0-9._-]+"
+//	hash:
+//	  - key: "@usr:owner-email"
+type Config struct {
+	// Allow is the list of tag keys stored. Empty stores every key not denied.
+	Allow []string `yaml:"allow"`
+	// Deny is the list of tag keys never stored. It takes precedence over Allow.
+	Deny []string `yaml:"deny"`
+	// Redact replaces the value of the tags matching the key, or the parts of the values
+	// matching the value expression, with [REDACTED]
+	Redact []Rule `yaml:"redact"`
+	// Hash replaces the value of the matching tags with a hash so that it can still be grouped on
+	Hash []Rule `yaml:"hash"`
+	// Salt is mixed into the hashed values
+	Salt string `yaml:"salt"`
+	// MaxValueLength truncates longer values. 0 disables truncation.
+	MaxValueLength int `yaml:"maxValueLength"`
+}
+
+// Rule selects tags by key pattern or their values by regular expression
+type Rule struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+}
+
+type compiledRule struct {
+	key   *regexp.Regexp
+	value *regexp.Regexp
+}
+
+// Policy applies a tag configuration to the tags of records
+type Policy struct {
+	allow          []*regexp.Regexp
+	deny           []*regexp.Regexp
+	redact         []*compiledRule
+	hash           []*compiledRule
+	salt           string
+	maxValueLength int
+}
+
+// LoadConfigFile loads a tag configuration from a YAML file
+func LoadConfigFile(path string) (*Config, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading tag policy %s", err)
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("Parsing tag policy %s", err)
+	}
+
+	return &config, nil
+}
+
+// NewPolicy compiles a tag configuration
+func NewPolicy(config *Config) (*Policy, error) {
+
+	p := &Policy{
+		salt:           config.Salt,
+		maxValueLength: config.MaxValueLength,
+	}
+
+	var err error
+	if p.allow, err = compilePatterns(config.Allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = compilePatterns(config.Deny); err != nil {
+		return nil, err
+	}
+	if p.redact, err = compileRules(config.Redact); err != nil {
+		return nil, err
+	}
+	if p.hash, err = compileRules(config.Hash); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Apply returns the tags to store. Tags are in the key=value format.
+func (p *Policy) Apply(tags []string) []string {
+
+	result := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		key, value := splitTag(tag)
+
+		if matchAny(p.deny, key) {
+			continue
+		}
+		if len(p.allow) > 0 && !matchAny(p.allow, key) {
+			continue
+		}
+
+		value = p.transform(key, value)
+		if p.maxValueLength > 0 && len(value) > p.maxValueLength {
+			value = value[:p.maxValueLength]
+		}
+
+		result = append(result, key+"="+value)
+	}
+
+	return result
+}
+
+func (p *Policy) transform(key string, value string) string {
+
+	for _, rule := range p.redact {
+		if rule.key != nil && !rule.key.MatchString(key) {
+			continue
+		}
+		if rule.value == nil {
+			return Redacted
+		}
+		value = rule.value.ReplaceAllString(value, Redacted)
+	}
+
+	for _, rule := range p.hash {
+		if (rule.key == nil || rule.key.MatchString(key)) && (rule.value == nil || rule.value.MatchString(value)) {
+			sum := sha256.Sum256([]byte(p.salt + value))
+			return hashPrefix + hex.EncodeToString(sum[:])[:hashLength]
+		}
+	}
+
+	return value
+}
+
+func splitTag(tag string) (string, string) {
+
+	if index := strings.Index(tag, "="); index >= 0 {
+		return tag[:index], tag[index+1:]
+	}
+
+	return tag, ""
+}
+
+func matchAny(patterns []*regexp.Regexp, key string) bool {
+
+	for _, pattern := range patterns {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compileRules(rules []Rule) ([]*compiledRule, error) {
+	var compiled []*compiledRule
+
+	for _, rule := range rules {
+		if rule.Key == "" && rule.Value == "" {
+			return nil, fmt.Errorf("Rule requires a key or a value")
+		}
+
+		var c compiledRule
+		var err error
+		if rule.Key != "" {
+			if c.key, err = compilePattern(rule.Key); err != nil {
+				return nil, err
+			}
+		}
+		if rule.Value != "" {
+			if c.value, err = regexp.Compile(rule.Value); err != nil {
+				return nil, fmt.Errorf("Invalid value expression %s: %s", rule.Value, err)
+			}
+		}
+		compiled = append(compiled, &c)
+	}
+
+	return compiled, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+
+	for _, pattern := range patterns {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
+// compilePattern converts a key pattern where * matches anything into an anchored expression
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	re, err := regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+	if err != nil {
+		return nil, fmt.Errorf("Invalid key pattern %s: %s", pattern, err)
+	}
+
+	return re, nil
+}
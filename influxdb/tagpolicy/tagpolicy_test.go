@@ -0,0 +1,77 @@
+package tagpolicy
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicy(t *testing.T) {
+
+	tags := []string{
+		"@usr:app=web",
+		"@usr:io.kubernetes.pod.name=web-3468831164-x2x9z",
+		"@usr:io.kubernetes.pod.namespace=default",
+		`@usr:annotation.kubernetes.io/created-by={"kind":"SerializedReference"}`,
+		"@usr:db-password=hunter2",
+		"@usr:auth=Bearer abc.def-ghi",
+		"@usr:owner-email=jane@example.com",
+	}
+
+	Convey("Given I create a policy with an allowlist", t, func() {
+		p, err := NewPolicy(&Config{
+			Allow: []string{"@usr:app", "@usr:io.kubernetes.pod.*"},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("Then only the allowed keys should be stored", func() {
+			So(p.Apply(tags), ShouldResemble, []string{
+				"@usr:app=web",
+				"@usr:io.kubernetes.pod.name=web-3468831164-x2x9z",
+				"@usr:io.kubernetes.pod.namespace=default",
+			})
+		})
+	})
+
+	Convey("Given I create a policy with a denylist, redaction and hashing", t, func() {
+		p, err := NewPolicy(&Config{
+			Deny: []string{"@usr:annotation.kubernetes.io/*"},
+			Redact: []Rule{
+				{Key: "*password*"},
+				{Value: "(?i)bearer [a-z0-9._-]+"},
+			},
+			Hash: []Rule{
+				{Key: "@usr:owner-email"},
+			},
+		})
+		So(err, ShouldBeNil)
+		stored := p.Apply(tags)
+
+		Convey("Then denied keys should be dropped", func() {
+			So(len(stored), ShouldEqual, 6)
+			for _, tag := range stored {
+				So(tag, ShouldNotStartWith, "@usr:annotation.kubernetes.io/")
+			}
+		})
+
+		Convey("Then secrets should be redacted", func() {
+			So(stored, ShouldContain, "@usr:db-password=[REDACTED]")
+			So(stored, ShouldContain, "@usr:auth=[REDACTED]")
+		})
+
+		Convey("Then hashed values should be stable and hide the value", func() {
+			So(stored[5], ShouldStartWith, "@usr:owner-email=sha256:")
+			So(strings.Contains(stored[5], "jane"), ShouldBeFalse)
+			So(p.Apply(tags)[5], ShouldEqual, stored[5])
+		})
+	})
+
+	Convey("Given I create a policy with an invalid expression", t, func() {
+		_, err := NewPolicy(&Config{Redact: []Rule{{Value: "("}}})
+
+		Convey("Then I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
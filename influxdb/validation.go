@@ -0,0 +1,94 @@
+package influxdb
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"git.cloud.top/DSec/trireme-lib/collector"
+)
+
+var (
+	errNilRecord          = errors.New("Record is nil")
+	errMissingContextID   = errors.New("Missing ContextID")
+	errMissingSource      = errors.New("Missing Source")
+	errMissingDestination = errors.New("Missing Destination")
+	errInvalidAction      = errors.New("Action is neither accept nor reject")
+)
+
+// validateFlowRecord checks that a flow record can be safely written
+func validateFlowRecord(record *collector.FlowRecord) error {
+
+	if record == nil {
+		return errNilRecord
+	}
+
+	if record.ContextID == "" {
+		return errMissingContextID
+	}
+
+	if record.Source == nil {
+		return errMissingSource
+	}
+
+	if record.Destination == nil {
+		return errMissingDestination
+	}
+
+	if err := validateIP("Source", record.Source.IP); err != nil {
+		return err
+	}
+
+	if err := validateIP("Destination", record.Destination.IP); err != nil {
+		return err
+	}
+
+	// Destination port 0 is valid, it is reported for ICMP and for flows rejected before
+	// their port is known
+
+	if record.Action.Accepted() == record.Action.Rejected() {
+		return errInvalidAction
+	}
+
+	return nil
+}
+
+// validateContainerRecord checks that a container record can be safely written
+func validateContainerRecord(record *collector.ContainerRecord) error {
+
+	if record == nil {
+		return errNilRecord
+	}
+
+	if record.ContextID == "" {
+		return errMissingContextID
+	}
+
+	switch record.Event {
+	case collector.ContainerStart, collector.ContainerUpdate, collector.ContainerCreate,
+		collector.ContainerDelete, collector.ContainerStop,
+		collector.ContainerIgnored, collector.ContainerFailed:
+	default:
+		return fmt.Errorf("Unrecognized container event name %s", record.Event)
+	}
+
+	for _, ip := range record.IPAddress {
+		if ip == "" {
+			continue
+		}
+		if err := validateIP("Container", ip); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateIP(endpoint string, ip string) error {
+
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("%s IP is invalid %q", endpoint, ip)
+	}
+
+	return nil
+}
@@ -2,9 +2,15 @@ package influxdb
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"git.cloud.top/DSec/trireme-lib/collector"
+	"git.cloud.top/DSec/trireme-lib/policy"
 	"go.uber.org/zap"
+
+	"github.com/aporeto-inc/trireme-statistics/influxdb/enrichment"
+	"github.com/aporeto-inc/trireme-statistics/influxdb/filter"
+	"github.com/aporeto-inc/trireme-statistics/influxdb/tagpolicy"
 )
 
 const (
@@ -22,13 +28,31 @@ const (
 
 	// EventTypeContainerStop is the constant used to store event of type container stop
 	EventTypeContainerStop = "ContainerStopEvents"
+
+	// EventTypeAnomaly is the constant used to store the anomalies detected on flows
+	EventTypeAnomaly = "Anomalies"
+
+	// SourcePrefix is prepended to the enriched attributes of the source of a flow
+	SourcePrefix = "Source"
+
+	// DestinationPrefix is prepended to the enriched attributes of the destination of a flow
+	DestinationPrefix = "Destination"
 )
 
 // A worker manages the workload for the InfluxDB collector
 type worker struct {
-	events chan *workerEvent
-	stop   chan struct{}
-	db     DataAdder
+	events     chan *workerEvent
+	stop       chan struct{}
+	db         DataAdder
+	enrichers  []enrichment.Enricher
+	filter     *filter.Filter
+	tagPolicy  *tagpolicy.Policy
+	quarantine *quarantine
+	stats      *Stats
+	liveness   *liveness
+
+	// process handles the events received by the worker loop
+	process func(*workerEvent)
 }
 
 type eventType int
@@ -46,50 +70,113 @@ type workerEvent struct {
 }
 
 func newWorker(stop chan struct{}, db DataAdder) *worker {
-	return &worker{
+	w := &worker{
 		events: make(chan *workerEvent, 500),
 		stop:   stop,
 		db:     db,
+		stats:  &Stats{},
+		liveness: &liveness{
+			timeout: defaultLivenessTimeout,
+		},
 	}
+	w.process = w.safeProcessEvent
+
+	return w
 }
 
 func (w *worker) addEvent(wevent *workerEvent) {
+	atomic.AddUint64(&w.stats.Received, 1)
+
 	select {
 	case w.events <- wevent: // Put event in channel unless it is full
 		zap.L().Debug("Adding event to InfluxDBProcessingQueue.")
 	default:
+		atomic.AddUint64(&w.stats.Dropped, 1)
 		zap.L().Warn("Event queue full for InfluxDB. Dropping event.")
 	}
 }
 
-// startWorker start processing the event for this worker.
-// Blocking... Use go.
-func (w *worker) startWorker() {
-	zap.L().Info("Starting InfluxDBworker")
-	for {
-		select {
-		case event := <-w.events:
-			w.processEvent(event)
-		case <-w.stop:
-			return
-		}
-	}
-}
-
 func (w *worker) processEvent(wevent *workerEvent) {
 	zap.L().Debug("Processing event for InfluxDB")
 
+	if err := w.validateEvent(wevent); err != nil {
+		w.quarantineEvent(wevent, err)
+		return
+	}
+
+	if !w.keepEvent(wevent) {
+		atomic.AddUint64(&w.stats.Filtered, 1)
+		return
+	}
+
+	// The ignored and failed container events are not relevant to the graph
+	if wevent.event == containerEvent && (wevent.containerRecord.Event == collector.ContainerIgnored || wevent.containerRecord.Event == collector.ContainerFailed) {
+		atomic.AddUint64(&w.stats.Skipped, 1)
+		return
+	}
+
+	var err error
 	switch wevent.event {
 	case containerEvent:
-		if err := w.doCollectContainerEvent(wevent.containerRecord); err != nil {
+		if err = w.doCollectContainerEvent(wevent.containerRecord); err != nil {
 			zap.L().Error("Couldn't process influxDB Request ContainerRequest", zap.Error(err))
 		}
 
 	case flowEvent:
-		if err := w.doCollectFlowEvent(wevent.flowRecord); err != nil {
+		if err = w.doCollectFlowEvent(wevent.flowRecord); err != nil {
 			zap.L().Error("Couldn't process influxDB Request FlowRequest", zap.Error(err))
 		}
 	}
+
+	if err != nil {
+		atomic.AddUint64(&w.stats.Failed, 1)
+		return
+	}
+	atomic.AddUint64(&w.stats.Written, 1)
+}
+
+func (w *worker) validateEvent(wevent *workerEvent) error {
+
+	switch wevent.event {
+	case containerEvent:
+		return validateContainerRecord(wevent.containerRecord)
+	case flowEvent:
+		return validateFlowRecord(wevent.flowRecord)
+	default:
+		return fmt.Errorf("Unrecognized event type %d", wevent.event)
+	}
+}
+
+// keepEvent runs the filtering rules and returns false if the event must be dropped
+func (w *worker) keepEvent(wevent *workerEvent) bool {
+
+	if w.filter == nil {
+		return true
+	}
+
+	switch wevent.event {
+	case containerEvent:
+		return w.filter.KeepContainer(wevent.containerRecord)
+	case flowEvent:
+		return w.filter.KeepFlow(wevent.flowRecord)
+	}
+
+	return true
+}
+
+// quarantineEvent counts an invalid event and stores it in the quarantine file if one is configured
+func (w *worker) quarantineEvent(wevent *workerEvent, reason error) {
+
+	atomic.AddUint64(&w.stats.Invalid, 1)
+	zap.L().Warn("Quarantining invalid record", zap.Error(reason))
+
+	if w.quarantine == nil {
+		return
+	}
+
+	if err := w.quarantine.add(wevent, reason); err != nil {
+		zap.L().Error("Couldn't write record to quarantine", zap.Error(err))
+	}
 }
 
 // CollectContainerEvent implements trireme collector interface
@@ -101,12 +188,6 @@ func (w *worker) doCollectContainerEvent(record *collector.ContainerRecord) erro
 		eventName = EventTypeContainerStart
 	case collector.ContainerDelete, collector.ContainerStop:
 		eventName = EventTypeContainerStop
-	case collector.ContainerIgnored:
-		// Used for non relevant container events.
-		return nil
-	case collector.ContainerFailed:
-		// TODO: handle ContainerFailed event type
-		return nil
 	default:
 		return fmt.Errorf("Unrecognized container event name %s ", record.Event)
 	}
@@ -115,36 +196,59 @@ func (w *worker) doCollectContainerEvent(record *collector.ContainerRecord) erro
 		IPAddress = v
 	}
 
-	return w.db.AddData(map[string]string{
+	tags := map[string]string{
 		"EventName": eventName,
 		"EventID":   record.ContextID,
-	}, map[string]interface{}{
+	}
+	fields := map[string]interface{}{
 		"ContextID": record.ContextID,
 		"IPAddress": IPAddress,
-		"Tags":      record.Tags,
+		"Tags":      w.storedTags(record.Tags),
 		"Event":     record.Event,
-	})
+	}
+
+	enrichment.Apply(w.enrichers, IPAddress, "", tags, fields)
+
+	return w.db.AddData(tags, fields)
 }
 
 // CollectFlowEvent implements trireme collector interface
 func (w *worker) doCollectFlowEvent(record *collector.FlowRecord) error {
-	return w.db.AddData(map[string]string{
+	tags := map[string]string{
 		"EventName": EventTypeFlow,
 		"EventID":   record.ContextID,
-	}, map[string]interface{}{
+	}
+	fields := map[string]interface{}{
 		"ContextID":       record.ContextID,
 		"Counter":         record.Count,
 		"SourceID":        record.Source.ID,
 		"SourceIP":        record.Source.IP,
 		"SourcePort":      record.Source.Port,
-		"SourceType":      record.Source.Type,
+		"SourceType":      int(record.Source.Type),
 		"DestinationID":   record.Destination.ID,
 		"DestinationIP":   record.Destination.IP,
 		"DestinationPort": record.Destination.Port,
-		"DestinationType": record.Destination.Type,
-		"Tags":            record.Tags,
+		"DestinationType": int(record.Destination.Type),
+		"Tags":            w.storedTags(record.Tags),
 		"Action":          record.Action,
 		"DropReason":      record.DropReason,
 		"PolicyID":        record.PolicyID,
-	})
+	}
+
+	enrichment.Apply(w.enrichers, record.Source.IP, SourcePrefix, tags, fields)
+	enrichment.Apply(w.enrichers, record.Destination.IP, DestinationPrefix, tags, fields)
+
+	return w.db.AddData(tags, fields)
+}
+
+// storedTags applies the tag policy to the tags of a record before they are stored
+func (w *worker) storedTags(tags *policy.TagStore) *policy.TagStore {
+
+	if w.tagPolicy == nil || tags == nil {
+		return tags
+	}
+
+	return &policy.TagStore{
+		Tags: w.tagPolicy.Apply(tags.Tags),
+	}
 }
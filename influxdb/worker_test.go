@@ -0,0 +1,235 @@
+package influxdb
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.cloud.top/DSec/trireme-lib/collector"
+	"git.cloud.top/DSec/trireme-lib/policy"
+	"github.com/aporeto-inc/trireme-statistics/influxdb/mock"
+	gomock "github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func sampleFlowRecord() *collector.FlowRecord {
+
+	return &collector.FlowRecord{
+		ContextID: "14138259f129",
+		Count:     1,
+		Source: &collector.EndPoint{
+			ID:   "6f4b63dde673",
+			IP:   "10.20.0.1",
+			Port: 43210,
+			Type: collector.EnpointTypePU,
+		},
+		Destination: &collector.EndPoint{
+			ID:   "14138259f129",
+			IP:   "10.20.2.59",
+			Port: 8086,
+			Type: collector.EnpointTypePU,
+		},
+		Tags:     &policy.TagStore{Tags: []string{"@namespace=kube-system"}},
+		Action:   policy.Accept,
+		PolicyID: "sampleID",
+	}
+}
+
+func TestValidateFlowRecord(t *testing.T) {
+
+	Convey("Given I validate flow records", t, func() {
+
+		Convey("Then a complete record should be valid", func() {
+			So(validateFlowRecord(sampleFlowRecord()), ShouldBeNil)
+		})
+
+		Convey("Then a record without source should be invalid", func() {
+			record := sampleFlowRecord()
+			record.Source = nil
+			So(validateFlowRecord(record), ShouldEqual, errMissingSource)
+		})
+
+		Convey("Then a record without destination should be invalid", func() {
+			record := sampleFlowRecord()
+			record.Destination = nil
+			So(validateFlowRecord(record), ShouldEqual, errMissingDestination)
+		})
+
+		Convey("Then a record with an invalid ip should be invalid", func() {
+			record := sampleFlowRecord()
+			record.Destination.IP = "192.1688.2.2"
+			So(validateFlowRecord(record), ShouldNotBeNil)
+		})
+
+		Convey("Then a record with destination port 0 should be valid", func() {
+			record := sampleFlowRecord()
+			record.Destination.Port = 0
+			So(validateFlowRecord(record), ShouldBeNil)
+		})
+
+		Convey("Then a record with an unknown action should be invalid", func() {
+			record := sampleFlowRecord()
+			record.Action = policy.Accept | policy.Reject
+			So(validateFlowRecord(record), ShouldEqual, errInvalidAction)
+		})
+	})
+}
+
+func TestProcessEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create a worker with a quarantine file", t, func() {
+		dir, err := ioutil.TempDir("", "quarantine")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "quarantine.json")
+		q, err := newQuarantine(path)
+		So(err, ShouldBeNil)
+
+		w := newWorker(make(chan struct{}), mockDataAdder)
+		w.quarantine = q
+
+		Convey("When I process a valid flow event", func() {
+			mockDataAdder.EXPECT().AddData(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			w.processEvent(&workerEvent{event: flowEvent, flowRecord: sampleFlowRecord()})
+
+			Convey("Then it should be written", func() {
+				So(w.stats.snapshot().Written, ShouldEqual, 1)
+				So(w.stats.snapshot().Invalid, ShouldBeZeroValue)
+			})
+		})
+
+		Convey("When I process an ignored container event", func() {
+			w.processEvent(&workerEvent{event: containerEvent, containerRecord: &collector.ContainerRecord{ContextID: "6f4b63dde673", Event: collector.ContainerIgnored}})
+
+			Convey("Then it should be skipped without being counted as written", func() {
+				So(w.stats.snapshot().Skipped, ShouldEqual, 1)
+				So(w.stats.snapshot().Written, ShouldBeZeroValue)
+			})
+		})
+
+		Convey("When I process a flow event without destination", func() {
+			record := sampleFlowRecord()
+			record.Destination = nil
+			w.processEvent(&workerEvent{event: flowEvent, flowRecord: record})
+			So(q.close(), ShouldBeNil)
+
+			Convey("Then it should be quarantined with the reason attached", func() {
+				So(w.stats.snapshot().Invalid, ShouldEqual, 1)
+				So(w.stats.snapshot().Written, ShouldBeZeroValue)
+
+				file, err := os.Open(path)
+				So(err, ShouldBeNil)
+				defer file.Close()
+
+				scanner := bufio.NewScanner(file)
+				So(scanner.Scan(), ShouldBeTrue)
+				var entry quarantinedRecord
+				So(json.Unmarshal(scanner.Bytes(), &entry), ShouldBeNil)
+				So(entry.Reason, ShouldEqual, errMissingDestination.Error())
+				So(entry.EventName, ShouldEqual, EventTypeFlow)
+			})
+		})
+	})
+}
+
+func TestSupervisedWorker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDataAdder := mockinfluxdb.NewMockDataAdder(ctrl)
+
+	Convey("Given I create a worker", t, func() {
+		w := newWorker(make(chan struct{}), mockDataAdder)
+
+		Convey("When processing an event panics", func() {
+			mockDataAdder.EXPECT().AddData(gomock.Any(), gomock.Any()).Do(func(map[string]string, map[string]interface{}) {
+				panic("unexpected data")
+			}).Times(1)
+
+			Convey("Then the panic should be recovered and counted", func() {
+				So(func() {
+					w.safeProcessEvent(&workerEvent{event: flowEvent, flowRecord: sampleFlowRecord()})
+				}, ShouldNotPanic)
+				So(w.stats.snapshot().Panics, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the worker is not started", func() {
+
+			Convey("Then it should not be ready", func() {
+				So(w.liveness.check(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the worker is started", func() {
+			go w.startWorker()
+			defer func() { w.stop <- struct{}{} }()
+
+			Convey("Then it should become ready", func() {
+				So(waitReady(w), ShouldBeNil)
+			})
+		})
+
+		Convey("When the worker loop panics", func() {
+			processed := make(chan *workerEvent, 1)
+			var calls int32
+			w.process = func(wevent *workerEvent) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					panic("worker loop")
+				}
+				processed <- wevent
+			}
+
+			go w.startWorker()
+			defer func() { w.stop <- struct{}{} }()
+
+			w.addEvent(&workerEvent{event: flowEvent, flowRecord: sampleFlowRecord()})
+			event := &workerEvent{event: flowEvent, flowRecord: sampleFlowRecord()}
+			w.addEvent(event)
+
+			Convey("Then the worker should be restarted and process the next events", func() {
+				select {
+				case e := <-processed:
+					So(e, ShouldEqual, event)
+				case <-time.After(5 * time.Second):
+					So("worker not restarted", ShouldBeEmpty)
+				}
+				So(w.stats.snapshot().Restarts, ShouldEqual, 1)
+				So(waitReady(w), ShouldBeNil)
+			})
+		})
+
+		Convey("When the worker did not make progress for too long", func() {
+			w.liveness.setRunning(true)
+			w.liveness.timeout = time.Millisecond
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("Then it should be reported as stuck", func() {
+				So(w.liveness.check(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func waitReady(w *worker) error {
+
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = w.liveness.check(); err == nil {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return err
+}
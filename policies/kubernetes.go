@@ -0,0 +1,197 @@
+package policies
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// NamespaceNameLabel is the label set by Kubernetes on every namespace with its name
+const NamespaceNameLabel = "kubernetes.io/metadata.name"
+
+// NetworkPolicy is a Kubernetes networking.k8s.io/v1 NetworkPolicy
+type NetworkPolicy struct {
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string            `json:"kind" yaml:"kind"`
+	Metadata   ObjectMeta        `json:"metadata" yaml:"metadata"`
+	Spec       NetworkPolicySpec `json:"spec" yaml:"spec"`
+}
+
+// ObjectMeta holds the name and namespace of a NetworkPolicy
+type ObjectMeta struct {
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+}
+
+// NetworkPolicySpec selects the pods of the policy and the traffic they accept
+type NetworkPolicySpec struct {
+	PodSelector LabelSelector       `json:"podSelector" yaml:"podSelector"`
+	Ingress     []NetworkPolicyRule `json:"ingress,omitempty" yaml:"ingress,omitempty"`
+	Egress      []NetworkPolicyRule `json:"egress,omitempty" yaml:"egress,omitempty"`
+	PolicyTypes []string            `json:"policyTypes" yaml:"policyTypes"`
+}
+
+// NetworkPolicyRule allows traffic from or to a set of peers on a set of ports
+type NetworkPolicyRule struct {
+	From  []NetworkPolicyPeer `json:"from,omitempty" yaml:"from,omitempty"`
+	To    []NetworkPolicyPeer `json:"to,omitempty" yaml:"to,omitempty"`
+	Ports []NetworkPolicyPort `json:"ports,omitempty" yaml:"ports,omitempty"`
+}
+
+// NetworkPolicyPeer selects pods, namespaces or networks
+type NetworkPolicyPeer struct {
+	PodSelector       *LabelSelector `json:"podSelector,omitempty" yaml:"podSelector,omitempty"`
+	NamespaceSelector *LabelSelector `json:"namespaceSelector,omitempty" yaml:"namespaceSelector,omitempty"`
+	IPBlock           *IPBlock       `json:"ipBlock,omitempty" yaml:"ipBlock,omitempty"`
+}
+
+// NetworkPolicyPort is a protocol and port
+type NetworkPolicyPort struct {
+	Protocol string      `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Port     IntOrString `json:"port,omitempty" yaml:"port,omitempty"`
+	EndPort  int         `json:"endPort,omitempty" yaml:"endPort,omitempty"`
+}
+
+// IntOrString is a port given by its number, or by the name of a port of the pods
+type IntOrString struct {
+	IntVal int
+	StrVal string
+}
+
+// MarshalYAML returns the port number or name
+func (p IntOrString) MarshalYAML() (interface{}, error) {
+
+	if p.StrVal != "" {
+		return p.StrVal, nil
+	}
+
+	return p.IntVal, nil
+}
+
+// UnmarshalYAML reads a port number or name
+func (p *IntOrString) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	if err := unmarshal(&p.IntVal); err == nil {
+		return nil
+	}
+
+	return unmarshal(&p.StrVal)
+}
+
+// MarshalJSON returns the port number or name
+func (p IntOrString) MarshalJSON() ([]byte, error) {
+
+	if p.StrVal != "" {
+		return json.Marshal(p.StrVal)
+	}
+
+	return json.Marshal(p.IntVal)
+}
+
+// UnmarshalJSON reads a port number or name
+func (p *IntOrString) UnmarshalJSON(data []byte) error {
+
+	if err := json.Unmarshal(data, &p.IntVal); err == nil {
+		return nil
+	}
+
+	return json.Unmarshal(data, &p.StrVal)
+}
+
+// LabelSelector selects objects by their labels
+type LabelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels,omitempty" yaml:"matchLabels,omitempty"`
+	MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty" yaml:"matchExpressions,omitempty"`
+}
+
+// LabelSelectorRequirement matches the value of a label with the In, NotIn, Exists
+// and DoesNotExist operators
+type LabelSelectorRequirement struct {
+	Key      string   `json:"key" yaml:"key"`
+	Operator string   `json:"operator" yaml:"operator"`
+	Values   []string `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+// IPBlock selects a network
+type IPBlock struct {
+	CIDR   string   `json:"cidr" yaml:"cidr"`
+	Except []string `json:"except,omitempty" yaml:"except,omitempty"`
+}
+
+func (g *generator) networkPolicy(name string, s *subject) *NetworkPolicy {
+
+	policy := &NetworkPolicy{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "NetworkPolicy",
+		Metadata:   ObjectMeta{Name: name, Namespace: g.namespace},
+		Spec: NetworkPolicySpec{
+			PodSelector: LabelSelector{MatchLabels: s.labels},
+			PolicyTypes: []string{},
+		},
+	}
+
+	for _, p := range sortedPeers(s.ingress) {
+		policy.Spec.Ingress = append(policy.Spec.Ingress, NetworkPolicyRule{
+			From:  []NetworkPolicyPeer{g.networkPolicyPeer(p)},
+			Ports: networkPolicyPorts(p.ports),
+		})
+	}
+
+	for _, p := range sortedPeers(s.egress) {
+		policy.Spec.Egress = append(policy.Spec.Egress, NetworkPolicyRule{
+			To:    []NetworkPolicyPeer{g.networkPolicyPeer(p)},
+			Ports: networkPolicyPorts(p.ports),
+		})
+	}
+
+	if len(policy.Spec.Ingress) > 0 {
+		policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, "Ingress")
+	}
+	if len(policy.Spec.Egress) > 0 {
+		policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, "Egress")
+	}
+
+	return policy
+}
+
+func (g *generator) networkPolicyPeer(p *peer) NetworkPolicyPeer {
+
+	if p.cidr != "" {
+		return NetworkPolicyPeer{IPBlock: &IPBlock{CIDR: p.cidr}}
+	}
+
+	peer := NetworkPolicyPeer{PodSelector: &LabelSelector{MatchLabels: p.labels}}
+	if p.namespace != g.namespace {
+		peer.NamespaceSelector = &LabelSelector{MatchLabels: map[string]string{NamespaceNameLabel: p.namespace}}
+	}
+
+	return peer
+}
+
+func networkPolicyPorts(ports map[int]bool) []NetworkPolicyPort {
+
+	var result []NetworkPolicyPort
+	for _, port := range sortedPorts(ports) {
+		result = append(result, NetworkPolicyPort{Protocol: "TCP", Port: IntOrString{IntVal: port}})
+	}
+
+	return result
+}
+
+// NetworkPoliciesYAML returns the network policies as a multi-document YAML
+func (r *Result) NetworkPoliciesYAML() ([]byte, error) {
+
+	var b bytes.Buffer
+	for _, policy := range r.NetworkPolicies {
+		data, err := yaml.Marshal(policy)
+		if err != nil {
+			return nil, fmt.Errorf("Encoding network policy %s", err)
+		}
+		b.WriteString("---\n")
+		b.Write(data)
+	}
+
+	return b.Bytes(), nil
+}
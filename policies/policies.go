@@ -0,0 +1,366 @@
+package policies
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Endpoint is one end of an observed flow
+type Endpoint struct {
+	ID        string
+	Name      string
+	Namespace string
+	// IP is the address or network of external endpoints
+	IP       string
+	Labels   map[string]string
+	External bool
+	// Workload is the name of the controller of the pu, used to group reports
+	Workload string
+}
+
+// Flow is an observed flow to a destination port
+type Flow struct {
+	Source      Endpoint
+	Destination Endpoint
+	Port        int
+	Count       int
+	// Rejected tells if the flow was rejected by the enforced policies
+	Rejected bool
+}
+
+// UnexpressedFlow is an observed flow that the generated policies do not allow
+type UnexpressedFlow struct {
+	Source      string `json:"source" yaml:"source"`
+	Destination string `json:"destination" yaml:"destination"`
+	Port        int    `json:"port" yaml:"port"`
+	Count       int    `json:"count" yaml:"count"`
+	Reason      string `json:"reason" yaml:"reason"`
+}
+
+// Result holds the policies generated for a namespace
+type Result struct {
+	Namespace       string            `json:"namespace"`
+	NetworkPolicies []*NetworkPolicy  `json:"networkPolicies"`
+	RuleSets        []*RuleSet        `json:"ruleSets"`
+	Unexpressed     []UnexpressedFlow `json:"unexpressed"`
+	// UnknownProtocol holds the ports allowed for TCP only, the flows do not record their protocol
+	UnknownProtocol []int `json:"unknownProtocol"`
+}
+
+// Generate returns the allow-list policies describing the flows accepted to and from
+// the pus of the namespace. Flows that cannot be described by label selectors,
+// networks and ports are reported as unexpressed.
+func Generate(namespace string, flows []Flow) *Result {
+
+	g := &generator{
+		namespace: namespace,
+		subjects:  map[string]*subject{},
+		ports:     map[int]bool{},
+	}
+
+	for _, flow := range flows {
+		if !flow.Rejected {
+			g.add(flow)
+		}
+	}
+
+	return g.result()
+}
+
+// subject is a set of pus of the namespace selected by the same labels
+type subject struct {
+	labels  map[string]string
+	ingress map[string]*peer
+	egress  map[string]*peer
+}
+
+// peer is the other end of the flows of a subject
+type peer struct {
+	namespace string
+	labels    map[string]string
+	cidr      string
+	ports     map[int]bool
+}
+
+type generator struct {
+	namespace   string
+	subjects    map[string]*subject
+	unexpressed []UnexpressedFlow
+	ports       map[int]bool
+}
+
+func (g *generator) add(flow Flow) {
+
+	if flow.Port <= 0 {
+		g.reject(flow, "unknown destination port")
+		return
+	}
+
+	// A flow between two pus of the namespace is allowed by an ingress and an egress rule
+	var err error
+	if g.local(flow.Destination) {
+		err = g.addRule(flow, flow.Destination, flow.Source, true)
+	}
+
+	if g.local(flow.Source) {
+		if egressErr := g.addRule(flow, flow.Source, flow.Destination, false); err == nil {
+			err = egressErr
+		}
+	}
+
+	if err != nil {
+		g.reject(flow, err.Error())
+	}
+}
+
+// local tells if the endpoint is a pu of the namespace of the policies
+func (g *generator) local(e Endpoint) bool {
+
+	return !e.External && e.Namespace == g.namespace
+}
+
+func (g *generator) addRule(flow Flow, local Endpoint, remote Endpoint, ingress bool) error {
+
+	labels := SelectorLabels(local.Labels)
+	if len(labels) == 0 {
+		return fmt.Errorf("%s has no labels to select it", endpointName(local))
+	}
+
+	p, err := peerOf(remote)
+	if err != nil {
+		return err
+	}
+
+	key := labelsKey(labels)
+	s, ok := g.subjects[key]
+	if !ok {
+		s = &subject{labels: labels, ingress: map[string]*peer{}, egress: map[string]*peer{}}
+		g.subjects[key] = s
+	}
+
+	peers := s.egress
+	if ingress {
+		peers = s.ingress
+	}
+
+	peerKey := p.namespace + "/" + labelsKey(p.labels) + "/" + p.cidr
+	if existing, ok := peers[peerKey]; ok {
+		p = existing
+	} else {
+		peers[peerKey] = p
+	}
+	p.ports[flow.Port] = true
+	g.ports[flow.Port] = true
+
+	return nil
+}
+
+func (g *generator) reject(flow Flow, reason string) {
+
+	g.unexpressed = append(g.unexpressed, UnexpressedFlow{
+		Source:      endpointName(flow.Source),
+		Destination: endpointName(flow.Destination),
+		Port:        flow.Port,
+		Count:       flow.Count,
+		Reason:      reason,
+	})
+}
+
+func peerOf(e Endpoint) (*peer, error) {
+
+	p := &peer{ports: map[int]bool{}}
+
+	if e.External {
+		cidr, err := endpointCIDR(e.IP)
+		if err != nil {
+			return nil, err
+		}
+		p.cidr = cidr
+		return p, nil
+	}
+
+	p.namespace = e.Namespace
+	p.labels = SelectorLabels(e.Labels)
+	if len(p.labels) == 0 {
+		return nil, fmt.Errorf("%s has no labels to select it", endpointName(e))
+	}
+
+	return p, nil
+}
+
+// endpointCIDR returns the network of an external endpoint
+func endpointCIDR(address string) (string, error) {
+
+	if _, network, err := net.ParseCIDR(address); err == nil {
+		return network.String(), nil
+	}
+
+	if ip := net.ParseIP(address); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+
+	return "", fmt.Errorf("external endpoint %s has no known network", address)
+}
+
+func endpointName(e Endpoint) string {
+
+	switch {
+	case e.External && e.IP != "":
+		return e.IP
+	case e.Name != "" && e.Namespace != "":
+		return e.Namespace + "/" + e.Name
+	case e.Name != "":
+		return e.Name
+	}
+
+	return e.ID
+}
+
+// ignoredLabels holds the prefixes of the labels set by the runtime that do not
+// describe a workload and must not be used in selectors
+var ignoredLabels = []string{
+	"io.kubernetes.",
+	"annotation.",
+	"pod-template-hash",
+	"pod-template-generation",
+	"controller-revision-hash",
+	"statefulset.kubernetes.io/pod-name",
+}
+
+// SelectorLabels returns the labels of a pu that can be used to select its workload.
+// The app label is used alone when present.
+func SelectorLabels(labels map[string]string) map[string]string {
+
+	if app, ok := labels["app"]; ok {
+		return map[string]string{"app": app}
+	}
+
+	selector := map[string]string{}
+	for k, v := range labels {
+		if !ignoredLabel(k) {
+			selector[k] = v
+		}
+	}
+
+	return selector
+}
+
+func ignoredLabel(key string) bool {
+
+	for _, prefix := range ignoredLabels {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func labelsKey(labels map[string]string) string {
+
+	keys := sortedKeys(labels)
+	for i, k := range keys {
+		keys[i] = k + "=" + labels[k]
+	}
+
+	return strings.Join(keys, ",")
+}
+
+func sortedKeys(labels map[string]string) []string {
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedPorts(ports map[int]bool) []int {
+
+	result := make([]int, 0, len(ports))
+	for port := range ports {
+		result = append(result, port)
+	}
+	sort.Ints(result)
+
+	return result
+}
+
+func sortedPeers(peers map[string]*peer) []*peer {
+
+	keys := make([]string, 0, len(peers))
+	for k := range peers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]*peer, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, peers[k])
+	}
+
+	return result
+}
+
+var invalidNameCharacters = regexp.MustCompile("[^a-z0-9-]+")
+
+// policyName returns a DNS-1123 name for the policy of the subject
+func policyName(labels map[string]string, used map[string]bool) string {
+
+	var values []string
+	for _, k := range sortedKeys(labels) {
+		values = append(values, labels[k])
+	}
+
+	name := "allow-" + strings.Trim(invalidNameCharacters.ReplaceAllString(strings.ToLower(strings.Join(values, "-")), "-"), "-")
+	if len(name) > 56 {
+		name = strings.TrimRight(name[:56], "-")
+	}
+
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = name + "-" + strconv.Itoa(i)
+	}
+	used[unique] = true
+
+	return unique
+}
+
+func (g *generator) result() *Result {
+
+	result := &Result{
+		Namespace:       g.namespace,
+		NetworkPolicies: []*NetworkPolicy{},
+		RuleSets:        []*RuleSet{},
+		Unexpressed:     g.unexpressed,
+		UnknownProtocol: sortedPorts(g.ports),
+	}
+	if result.Unexpressed == nil {
+		result.Unexpressed = []UnexpressedFlow{}
+	}
+
+	keys := make([]string, 0, len(g.subjects))
+	for k := range g.subjects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	used := map[string]bool{}
+	for _, k := range keys {
+		s := g.subjects[k]
+		name := policyName(s.labels, used)
+		result.NetworkPolicies = append(result.NetworkPolicies, g.networkPolicy(name, s))
+		result.RuleSets = append(result.RuleSets, g.ruleSet(name, s))
+	}
+
+	return result
+}
@@ -0,0 +1,102 @@
+package policies
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGenerate(t *testing.T) {
+
+	web := Endpoint{ID: "1", Name: "web-1", Namespace: "default", Labels: map[string]string{"app": "web", "pod-template-hash": "123"}}
+	db := Endpoint{ID: "2", Name: "db-0", Namespace: "default", Labels: map[string]string{"app": "db"}}
+	monitor := Endpoint{ID: "3", Name: "prometheus", Namespace: "monitoring", Labels: map[string]string{"role": "monitor", "io.kubernetes.pod.name": "prometheus"}}
+	unlabelled := Endpoint{ID: "4", Name: "debug", Namespace: "default", Labels: map[string]string{"io.kubernetes.pod.name": "debug"}}
+	internet := Endpoint{ID: "ext:10.1.0.0/24", IP: "10.1.0.0/24", External: true}
+	world := Endpoint{ID: "ext:world", IP: "world", External: true}
+
+	Convey("Given I generate the policies of flows of a namespace", t, func() {
+		result := Generate("default", []Flow{
+			{Source: web, Destination: db, Port: 5432, Count: 10},
+			{Source: web, Destination: db, Port: 5433, Count: 1},
+			{Source: monitor, Destination: web, Port: 9090, Count: 3},
+			{Source: internet, Destination: web, Port: 80, Count: 7},
+			{Source: web, Destination: world, Port: 443, Count: 2},
+			{Source: unlabelled, Destination: db, Port: 5432, Count: 1},
+		})
+
+		Convey("Then I should get one policy per selected workload", func() {
+			So(len(result.NetworkPolicies), ShouldEqual, 2)
+			So(len(result.RuleSets), ShouldEqual, 2)
+
+			dbPolicy := result.NetworkPolicies[0]
+			So(dbPolicy.Metadata, ShouldResemble, ObjectMeta{Name: "allow-db", Namespace: "default"})
+			So(dbPolicy.Spec.PodSelector.MatchLabels, ShouldResemble, map[string]string{"app": "db"})
+			So(dbPolicy.Spec.PolicyTypes, ShouldResemble, []string{"Ingress"})
+			So(len(dbPolicy.Spec.Ingress), ShouldEqual, 1)
+			So(dbPolicy.Spec.Ingress[0].From[0].PodSelector.MatchLabels, ShouldResemble, map[string]string{"app": "web"})
+			So(dbPolicy.Spec.Ingress[0].From[0].NamespaceSelector, ShouldBeNil)
+			So(dbPolicy.Spec.Ingress[0].Ports, ShouldResemble, []NetworkPolicyPort{{Protocol: "TCP", Port: IntOrString{IntVal: 5432}}, {Protocol: "TCP", Port: IntOrString{IntVal: 5433}}})
+
+			webPolicy := result.NetworkPolicies[1]
+			So(webPolicy.Metadata.Name, ShouldEqual, "allow-web")
+			So(webPolicy.Spec.PolicyTypes, ShouldResemble, []string{"Ingress", "Egress"})
+			So(len(webPolicy.Spec.Ingress), ShouldEqual, 2)
+			So(webPolicy.Spec.Ingress[0].From[0].IPBlock, ShouldResemble, &IPBlock{CIDR: "10.1.0.0/24"})
+			So(webPolicy.Spec.Ingress[1].From[0].PodSelector.MatchLabels, ShouldResemble, map[string]string{"role": "monitor"})
+			So(webPolicy.Spec.Ingress[1].From[0].NamespaceSelector.MatchLabels, ShouldResemble, map[string]string{NamespaceNameLabel: "monitoring"})
+			So(len(webPolicy.Spec.Egress), ShouldEqual, 1)
+			So(webPolicy.Spec.Egress[0].To[0].PodSelector.MatchLabels, ShouldResemble, map[string]string{"app": "db"})
+		})
+
+		Convey("Then the ports should be allowed for TCP only and reported", func() {
+			dns := Endpoint{ID: "5", Name: "kube-dns-0", Namespace: "kube-system", Labels: map[string]string{"k8s-app": "kube-dns"}}
+			resolving := Generate("default", []Flow{{Source: web, Destination: dns, Port: 53, Count: 4}})
+			So(resolving.NetworkPolicies[0].Spec.Egress[0].Ports, ShouldResemble, []NetworkPolicyPort{{Protocol: "TCP", Port: IntOrString{IntVal: 53}}})
+			So(resolving.UnknownProtocol, ShouldResemble, []int{53})
+			So(result.UnknownProtocol, ShouldResemble, []int{80, 5432, 5433, 9090})
+		})
+
+		Convey("Then I should get the Trireme rule sets", func() {
+			ruleSet := result.RuleSets[1]
+			So(ruleSet.Name, ShouldEqual, "allow-web")
+			So(ruleSet.Subject, ShouldResemble, []string{"@namespace=default", "@usr:app=web"})
+			So(ruleSet.ReceiverRules, ShouldResemble, []Rule{
+				{Network: "10.1.0.0/24", Ports: []int{80}, Action: "accept"},
+				{Tags: []string{"@namespace=monitoring", "@usr:role=monitor"}, Ports: []int{9090}, Action: "accept"},
+			})
+			So(ruleSet.TransmitterRules, ShouldResemble, []Rule{
+				{Tags: []string{"@namespace=default", "@usr:app=db"}, Ports: []int{5432, 5433}, Action: "accept"},
+			})
+		})
+
+		Convey("Then I should get the flows that could not be expressed", func() {
+			So(result.Unexpressed, ShouldResemble, []UnexpressedFlow{
+				{Source: "default/web-1", Destination: "world", Port: 443, Count: 2, Reason: "external endpoint world has no known network"},
+				{Source: "default/debug", Destination: "default/db-0", Port: 5432, Count: 1, Reason: "default/debug has no labels to select it"},
+			})
+		})
+
+		Convey("Then I should be able to write the policies as YAML", func() {
+			data, err := result.NetworkPoliciesYAML()
+			So(err, ShouldBeNil)
+			So(strings.Count(string(data), "---\n"), ShouldEqual, 2)
+			So(string(data), ShouldContainSubstring, "apiVersion: networking.k8s.io/v1")
+			So(string(data), ShouldContainSubstring, "kubernetes.io/metadata.name: monitoring")
+
+			data, err = result.RuleSetsYAML()
+			So(err, ShouldBeNil)
+			So(string(data), ShouldContainSubstring, "- '@usr:app=web'")
+		})
+	})
+
+	Convey("Given I generate the names of policies", t, func() {
+		used := map[string]bool{}
+
+		Convey("Then I should get unique DNS-1123 names", func() {
+			So(policyName(map[string]string{"app": "Web_Front"}, used), ShouldEqual, "allow-web-front")
+			So(policyName(map[string]string{"app": "web.front"}, used), ShouldEqual, "allow-web-front-2")
+		})
+	})
+}
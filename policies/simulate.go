@@ -0,0 +1,603 @@
+package policies
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// NewlyRejected marks the accepted flows that the proposed policies reject
+	NewlyRejected = "newlyrejected"
+	// NewlyAccepted marks the rejected flows that the proposed policies accept
+	NewlyAccepted = "newlyaccepted"
+)
+
+// PolicySet is a set of proposed Kubernetes NetworkPolicies and Trireme rule sets
+type PolicySet struct {
+	NetworkPolicies []*NetworkPolicy
+	RuleSets        []*RuleSet
+}
+
+// LoadPolicyFile loads the policies of a YAML file
+func LoadPolicyFile(path string) (*PolicySet, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading policies %s", err)
+	}
+
+	return ParsePolicies(data)
+}
+
+// ParsePolicies parses YAML documents holding NetworkPolicies, NetworkPolicyLists,
+// Trireme rule sets or lists of rule sets
+func ParsePolicies(data []byte) (*PolicySet, error) {
+
+	set := &PolicySet{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	for i := 1; ; i++ {
+		var document interface{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Parsing policy document %d %s", i, err)
+		}
+
+		if err := set.add(document); err != nil {
+			return nil, fmt.Errorf("Parsing policy document %d %s", i, err)
+		}
+	}
+
+	return set, nil
+}
+
+func (s *PolicySet) add(document interface{}) error {
+
+	switch d := document.(type) {
+	case nil:
+		return nil
+
+	case []interface{}:
+		var ruleSets []*RuleSet
+		if err := remarshal(d, &ruleSets); err != nil {
+			return err
+		}
+		s.RuleSets = append(s.RuleSets, ruleSets...)
+		return nil
+
+	case map[interface{}]interface{}:
+		kind, _ := d["kind"].(string)
+		switch {
+		case kind == "NetworkPolicy":
+			var policy NetworkPolicy
+			if err := remarshal(d, &policy); err != nil {
+				return err
+			}
+			s.NetworkPolicies = append(s.NetworkPolicies, &policy)
+			return nil
+
+		case kind == "NetworkPolicyList" || kind == "List":
+			items, _ := d["items"].([]interface{})
+			for _, item := range items {
+				if err := s.add(item); err != nil {
+					return err
+				}
+			}
+			return nil
+
+		case kind == "" && d["subject"] != nil:
+			var ruleSet RuleSet
+			if err := remarshal(d, &ruleSet); err != nil {
+				return err
+			}
+			s.RuleSets = append(s.RuleSets, &ruleSet)
+			return nil
+		}
+
+		return fmt.Errorf("unsupported kind %q", kind)
+	}
+
+	return fmt.Errorf("unsupported document")
+}
+
+// remarshal decodes a generic YAML document into v
+func remarshal(document interface{}, v interface{}) error {
+
+	data, err := yaml.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(data, v)
+}
+
+// SimulatedFlow is an observed flow whose decision changes with the proposed policies
+type SimulatedFlow struct {
+	Source        string `json:"source"`
+	SourceID      string `json:"sourceID"`
+	Destination   string `json:"destination"`
+	DestinationID string `json:"destinationID"`
+	Port          int    `json:"port"`
+	Count         int    `json:"count"`
+	Change        string `json:"change"`
+	// Namespace and Workload are the pu whose policies decide the change
+	Namespace string `json:"namespace"`
+	Workload  string `json:"workload"`
+	Reason    string `json:"reason"`
+}
+
+// SimulationGroup counts the changed flows of a workload
+type SimulationGroup struct {
+	Namespace     string `json:"namespace"`
+	Workload      string `json:"workload"`
+	NewlyRejected int    `json:"newlyRejected"`
+	NewlyAccepted int    `json:"newlyAccepted"`
+}
+
+// SimulationSummary counts the flows evaluated by a simulation
+type SimulationSummary struct {
+	Evaluated     int `json:"evaluated"`
+	Unaffected    int `json:"unaffected"`
+	Unchanged     int `json:"unchanged"`
+	NewlyRejected int `json:"newlyRejected"`
+	NewlyAccepted int `json:"newlyAccepted"`
+}
+
+// Simulation is the result of the evaluation of proposed policies against observed flows
+type Simulation struct {
+	Flows   []SimulatedFlow   `json:"flows"`
+	Groups  []SimulationGroup `json:"groups"`
+	Summary SimulationSummary `json:"summary"`
+	// Unresolved lists the named ports of the policies. They do not allow any flow
+	// as the ports of the pods are unknown.
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+// Simulate evaluates the proposed policies against the observed flows. Only the flows
+// to or from the pus selected by the proposed policies are affected: a pu selected
+// for ingress or egress only accepts the flows allowed by one of its policies.
+// Namespaces are matched by their kubernetes.io/metadata.name label only.
+func Simulate(set *PolicySet, flows []Flow) *Simulation {
+
+	simulation := &Simulation{Flows: []SimulatedFlow{}, Groups: []SimulationGroup{}, Unresolved: set.namedPorts()}
+	groups := map[string]*SimulationGroup{}
+
+	for _, flow := range flows {
+		simulation.Summary.Evaluated++
+
+		ingress := set.decide(flow, true)
+		egress := set.decide(flow, false)
+		if !ingress.isolated && !egress.isolated {
+			simulation.Summary.Unaffected++
+			continue
+		}
+
+		accepted := ingress.allowed() && egress.allowed()
+		if accepted != flow.Rejected {
+			simulation.Summary.Unchanged++
+			continue
+		}
+
+		simulated := SimulatedFlow{
+			Source:        endpointName(flow.Source),
+			SourceID:      flow.Source.ID,
+			Destination:   endpointName(flow.Destination),
+			DestinationID: flow.Destination.ID,
+			Port:          flow.Port,
+			Count:         flow.Count,
+		}
+
+		// The change is reported on the pu whose policies decide it
+		decided, owner := ingress, flow.Destination
+		if accepted {
+			simulated.Change = NewlyAccepted
+			simulation.Summary.NewlyAccepted++
+			if !ingress.isolated {
+				decided, owner = egress, flow.Source
+			}
+			simulated.Reason = "allowed by " + strings.Join(decided.allowedBy, ", ")
+		} else {
+			simulated.Change = NewlyRejected
+			simulation.Summary.NewlyRejected++
+			if ingress.allowed() {
+				decided, owner = egress, flow.Source
+			}
+			simulated.Reason = decided.reason()
+		}
+		simulated.Namespace = owner.Namespace
+		simulated.Workload = workloadOf(owner)
+
+		key := simulated.Namespace + "/" + simulated.Workload
+		group, ok := groups[key]
+		if !ok {
+			group = &SimulationGroup{Namespace: simulated.Namespace, Workload: simulated.Workload}
+			groups[key] = group
+		}
+		if accepted {
+			group.NewlyAccepted++
+		} else {
+			group.NewlyRejected++
+		}
+
+		simulation.Flows = append(simulation.Flows, simulated)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		simulation.Groups = append(simulation.Groups, *groups[k])
+	}
+
+	return simulation
+}
+
+func workloadOf(e Endpoint) string {
+
+	if e.Workload != "" {
+		return e.Workload
+	}
+
+	return endpointName(e)
+}
+
+// decision is the outcome of the proposed policies on one end of a flow
+type decision struct {
+	direction  string
+	isolatedBy []string
+	allowedBy  []string
+	rejectedBy []string
+	isolated   bool
+}
+
+func (d *decision) allowed() bool {
+
+	return !d.isolated || (len(d.allowedBy) > 0 && len(d.rejectedBy) == 0)
+}
+
+func (d *decision) reason() string {
+
+	if len(d.rejectedBy) > 0 {
+		return d.direction + " rejected by " + strings.Join(d.rejectedBy, ", ")
+	}
+
+	return d.direction + " not allowed by " + strings.Join(d.isolatedBy, ", ")
+}
+
+// decide evaluates the policies of the destination of the flow for ingress, or of
+// its source for egress
+func (s *PolicySet) decide(flow Flow, ingress bool) *decision {
+
+	local, remote := flow.Source, flow.Destination
+	d := &decision{direction: "egress"}
+	if ingress {
+		local, remote = flow.Destination, flow.Source
+		d.direction = "ingress"
+	}
+
+	if local.External {
+		return d
+	}
+
+	for _, policy := range s.NetworkPolicies {
+		namespace := policy.namespace()
+		if local.Namespace != namespace || !policy.Spec.PodSelector.Matches(local.Labels) || !policy.hasType(ingress) {
+			continue
+		}
+
+		d.isolated = true
+		d.isolatedBy = append(d.isolatedBy, policy.Metadata.Name)
+
+		rules := policy.Spec.Egress
+		if ingress {
+			rules = policy.Spec.Ingress
+		}
+		for _, rule := range rules {
+			if rule.allows(remote, flow.Port, namespace, ingress) {
+				d.allowedBy = append(d.allowedBy, policy.Metadata.Name)
+				break
+			}
+		}
+	}
+
+	localTags := endpointTags(local)
+	remoteTags := endpointTags(remote)
+	for _, ruleSet := range s.RuleSets {
+		rules := ruleSet.TransmitterRules
+		if ingress {
+			rules = ruleSet.ReceiverRules
+		}
+		if len(rules) == 0 || !hasTags(localTags, ruleSet.Subject) {
+			continue
+		}
+
+		d.isolated = true
+		d.isolatedBy = append(d.isolatedBy, ruleSet.Name)
+
+		for _, rule := range rules {
+			if !rule.matches(remote, remoteTags, flow.Port) {
+				continue
+			}
+			if rule.Action == "reject" {
+				d.rejectedBy = append(d.rejectedBy, ruleSet.Name)
+			} else {
+				d.allowedBy = append(d.allowedBy, ruleSet.Name)
+			}
+		}
+	}
+
+	return d
+}
+
+func (p *NetworkPolicy) namespace() string {
+
+	if p.Metadata.Namespace == "" {
+		return "default"
+	}
+
+	return p.Metadata.Namespace
+}
+
+// hasType tells if the policy applies to the ingress or the egress of its pods. Without
+// policy types, policies apply to ingress, and to egress when they have egress rules.
+func (p *NetworkPolicy) hasType(ingress bool) bool {
+
+	if len(p.Spec.PolicyTypes) == 0 {
+		return ingress || len(p.Spec.Egress) > 0
+	}
+
+	policyType := "Egress"
+	if ingress {
+		policyType = "Ingress"
+	}
+	for _, t := range p.Spec.PolicyTypes {
+		if t == policyType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allows tells if the rule allows the flow with the remote endpoint on the port
+func (r *NetworkPolicyRule) allows(remote Endpoint, port int, namespace string, ingress bool) bool {
+
+	if len(r.Ports) > 0 {
+		matched := false
+		for _, p := range r.Ports {
+			if p.matches(port) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	peers := r.To
+	if ingress {
+		peers = r.From
+	}
+	if len(peers) == 0 {
+		return true
+	}
+
+	for _, peer := range peers {
+		if peer.matches(remote, namespace) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches tells if the flow port is allowed. Flows do not record their protocol, so
+// every protocol matches. Named ports are resolved from the pod specs, which are
+// unknown, and never match.
+func (p *NetworkPolicyPort) matches(port int) bool {
+
+	switch {
+	case p.Port.StrVal != "":
+		return false
+	case p.Port.IntVal == 0:
+		return true
+	case p.EndPort > 0:
+		return port >= p.Port.IntVal && port <= p.EndPort
+	}
+
+	return port == p.Port.IntVal
+}
+
+// namedPorts returns the named ports of the NetworkPolicies, that cannot be resolved
+func (s *PolicySet) namedPorts() []string {
+
+	var named []string
+	for _, policy := range s.NetworkPolicies {
+		for _, rules := range [][]NetworkPolicyRule{policy.Spec.Ingress, policy.Spec.Egress} {
+			for _, rule := range rules {
+				for _, p := range rule.Ports {
+					if p.Port.StrVal != "" {
+						named = append(named, policy.Metadata.Name+": named port "+p.Port.StrVal)
+					}
+				}
+			}
+		}
+	}
+
+	return named
+}
+
+func (p *NetworkPolicyPeer) matches(e Endpoint, namespace string) bool {
+
+	if p.IPBlock != nil {
+		return p.IPBlock.contains(e.IP)
+	}
+
+	if e.External {
+		return false
+	}
+
+	if p.NamespaceSelector == nil {
+		if e.Namespace != namespace {
+			return false
+		}
+	} else if !p.NamespaceSelector.Matches(map[string]string{NamespaceNameLabel: e.Namespace}) {
+		return false
+	}
+
+	return p.PodSelector == nil || p.PodSelector.Matches(e.Labels)
+}
+
+// contains tells if the address, or the whole network, is in the block
+func (b *IPBlock) contains(address string) bool {
+
+	_, block, err := net.ParseCIDR(b.CIDR)
+	if err != nil {
+		return false
+	}
+
+	network := endpointNetwork(address)
+	if network == nil || !networkContains(block, network) {
+		return false
+	}
+
+	for _, except := range b.Except {
+		if _, excepted, err := net.ParseCIDR(except); err == nil && (networkContains(excepted, network) || networkContains(network, excepted)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func endpointNetwork(address string) *net.IPNet {
+
+	cidr, err := endpointCIDR(address)
+	if err != nil {
+		return nil
+	}
+
+	_, network, _ := net.ParseCIDR(cidr)
+
+	return network
+}
+
+// networkContains tells if the network a holds the whole network b
+func networkContains(a *net.IPNet, b *net.IPNet) bool {
+
+	aPrefix, aBits := a.Mask.Size()
+	bPrefix, bBits := b.Mask.Size()
+
+	return aBits == bBits && aPrefix <= bPrefix && a.Contains(b.IP)
+}
+
+// Matches tells if the labels match the selector. An empty selector matches everything.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+
+	for k, v := range s.MatchLabels {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+
+	for _, requirement := range s.MatchExpressions {
+		value, ok := labels[requirement.Key]
+		switch requirement.Operator {
+		case "In":
+			if !ok || !contains(requirement.Values, value) {
+				return false
+			}
+		case "NotIn":
+			if ok && contains(requirement.Values, value) {
+				return false
+			}
+		case "Exists":
+			if !ok {
+				return false
+			}
+		case "DoesNotExist":
+			if ok {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Rule) matches(remote Endpoint, remoteTags map[string]bool, port int) bool {
+
+	if len(r.Ports) > 0 && !containsInt(r.Ports, port) {
+		return false
+	}
+
+	if r.Network != "" {
+		block := &IPBlock{CIDR: r.Network}
+		return block.contains(remote.IP)
+	}
+
+	return !remote.External && hasTags(remoteTags, r.Tags)
+}
+
+// endpointTags returns the Trireme tags of a pu
+func endpointTags(e Endpoint) map[string]bool {
+
+	result := map[string]bool{}
+	if e.External {
+		return result
+	}
+
+	for _, tag := range tags(e.Namespace, e.Labels) {
+		result[tag] = true
+	}
+
+	return result
+}
+
+func hasTags(tags map[string]bool, required []string) bool {
+
+	for _, tag := range required {
+		if !tags[tag] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
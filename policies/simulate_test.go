@@ -0,0 +1,153 @@
+package policies
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const proposedPolicies = `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: db
+  namespace: default
+spec:
+  podSelector:
+    matchLabels:
+      app: db
+  ingress:
+  - from:
+    - podSelector:
+        matchExpressions:
+        - key: app
+          operator: In
+          values: [web]
+    ports:
+    - protocol: TCP
+      port: 5432
+---
+- name: web
+  subject: ["@namespace=default", "@usr:app=web"]
+  receiverRules:
+  - network: 10.0.0.0/8
+    ports: [80]
+    action: accept
+`
+
+func TestParsePolicies(t *testing.T) {
+
+	Convey("Given I parse proposed policies", t, func() {
+		set, err := ParsePolicies([]byte(proposedPolicies))
+
+		Convey("Then I should get the NetworkPolicies and the rule sets", func() {
+			So(err, ShouldBeNil)
+			So(len(set.NetworkPolicies), ShouldEqual, 1)
+			So(set.NetworkPolicies[0].Spec.Ingress[0].From[0].PodSelector.MatchExpressions, ShouldResemble, []LabelSelectorRequirement{{Key: "app", Operator: "In", Values: []string{"web"}}})
+			So(len(set.RuleSets), ShouldEqual, 1)
+			So(set.RuleSets[0].ReceiverRules[0].Network, ShouldEqual, "10.0.0.0/8")
+		})
+	})
+
+	Convey("Given I parse an unsupported document", t, func() {
+		_, err := ParsePolicies([]byte("kind: Deployment\n"))
+
+		Convey("Then I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSimulate(t *testing.T) {
+
+	web := Endpoint{ID: "1", Name: "web-1", Namespace: "default", Labels: map[string]string{"app": "web"}, Workload: "web"}
+	db := Endpoint{ID: "2", Name: "db-0", Namespace: "default", Labels: map[string]string{"app": "db"}, Workload: "db"}
+	batch := Endpoint{ID: "3", Name: "batch-1", Namespace: "jobs", Labels: map[string]string{"app": "batch"}, Workload: "batch"}
+	lan := Endpoint{ID: "ext:10.1.0.0/24", IP: "10.1.0.0/24", External: true}
+	internet := Endpoint{ID: "ext:8.8.8.8", IP: "8.8.8.8", External: true}
+
+	Convey("Given I simulate proposed policies against observed flows", t, func() {
+		set, err := ParsePolicies([]byte(proposedPolicies))
+		So(err, ShouldBeNil)
+
+		simulation := Simulate(set, []Flow{
+			{Source: web, Destination: db, Port: 5432, Count: 5},
+			{Source: web, Destination: db, Port: 22, Count: 1},
+			{Source: batch, Destination: db, Port: 5432, Count: 2},
+			{Source: lan, Destination: web, Port: 80, Count: 3, Rejected: true},
+			{Source: internet, Destination: web, Port: 80, Count: 4},
+			{Source: web, Destination: batch, Port: 8080, Count: 1},
+		})
+
+		Convey("Then I should get the flows whose decision changes", func() {
+			So(simulation.Summary, ShouldResemble, SimulationSummary{Evaluated: 6, Unaffected: 1, Unchanged: 1, NewlyRejected: 3, NewlyAccepted: 1})
+			So(simulation.Flows, ShouldResemble, []SimulatedFlow{
+				{Source: "default/web-1", SourceID: "1", Destination: "default/db-0", DestinationID: "2", Port: 22, Count: 1, Change: NewlyRejected, Namespace: "default", Workload: "db", Reason: "ingress not allowed by db"},
+				{Source: "jobs/batch-1", SourceID: "3", Destination: "default/db-0", DestinationID: "2", Port: 5432, Count: 2, Change: NewlyRejected, Namespace: "default", Workload: "db", Reason: "ingress not allowed by db"},
+				{Source: "10.1.0.0/24", SourceID: "ext:10.1.0.0/24", Destination: "default/web-1", DestinationID: "1", Port: 80, Count: 3, Change: NewlyAccepted, Namespace: "default", Workload: "web", Reason: "allowed by web"},
+				{Source: "8.8.8.8", SourceID: "ext:8.8.8.8", Destination: "default/web-1", DestinationID: "1", Port: 80, Count: 4, Change: NewlyRejected, Namespace: "default", Workload: "web", Reason: "ingress not allowed by web"},
+			})
+		})
+
+		Convey("Then I should get the changes grouped by workload", func() {
+			So(simulation.Groups, ShouldResemble, []SimulationGroup{
+				{Namespace: "default", Workload: "db", NewlyRejected: 2},
+				{Namespace: "default", Workload: "web", NewlyRejected: 1, NewlyAccepted: 1},
+			})
+		})
+	})
+
+	Convey("Given I simulate policies allowing UDP and named ports", t, func() {
+		set, err := ParsePolicies([]byte(`
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: db
+spec:
+  podSelector:
+    matchLabels:
+      app: db
+  ingress:
+  - ports:
+    - protocol: UDP
+      port: 5432
+    - port: metrics
+`))
+		So(err, ShouldBeNil)
+
+		simulation := Simulate(set, []Flow{
+			{Source: web, Destination: db, Port: 5432, Count: 5},
+			{Source: web, Destination: db, Port: 9187, Count: 1},
+		})
+
+		Convey("Then the flows should match any protocol and the named ports should be reported", func() {
+			So(simulation.Summary, ShouldResemble, SimulationSummary{Evaluated: 2, Unchanged: 1, NewlyRejected: 1})
+			So(simulation.Flows[0].Port, ShouldEqual, 9187)
+			So(simulation.Unresolved, ShouldResemble, []string{"db: named port metrics"})
+		})
+	})
+
+	Convey("Given I match label selectors", t, func() {
+		labels := map[string]string{"app": "web", "tier": "frontend"}
+
+		Convey("Then I should get the result of every operator", func() {
+			So((&LabelSelector{}).Matches(labels), ShouldBeTrue)
+			So((&LabelSelector{MatchLabels: map[string]string{"app": "db"}}).Matches(labels), ShouldBeFalse)
+			So((&LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "tier", Operator: "NotIn", Values: []string{"backend"}}}}).Matches(labels), ShouldBeTrue)
+			So((&LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "Exists"}}}).Matches(labels), ShouldBeFalse)
+			So((&LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "DoesNotExist"}}}).Matches(labels), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given I match ip blocks", t, func() {
+		block := &IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.2.0.0/16"}}
+
+		Convey("Then I should only match the addresses and networks within the block", func() {
+			So(block.contains("10.1.2.3"), ShouldBeTrue)
+			So(block.contains("10.1.0.0/24"), ShouldBeTrue)
+			So(block.contains("10.2.0.1"), ShouldBeFalse)
+			So(block.contains("0.0.0.0/0"), ShouldBeFalse)
+			So(block.contains("world"), ShouldBeFalse)
+		})
+	})
+}
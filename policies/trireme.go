@@ -0,0 +1,85 @@
+package policies
+
+import (
+	"fmt"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Trireme tag prefixes
+const (
+	NamespaceTag  = "@namespace"
+	UserTagPrefix = "@usr:"
+)
+
+// RuleSet is a Trireme tag-based policy. The pus with all the subject tags accept
+// the traffic matching the receiver rules and send the traffic matching the
+// transmitter rules.
+type RuleSet struct {
+	Name             string   `json:"name" yaml:"name"`
+	Subject          []string `json:"subject" yaml:"subject"`
+	ReceiverRules    []Rule   `json:"receiverRules,omitempty" yaml:"receiverRules,omitempty"`
+	TransmitterRules []Rule   `json:"transmitterRules,omitempty" yaml:"transmitterRules,omitempty"`
+}
+
+// Rule matches the flows from or to the pus with all the tags, or the network, on the ports
+type Rule struct {
+	Tags    []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Network string   `json:"network,omitempty" yaml:"network,omitempty"`
+	Ports   []int    `json:"ports" yaml:"ports"`
+	Action  string   `json:"action" yaml:"action"`
+}
+
+func (g *generator) ruleSet(name string, s *subject) *RuleSet {
+
+	ruleSet := &RuleSet{
+		Name:    name,
+		Subject: tags(g.namespace, s.labels),
+	}
+
+	for _, p := range sortedPeers(s.ingress) {
+		ruleSet.ReceiverRules = append(ruleSet.ReceiverRules, rule(p))
+	}
+
+	for _, p := range sortedPeers(s.egress) {
+		ruleSet.TransmitterRules = append(ruleSet.TransmitterRules, rule(p))
+	}
+
+	return ruleSet
+}
+
+func rule(p *peer) Rule {
+
+	r := Rule{Ports: sortedPorts(p.ports), Action: "accept"}
+	if p.cidr != "" {
+		r.Network = p.cidr
+	} else {
+		r.Tags = tags(p.namespace, p.labels)
+	}
+
+	return r
+}
+
+// tags returns the Trireme tags of the pus of a namespace with the given labels
+func tags(namespace string, labels map[string]string) []string {
+
+	result := []string{NamespaceTag + "=" + namespace}
+	for k, v := range labels {
+		result = append(result, UserTagPrefix+k+"="+v)
+	}
+	sort.Strings(result[1:])
+
+	return result
+}
+
+// RuleSetsYAML returns the Trireme rule sets as YAML
+func (r *Result) RuleSetsYAML() ([]byte, error) {
+
+	data, err := yaml.Marshal(r.RuleSets)
+	if err != nil {
+		return nil, fmt.Errorf("Encoding rule sets %s", err)
+	}
+
+	return data, nil
+}